@@ -0,0 +1,290 @@
+// Package client plays the mpc-node side of the callback protocol: it builds
+// and signs Check requests, sends them to a callback server and verifies the
+// signed responses. It is meant for end-to-end testing without a real
+// Sinohope MPC node.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sinohope/mpc-node-callback-demo/service"
+	"github.com/sinohope/mpc-node-callback-demo/service/ecies"
+)
+
+const (
+	CheckPath            = "/check"
+	RawDataSignaturePath = "/rawdata_signature"
+)
+
+type Config struct {
+	// URL of the callback server, e.g. http://127.0.0.1:9090
+	URL string
+	// MPCNodeKey signs requests and decrypts encrypted responses, the
+	// callback server must be configured with its public key.
+	MPCNodeKey crypto.Signer
+	// CallbackPublicKey verifies Response.Signature.
+	CallbackPublicKey crypto.PublicKey
+	// DecryptSigPublicKey, an *ecdsa.PublicKey or an ecies.X25519PublicKey,
+	// encrypts RequestDetail.Signature of rawdata requests. It is optional
+	// if no rawdata flow is used.
+	DecryptSigPublicKey crypto.PublicKey
+	// SignatureParams are the ECIES parameters encrypting the signature,
+	// nil for the legacy parameters of the key curve.
+	SignatureParams *ecies.ECIESParams
+	// CompressEphemeralKey puts the ECIES ephemeral key in compressed form.
+	CompressEphemeralKey bool
+
+	// SignatureFormat, KeyID and CanonicalJSON must match the callback
+	// server configuration, see service.CallbackServiceConfig.
+	SignatureFormat string
+	KeyID           string
+	CallbackKeyID   string
+	CanonicalJSON   bool
+
+	HTTPClient *http.Client
+	// MaxWaitRetries bounds how often Do asks again after a WAIT response,
+	// waiting wait_time (DefaultWaitPeriod if unset) capped at MaxWait.
+	MaxWaitRetries    int
+	MaxWait           time.Duration
+	DefaultWaitPeriod time.Duration
+}
+
+type Client struct {
+	cfg *Config
+	// sleep is replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func New(cfg *Config) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("callback server url is required")
+	}
+	if cfg.MPCNodeKey == nil {
+		return nil, fmt.Errorf("mpc-node private key is required")
+	}
+	if cfg.CallbackPublicKey == nil {
+		return nil, fmt.Errorf("callback server public key is required")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if cfg.DefaultWaitPeriod == 0 {
+		cfg.DefaultWaitPeriod = 60 * time.Second
+	}
+	return &Client{cfg: cfg, sleep: sleepContext}, nil
+}
+
+// NewCallbackId returns a random callback id, a new one is used for every
+// request the mpc-node sends.
+func NewCallbackId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewKeygenRequest builds a keygen Check.
+func NewKeygenRequest(t, n int, cryptography string, partyIds []string, extra service.ExtraInfo) *service.Check {
+	return &service.Check{
+		CallbackId:  NewCallbackId(),
+		RequestType: service.RequestTypeKeygen,
+		RequestDetail: service.RequestDetail{
+			T:            t,
+			N:            n,
+			Cryptography: cryptography,
+			PartyIds:     partyIds,
+		},
+		ExtraInfo: extra,
+	}
+}
+
+// NewSignRequest builds a sign Check for message with the given tx_info.
+func NewSignRequest(signType, publicKey, path, message string, txInfo json.RawMessage, extra service.ExtraInfo) *service.Check {
+	return &service.Check{
+		CallbackId:  NewCallbackId(),
+		RequestType: service.RequestTypeSign,
+		RequestDetail: service.RequestDetail{
+			SignType:  signType,
+			PublicKey: publicKey,
+			Path:      path,
+			Message:   message,
+			TxInfo:    txInfo,
+		},
+		ExtraInfo: extra,
+	}
+}
+
+// NewRawDataRequest builds a rawdata signature Check. signature is the hex
+// encoded signature produced by the mpc-node and is ECIES encrypted to the
+// decrypt-signature public key.
+func (c *Client) NewRawDataRequest(publicKey, path, message, signature string, extra service.ExtraInfo) (*service.Check, error) {
+	encrypted, err := c.EncryptSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	return &service.Check{
+		CallbackId:  NewCallbackId(),
+		RequestType: service.RequestTypeRawData,
+		RequestDetail: service.RequestDetail{
+			PublicKey: publicKey,
+			Path:      path,
+			Message:   message,
+			Signature: encrypted,
+		},
+		ExtraInfo: extra,
+	}, nil
+}
+
+// EncryptSignature ECIES encrypts a hex encoded signature the way the
+// mpc-node fills RequestDetail.Signature.
+func (c *Client) EncryptSignature(signature string) (string, error) {
+	if c.cfg.DecryptSigPublicKey == nil {
+		return "", fmt.Errorf("decrypt-signature public key is required")
+	}
+	plain, err := hex.DecodeString(signature)
+	if err != nil {
+		return "", fmt.Errorf("decode signature failed, %v", err)
+	}
+	ct, err := service.EncryptSignature(c.cfg.DecryptSigPublicKey, c.cfg.SignatureParams, c.cfg.CompressEphemeralKey, plain)
+	if err != nil {
+		return "", fmt.Errorf("encrypt signature failed, %v", err)
+	}
+	return hex.EncodeToString(ct), nil
+}
+
+// ResponseError is returned for responses whose Status is not
+// service.StatusSuccess. The response signature has been verified.
+type ResponseError struct {
+	HTTPStatus int
+	Response   *service.Response
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("callback server returned http %d, status %s: %s", e.HTTPStatus, e.Response.Status, e.Response.Error)
+}
+
+// Send signs and posts request to path once and returns the verified
+// response.
+func (c *Client) Send(ctx context.Context, path string, request *service.Check) (*service.Response, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request failed, %v", err)
+	}
+	signed := body
+	if c.cfg.CanonicalJSON {
+		if signed, err = service.CanonicalJSON(body); err != nil {
+			return nil, err
+		}
+	}
+	signature, err := service.SignPayload(c.cfg.SignatureFormat, c.cfg.KeyID, c.cfg.MPCNodeKey, signed)
+	if err != nil {
+		return nil, fmt.Errorf("sign request failed, %v", err)
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.cfg.URL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("Signature", signature)
+
+	httpResponse, err := c.cfg.HTTPClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+	respBody, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response failed, %v", err)
+	}
+	response := &service.Response{}
+	if err = json.Unmarshal(respBody, response); err != nil {
+		return nil, fmt.Errorf("http %d, parse response failed, %v: %s", httpResponse.StatusCode, err, respBody)
+	}
+	if err = c.VerifyResponse(response); err != nil {
+		return nil, err
+	}
+	if err = service.DecryptResponse(response, c.cfg.MPCNodeKey); err != nil {
+		return nil, err
+	}
+	if response.Status != service.StatusSuccess {
+		return nil, &ResponseError{HTTPStatus: httpResponse.StatusCode, Response: response}
+	}
+	if response.Data == nil {
+		return nil, fmt.Errorf("response has no data")
+	}
+	if response.Data.CallbackId != request.CallbackId {
+		return nil, fmt.Errorf("response callback id %s does not match request %s", response.Data.CallbackId, request.CallbackId)
+	}
+	return response, nil
+}
+
+// VerifyResponse checks Response.Signature with the callback server public
+// key.
+func (c *Client) VerifyResponse(response *service.Response) error {
+	if response.Signature == "" {
+		return fmt.Errorf("response is not signed")
+	}
+	payload, err := service.ResponsePayload(response, c.cfg.CanonicalJSON)
+	if err != nil {
+		return err
+	}
+	if err = service.VerifyPayload(c.cfg.SignatureFormat, c.cfg.CallbackKeyID, c.cfg.CallbackPublicKey, payload, response.Signature); err != nil {
+		return fmt.Errorf("verify response signature failed, %v", err)
+	}
+	return nil
+}
+
+// Do sends request and, while the callback server answers WAIT, waits for
+// the returned wait_time and asks again, up to MaxWaitRetries times. The last
+// response is returned, its action may still be WAIT.
+func (c *Client) Do(ctx context.Context, path string, request *service.Check) (*service.Response, error) {
+	for attempt := 0; ; attempt++ {
+		response, err := c.Send(ctx, path, request)
+		if err != nil {
+			return nil, err
+		}
+		if response.Data.Action != service.Wait || attempt >= c.cfg.MaxWaitRetries {
+			return response, nil
+		}
+		wait := c.waitPeriod(response.Data.WaitTime)
+		log.Printf("callback-id [%s] got %s, retry %d/%d after %v", request.CallbackId, service.Wait, attempt+1, c.cfg.MaxWaitRetries, wait)
+		if err = c.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) waitPeriod(waitTime string) time.Duration {
+	wait := c.cfg.DefaultWaitPeriod
+	if seconds, err := strconv.Atoi(waitTime); err == nil && seconds >= 0 {
+		wait = time.Duration(seconds) * time.Second
+	}
+	if c.cfg.MaxWait > 0 && wait > c.cfg.MaxWait {
+		wait = c.cfg.MaxWait
+	}
+	return wait
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
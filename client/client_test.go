@@ -0,0 +1,307 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sinohope/mpc-node-callback-demo/service"
+)
+
+type testKeys struct {
+	mpcNode    *ecdsa.PrivateKey
+	callback   *ecdsa.PrivateKey
+	decryptSig *ecdsa.PrivateKey
+}
+
+func newTestServer(t *testing.T, cfg *service.CallbackServiceConfig) (*httptest.Server, *testKeys) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	keys := &testKeys{}
+	for _, k := range []**ecdsa.PrivateKey{&keys.mpcNode, &keys.callback, &keys.decryptSig} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*k = key
+	}
+	cfg.PrivateKeyPath = writePrivateKey(t, dir, "callback.pem", keys.callback)
+	cfg.DecryptSigKeyPath = writePrivateKey(t, dir, "decrypt_sig.pem", keys.decryptSig)
+	cfg.MPCNodePublicKeyPath = writePublicKey(t, dir, "mpc_node_public.pem", &keys.mpcNode.PublicKey)
+	s, err := service.NewCallBackService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s.Router())
+	t.Cleanup(server.Close)
+	return server, keys
+}
+
+func writePrivateKey(t *testing.T, dir, name string, key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writePublicKey(t *testing.T, dir, name string, key *ecdsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEndToEnd(t *testing.T) {
+	for _, format := range []string{service.SignatureFormatHex, service.SignatureFormatJWS, service.SignatureFormatJWSDetached} {
+		for _, canonical := range []bool{false, true} {
+			server, keys := newTestServer(t, &service.CallbackServiceConfig{
+				SignatureFormat: format,
+				KeyID:           "callback",
+				MPCNodeKeyID:    "mpc-node",
+				CanonicalJSON:   canonical,
+			})
+			c, err := New(&Config{
+				URL:                 server.URL,
+				MPCNodeKey:          keys.mpcNode,
+				CallbackPublicKey:   &keys.callback.PublicKey,
+				DecryptSigPublicKey: &keys.decryptSig.PublicKey,
+				SignatureFormat:     format,
+				KeyID:               "mpc-node",
+				CallbackKeyID:       "callback",
+				CanonicalJSON:       canonical,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			extra := service.ExtraInfo{SinoId: "sino", RequestId: "request"}
+			digest := sha256.Sum256([]byte("message"))
+			message := hex.EncodeToString(digest[:])
+			rawdata, err := c.NewRawDataRequest("", "m/0", message, hex.EncodeToString(digest[:]), extra)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, test := range []struct {
+				path    string
+				request *service.Check
+			}{
+				{CheckPath, NewKeygenRequest(2, 3, "secp256k1", []string{"a", "b", "c"}, extra)},
+				{CheckPath, NewSignRequest("ecdsa", "", "m/0", message, json.RawMessage(`{"to":"0x0"}`), extra)},
+				{RawDataSignaturePath, rawdata},
+			} {
+				response, err := c.Do(context.Background(), test.path, test.request)
+				if err != nil {
+					t.Fatalf("%s %v: %v", format, canonical, err)
+				}
+				if response.Data.Action != service.Approve || response.Data.SinoId != "sino" {
+					t.Fatalf("%s %v: unexpected response %+v", format, canonical, response.Data)
+				}
+			}
+		}
+	}
+}
+
+// recordingTransport keeps the last response body.
+type recordingTransport struct {
+	body []byte
+}
+
+func (r *recordingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := http.DefaultTransport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	r.body, err = io.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(r.body))
+	return response, err
+}
+
+func TestEncryptedResponse(t *testing.T) {
+	for _, test := range []struct {
+		mode, scheme string
+		hidden       []string
+	}{
+		{service.ResponseEncryptionData, "", []string{`"data"`, service.Approve, "sino"}},
+		{"action,wait_time", "aes-256-gcm", []string{service.Approve}},
+	} {
+		server, keys := newTestServer(t, &service.CallbackServiceConfig{
+			ResponseEncryption:       test.mode,
+			ResponseEncryptionScheme: test.scheme,
+		})
+		transport := &recordingTransport{}
+		c, err := New(&Config{
+			URL:               server.URL,
+			MPCNodeKey:        keys.mpcNode,
+			CallbackPublicKey: &keys.callback.PublicKey,
+			HTTPClient:        &http.Client{Transport: transport},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		request := NewKeygenRequest(2, 3, "secp256k1", nil, service.ExtraInfo{SinoId: "sino"})
+		response, err := c.Send(context.Background(), CheckPath, request)
+		if err != nil {
+			t.Fatalf("%s: %v", test.mode, err)
+		}
+		if response.Data.Action != service.Approve || response.Data.SinoId != "sino" || response.Data.EncryptedFields != "" {
+			t.Fatalf("%s: unexpected response %+v", test.mode, response.Data)
+		}
+		for _, hidden := range test.hidden {
+			if bytes.Contains(transport.body, []byte(hidden)) {
+				t.Errorf("%s: %s in clear in %s", test.mode, hidden, transport.body)
+			}
+		}
+	}
+
+	_, keys := newTestServer(t, &service.CallbackServiceConfig{})
+	dir := t.TempDir()
+	for _, mode := range []string{"status", "encrypted_fields"} {
+		_, err := service.NewCallBackService(&service.CallbackServiceConfig{
+			PrivateKeyPath:       writePrivateKey(t, dir, "callback.pem", keys.callback),
+			MPCNodePublicKeyPath: writePublicKey(t, dir, "mpc_node_public.pem", &keys.mpcNode.PublicKey),
+			ResponseEncryption:   mode,
+		})
+		if err == nil {
+			t.Errorf("response encryption %q accepted", mode)
+		}
+	}
+}
+
+func TestResponseReasons(t *testing.T) {
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	policy := `{"default_action":"APPROVE","rules":[{"id":"block-sino","action":"REJECT","reason":"sino bad is blocked","match":{"sino_ids":["bad"]}}]}`
+	if err := ioutil.WriteFile(policyPath, []byte(policy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		reasons, encrypt string
+		want             service.ResponseData
+	}{
+		{"", "", service.ResponseData{}},
+		{service.ResponseReasonsCode, "", service.ResponseData{RuleId: "block-sino", ReasonCode: service.ReasonRule}},
+		{service.ResponseReasonsFull, "reason", service.ResponseData{RuleId: "block-sino", ReasonCode: service.ReasonRule, Reason: "sino bad is blocked"}},
+	} {
+		server, keys := newTestServer(t, &service.CallbackServiceConfig{
+			PolicyPath:         policyPath,
+			ResponseReasons:    test.reasons,
+			ResponseEncryption: test.encrypt,
+		})
+		c, err := New(&Config{URL: server.URL, MPCNodeKey: keys.mpcNode, CallbackPublicKey: &keys.callback.PublicKey})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, sinoId := range []string{"bad", "good"} {
+			request := NewKeygenRequest(2, 3, "secp256k1", nil, service.ExtraInfo{SinoId: sinoId})
+			response, err := c.Send(context.Background(), CheckPath, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := test.want
+			if sinoId != "bad" {
+				want = service.ResponseData{}
+			}
+			got := service.ResponseData{RuleId: response.Data.RuleId, ReasonCode: response.Data.ReasonCode, Reason: response.Data.Reason}
+			if got != want {
+				t.Errorf("reasons %q, sino %s: got %+v, want %+v", test.reasons, sinoId, got, want)
+			}
+		}
+	}
+}
+
+func TestSignedErrorResponse(t *testing.T) {
+	server, keys := newTestServer(t, &service.CallbackServiceConfig{})
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c, err := New(&Config{
+		URL:               server.URL,
+		MPCNodeKey:        other,
+		CallbackPublicKey: &keys.callback.PublicKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Send(context.Background(), CheckPath, NewKeygenRequest(2, 3, "secp256k1", nil, service.ExtraInfo{}))
+	responseErr, ok := err.(*ResponseError)
+	if !ok {
+		t.Fatalf("expected a ResponseError, got %v", err)
+	}
+	if responseErr.Response.Status != service.ErrBadSignature.Code || responseErr.HTTPStatus != service.ErrBadSignature.HTTPStatus {
+		t.Fatalf("unexpected error response %+v", responseErr.Response)
+	}
+}
+
+func TestWaitRetry(t *testing.T) {
+	callbackKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	mpcNodeKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := &service.Check{}
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+			t.Error(err)
+			return
+		}
+		calls++
+		response := &service.Response{
+			Status: service.StatusSuccess,
+			Data:   &service.ResponseData{CallbackId: request.CallbackId, Action: service.Wait, WaitTime: "30"},
+		}
+		if calls == 3 {
+			response.Data.Action, response.Data.WaitTime = service.Approve, ""
+		}
+		payload, _ := service.ResponsePayload(response, false)
+		response.Signature, _ = service.SignPayload(service.SignatureFormatHex, "", callbackKey, payload)
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	c, err := New(&Config{
+		URL:               server.URL,
+		MPCNodeKey:        mpcNodeKey,
+		CallbackPublicKey: &callbackKey.PublicKey,
+		MaxWaitRetries:    5,
+		MaxWait:           10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var waited []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		waited = append(waited, d)
+		return nil
+	}
+	response, err := c.Do(context.Background(), CheckPath, NewKeygenRequest(2, 3, "secp256k1", nil, service.ExtraInfo{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Data.Action != service.Approve || calls != 3 {
+		t.Fatalf("expected approve after 3 calls, got %s after %d", response.Data.Action, calls)
+	}
+	if len(waited) != 2 || waited[0] != 10*time.Second {
+		t.Fatalf("unexpected waits %v", waited)
+	}
+}
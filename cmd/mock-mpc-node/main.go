@@ -0,0 +1,191 @@
+// Command mock-mpc-node sends signed keygen, sign and rawdata callbacks to a
+// callback server the way a Sinohope MPC node does and verifies the signed
+// responses.
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sinohope/mpc-node-callback-demo/client"
+	"github.com/sinohope/mpc-node-callback-demo/service"
+	"github.com/sinohope/mpc-node-callback-demo/service/ecies"
+)
+
+var (
+	url                     = flag.String("url", "http://127.0.0.1:9090", "callback-server url")
+	mpcNodePrivateKeyPath   = flag.String("mpc-node-private-key-path", "./mpc_node_private.pem", "mpc-node private key path")
+	callbackPublicKeyPath   = flag.String("callback-public-key-path", "./callback_server_public.pem", "callback-server public key path")
+	decryptSigPublicKeyPath = flag.String("sig-public-path", "./decrypt_sig_public.pem", "decrypt signature public key path")
+	eciesScheme             = flag.String("ecies-scheme", "legacy", "ecies scheme of rawdata signatures: legacy, aes-256-gcm or chacha20-poly1305")
+	eciesCompressed         = flag.Bool("ecies-compressed", false, "compress the ecies ephemeral key of rawdata signatures")
+	flows                   = flag.String("flow", "keygen,sign,rawdata", "comma separated flows to run: keygen, sign, rawdata")
+	count                   = flag.Int("count", 1, "number of times every flow is run")
+	signatureFormat         = flag.String("signature-format", "hex", "request and response signature format: hex, jws or jws-detached")
+	keyID                   = flag.String("key-id", "", "key id put in the JWS header of requests")
+	callbackKeyID           = flag.String("callback-key-id", "", "key id expected in the JWS header of responses")
+	canonicalJSON           = flag.Bool("canonical-json", false, "sign and verify RFC 8785 canonical JSON")
+	maxWaitRetries          = flag.Int("max-wait-retries", 3, "how many times a WAIT response is retried")
+	maxWait                 = flag.Duration("max-wait", 5*time.Second, "upper bound for the wait between retries")
+	sinoID                  = flag.String("sino-id", "mock-sino-id", "extra_info.sino_id")
+	threshold               = flag.Int("t", 2, "keygen threshold")
+	parties                 = flag.Int("n", 3, "keygen parties")
+	cryptography            = flag.String("cryptography", "secp256k1", "keygen cryptography")
+	partyIDs                = flag.String("party-ids", "party-1,party-2,party-3", "comma separated keygen party ids")
+	signType                = flag.String("sign-type", "ecdsa", "sign request sign_type")
+	publicKey               = flag.String("public-key", "", "request_detail.public_key of sign and rawdata requests")
+	derivationPath          = flag.String("path", "m/44/60/0/0/0", "request_detail.path of sign and rawdata requests")
+	message                 = flag.String("message", "", "hex message to sign, defaults to a random 32 bytes digest")
+	txInfo                  = flag.String("tx-info", "", "tx_info json of sign requests")
+)
+
+func main() {
+	flag.Parse()
+
+	mpcNodeKey, err := loadPrivateKey(*mpcNodePrivateKeyPath)
+	if err != nil {
+		log.Fatalf("load mpc-node private key failed, %v", err)
+	}
+	callbackPublicKey, err := loadPublicKey(*callbackPublicKeyPath)
+	if err != nil {
+		log.Fatalf("load callback server public key failed, %v", err)
+	}
+	cfg := &client.Config{
+		URL:               *url,
+		MPCNodeKey:        mpcNodeKey,
+		CallbackPublicKey: callbackPublicKey,
+		SignatureFormat:   *signatureFormat,
+		KeyID:             *keyID,
+		CallbackKeyID:     *callbackKeyID,
+		CanonicalJSON:     *canonicalJSON,
+		MaxWaitRetries:    *maxWaitRetries,
+		MaxWait:           *maxWait,
+	}
+	if strings.Contains(*flows, "rawdata") {
+		key, err := loadPublicKey(*decryptSigPublicKeyPath)
+		if err != nil {
+			log.Fatalf("load decrypt signature public key failed, %v", err)
+		}
+		cfg.DecryptSigPublicKey = key
+		if cfg.SignatureParams, err = ecies.ParamsFromName(*eciesScheme); err != nil {
+			log.Fatal(err)
+		}
+		cfg.CompressEphemeralKey = *eciesCompressed
+	}
+	c, err := client.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	failed := 0
+	for i := 0; i < *count; i++ {
+		for _, flow := range strings.Split(*flows, ",") {
+			if err := run(c, mpcNodeKey, strings.TrimSpace(flow), i); err != nil {
+				log.Printf("%s #%d failed, %v", flow, i, err)
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d flows failed", failed)
+	}
+}
+
+func run(c *client.Client, mpcNodeKey crypto.Signer, flow string, i int) error {
+	extra := service.ExtraInfo{SinoId: *sinoID, RequestId: fmt.Sprintf("mock-%d-%d", time.Now().Unix(), i)}
+	var (
+		request *service.Check
+		path    = client.CheckPath
+		err     error
+	)
+	switch flow {
+	case "keygen":
+		request = client.NewKeygenRequest(*threshold, *parties, *cryptography, strings.Split(*partyIDs, ","), extra)
+	case "sign":
+		var tx json.RawMessage
+		if *txInfo != "" {
+			tx = json.RawMessage(*txInfo)
+		}
+		request = client.NewSignRequest(*signType, *publicKey, *derivationPath, messageDigest(), tx, extra)
+	case "rawdata":
+		msg := messageDigest()
+		signature, err := mockSignature(mpcNodeKey, msg)
+		if err != nil {
+			return err
+		}
+		if request, err = c.NewRawDataRequest(*publicKey, *derivationPath, msg, signature, extra); err != nil {
+			return err
+		}
+		path = client.RawDataSignaturePath
+	default:
+		return fmt.Errorf("unknown flow %q", flow)
+	}
+
+	response, err := c.Do(context.Background(), path, request)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s callback-id: [%s] request-id: [%s] action: [%s] wait-time: [%s] signature verified",
+		flow, response.Data.CallbackId, response.Data.RequestId, response.Data.Action, response.Data.WaitTime)
+	if response.Data.ReasonCode != "" {
+		log.Printf("rule: [%s] reason-code: [%s] reason: [%s]", response.Data.RuleId, response.Data.ReasonCode, response.Data.Reason)
+	}
+	return nil
+}
+
+func messageDigest() string {
+	if *message != "" {
+		return *message
+	}
+	digest := make([]byte, sha256.Size)
+	if _, err := rand.Read(digest); err != nil {
+		log.Fatal(err)
+	}
+	return hex.EncodeToString(digest)
+}
+
+// mockSignature stands in for the MPC signature over message.
+func mockSignature(key crypto.Signer, message string) (string, error) {
+	msg, err := hex.DecodeString(message)
+	if err != nil {
+		return "", fmt.Errorf("message is not hex, %v", err)
+	}
+	var signature []byte
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		signature, err = key.Sign(rand.Reader, msg, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(msg)
+		signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(signature), nil
+}
+
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return service.ParsePrivateKeyPEM(pemData)
+}
+
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return service.ParsePublicKeyPEM(pemData)
+}
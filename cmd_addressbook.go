@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sinohope/mpc-node-callback-demo/service"
+)
+
+var addressBookCommands = map[string]func(args []string) error{
+	"import": addressBookImport,
+	"list":   addressBookList,
+	"lookup": addressBookLookup,
+}
+
+const addressBookUsage = `usage: %s address-book <command> [flags]
+
+commands:
+  import  import addresses from a CSV or an SDN XML file
+  list    list the entries of the address book
+  lookup  print the list an address is on
+
+The address book file must not be modified while the callback server runs,
+use the /admin API instead.
+`
+
+func runAddressBook(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, addressBookUsage, os.Args[0])
+		return fmt.Errorf("missing address-book command")
+	}
+	cmd, ok := addressBookCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, addressBookUsage, os.Args[0])
+		return fmt.Errorf("unknown address-book command %q", args[0])
+	}
+	return cmd(args[1:])
+}
+
+func addressBookImport(args []string) error {
+	fs := flag.NewFlagSet("address-book import", flag.ExitOnError)
+	path := fs.String("address-book", "./address_book.json", "address book file")
+	csvPath := fs.String("csv", "", "CSV file of chain,address[,list[,label]] records")
+	sdnPath := fs.String("sdn", "", "OFAC style SDN XML file, imported into the denylist")
+	list := fs.String("list", service.AddressListDeny, "list of CSV records without one: allow or deny")
+	source := fs.String("source", "", "source recorded with the entries, the file name if empty")
+	network := newBitcoinNetworkFlag(fs)
+	fs.Parse(args)
+
+	if (*csvPath == "") == (*sdnPath == "") {
+		return fmt.Errorf("exactly one of -csv and -sdn is required")
+	}
+	bitcoin, err := service.BitcoinNetworkByName(*network)
+	if err != nil {
+		return err
+	}
+	book, err := service.OpenAddressBook(*path, bitcoin)
+	if err != nil {
+		return err
+	}
+	var result *service.AddressImport
+	if *csvPath != "" {
+		if *source == "" {
+			*source = *csvPath
+		}
+		f, err := os.Open(*csvPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		result, err = service.ParseAddressCSV(f, *list, *source, bitcoin)
+		if err != nil {
+			return err
+		}
+	} else {
+		f, err := os.Open(*sdnPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if result, err = service.ParseSDNXML(f, bitcoin); err != nil {
+			return err
+		}
+	}
+	for _, invalid := range result.Invalid {
+		fmt.Fprintf(os.Stderr, "skipped %s\n", invalid)
+	}
+	if err = book.Add(result.Entries...); err != nil {
+		return err
+	}
+	fmt.Printf("imported %d addresses, skipped %d\n", len(result.Entries), len(result.Invalid))
+	return nil
+}
+
+func addressBookList(args []string) error {
+	fs := flag.NewFlagSet("address-book list", flag.ExitOnError)
+	path := fs.String("address-book", "./address_book.json", "address book file")
+	list := fs.String("list", "", "only list allow or deny entries")
+	chain := fs.String("chain", "", "only list entries of chain")
+	network := newBitcoinNetworkFlag(fs)
+	fs.Parse(args)
+
+	book, err := openAddressBook(*path, *network)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LIST\tCHAIN\tADDRESS\tLABEL\tSOURCE")
+	for _, entry := range book.Entries(*list, *chain) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.List, entry.Chain, entry.Address, entry.Label, entry.Source)
+	}
+	return w.Flush()
+}
+
+func addressBookLookup(args []string) error {
+	fs := flag.NewFlagSet("address-book lookup", flag.ExitOnError)
+	path := fs.String("address-book", "./address_book.json", "address book file")
+	chain := fs.String("chain", service.ChainEthereum, "chain of the address")
+	address := fs.String("address", "", "address to look up")
+	network := newBitcoinNetworkFlag(fs)
+	fs.Parse(args)
+
+	book, err := openAddressBook(*path, *network)
+	if err != nil {
+		return err
+	}
+	list, err := book.Lookup(*chain, *address)
+	if err != nil {
+		return err
+	}
+	fmt.Println(list)
+	return nil
+}
+
+func newBitcoinNetworkFlag(fs *flag.FlagSet) *string {
+	return fs.String("bitcoin-network", "mainnet", "network of the bitcoin addresses: mainnet, testnet, signet or regtest")
+}
+
+// openAddressBook opens the address book at path for the bitcoin network
+// called network.
+func openAddressBook(path, network string) (*service.AddressBook, error) {
+	bitcoin, err := service.BitcoinNetworkByName(network)
+	if err != nil {
+		return nil, err
+	}
+	return service.OpenAddressBook(path, bitcoin)
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+
+	"github.com/sinohope/mpc-node-callback-demo/service"
+	"github.com/sinohope/mpc-node-callback-demo/service/ecies"
+)
+
+const (
+	keyTypeP256      = "p256"
+	keyTypeSecp256k1 = "secp256k1"
+	keyTypeEd25519   = "ed25519"
+	keyTypeX25519    = "x25519"
+	keyFormatHex     = "hex"
+)
+
+var keysCommands = map[string]func(args []string) error{
+	"generate":      keysGenerate,
+	"derive":        keysDerive,
+	"convert":       keysConvert,
+	"fingerprint":   keysFingerprint,
+	"export-public": keysExportPublic,
+	"backup":        keysBackup,
+	"restore":       keysRestore,
+}
+
+const keysUsage = `usage: %s keys <command> [flags]
+
+commands:
+  generate       generate a p256, secp256k1, ed25519 or x25519 keypair
+  derive         derive a secp256k1 keypair from a password and salted parameters
+  convert        convert a private key between sec1, pkcs8 and hex
+  fingerprint    print the sha256 fingerprint of a public or private key
+  export-public  export the public key of a private key for the mpc-node
+  backup         split a private key into M-of-N Shamir shares
+  restore        restore a private key from its Shamir shares
+`
+
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, keysUsage, os.Args[0])
+		return fmt.Errorf("missing keys command")
+	}
+	cmd, ok := keysCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, keysUsage, os.Args[0])
+		return fmt.Errorf("unknown keys command %q", args[0])
+	}
+	return cmd(args[1:])
+}
+
+func keysGenerate(args []string) error {
+	fs := flag.NewFlagSet("keys generate", flag.ExitOnError)
+	keyType := fs.String("type", keyTypeP256, "key type: p256, secp256k1, ed25519 or x25519 (decrypt-signature keys only)")
+	format := fs.String("format", service.KeyFormatPKCS8, "private key format: sec1 or pkcs8")
+	privateOut := fs.String("out", "", "private key output file, stdout if empty")
+	publicOut := fs.String("public-out", "", "public key output file, stdout if empty")
+	fs.Parse(args)
+
+	if *keyType == keyTypeX25519 {
+		return generateX25519(*format, *privateOut, *publicOut)
+	}
+
+	var key crypto.Signer
+	var err error
+	switch *keyType {
+	case keyTypeP256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case keyTypeSecp256k1:
+		key, err = ecdsa.GenerateKey(btcec.S256(), rand.Reader)
+	case keyTypeEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return fmt.Errorf("unknown key type %q", *keyType)
+	}
+	if err != nil {
+		return fmt.Errorf("generate %s key failed, %v", *keyType, err)
+	}
+	return writeKeypair(key, *format, *privateOut, *publicOut)
+}
+
+// generateX25519 writes an X25519 keypair, which is not a crypto.Signer
+// and only exists as PKCS#8.
+func generateX25519(format, privateOut, publicOut string) error {
+	if format != service.KeyFormatPKCS8 {
+		return fmt.Errorf("x25519 keys are only encoded as pkcs8")
+	}
+	key, err := ecies.GenerateX25519Key(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate x25519 key failed, %v", err)
+	}
+	private, err := service.MarshalX25519PrivateKeyPEM(key)
+	if err != nil {
+		return err
+	}
+	public, err := service.MarshalPublicKeyPEM(key.Public())
+	if err != nil {
+		return err
+	}
+	if err = writeOutput(privateOut, private, 0600); err != nil {
+		return err
+	}
+	return writeOutput(publicOut, public, 0644)
+}
+
+func keysDerive(args []string) error {
+	fs := flag.NewFlagSet("keys derive", flag.ExitOnError)
+	passwordFile := fs.String("password-file", "", "file holding the password, read from stdin if empty")
+	format := fs.String("format", service.KeyFormatSEC1, "private key format: sec1, pkcs8 or hex")
+	privateOut := fs.String("out", "", "private key output file, stdout if empty")
+	publicOut := fs.String("public-out", "", "public key output file, stdout if empty")
+	paramsIn := fs.String("params", "", "derivation parameters JSON file to re-derive a key with, a new version 2 record with a random salt if empty")
+	paramsOut := fs.String("params-out", "", "derivation parameters output file, <out>.params.json next to -out or stdout if empty")
+	fs.Parse(args)
+
+	params, err := readDeriveParams(*paramsIn)
+	if err != nil {
+		return err
+	}
+	password, err := readPassword(*passwordFile)
+	if err != nil {
+		return err
+	}
+	prv, record, err := ecies.DeriveKeyPair(password, params)
+	if errors.Is(err, ecies.ErrKeyCheck) {
+		return fmt.Errorf("derive keypair failed, the derived key does not match key check value %s of %s, wrong password", params.KeyCheck, *paramsIn)
+	} else if err != nil {
+		return fmt.Errorf("derive keypair failed, %v", err)
+	}
+	if err = writeKeypair(prv.ExportECDSA(), *format, *privateOut, *publicOut); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	out := *paramsOut
+	if out == "" && *privateOut != "" && *privateOut != "-" {
+		out = strings.TrimSuffix(*privateOut, filepath.Ext(*privateOut)) + ".params.json"
+	}
+	return writeOutput(out, append(data, '\n'), 0644)
+}
+
+// readDeriveParams reads a derivation parameters record, or returns new
+// version 2 parameters when path is empty.
+func readDeriveParams(path string) (*ecies.DeriveParams, error) {
+	if path == "" {
+		return ecies.NewDeriveParams(rand.Reader)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	params := &ecies.DeriveParams{}
+	if err = json.Unmarshal(data, params); err != nil {
+		return nil, fmt.Errorf("parse derivation parameters %s failed, %v", path, err)
+	}
+	if err = params.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid derivation parameters %s, %v", path, err)
+	}
+	return params, nil
+}
+
+func keysConvert(args []string) error {
+	fs := flag.NewFlagSet("keys convert", flag.ExitOnError)
+	in := fs.String("in", "", "private key PEM file, or with -from hex a file holding \"<private hex> <public hex>\"")
+	from := fs.String("from", "pem", "input format: pem or hex")
+	to := fs.String("to", service.KeyFormatPKCS8, "output format: sec1, pkcs8 or hex")
+	out := fs.String("out", "", "output file, stdout if empty")
+	fs.Parse(args)
+
+	var key crypto.Signer
+	switch *from {
+	case "pem":
+		pemData, err := readInput(*in)
+		if err != nil {
+			return err
+		}
+		if key, err = service.ParsePrivateKeyPEM(pemData); err != nil {
+			return err
+		}
+	case keyFormatHex:
+		data, err := readInput(*in)
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 {
+			return fmt.Errorf("expected \"<private hex> <public hex>\"")
+		}
+		prv, err := ecies.Unmarshal(fields[0], fields[1])
+		if err != nil {
+			return fmt.Errorf("unmarshal hex keypair failed, %v", err)
+		}
+		if prv.PublicKey.X == nil {
+			return fmt.Errorf("invalid secp256k1 public key")
+		}
+		if x, y := prv.Curve.ScalarBaseMult(prv.D.Bytes()); x.Cmp(prv.PublicKey.X) != 0 || y.Cmp(prv.PublicKey.Y) != 0 {
+			return fmt.Errorf("public key does not belong to the private key")
+		}
+		key = prv.ExportECDSA()
+	default:
+		return fmt.Errorf("unknown input format %q", *from)
+	}
+	encoded, err := encodePrivateKey(key, *to)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, encoded, 0600)
+}
+
+func keysFingerprint(args []string) error {
+	fs := flag.NewFlagSet("keys fingerprint", flag.ExitOnError)
+	in := fs.String("in", "", "public or private key PEM file, stdin if empty")
+	fs.Parse(args)
+
+	key, err := readAnyPublicKey(*in)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := service.Fingerprint(key)
+	if err != nil {
+		return err
+	}
+	alg, _ := service.JWSAlgorithm(key)
+	fmt.Printf("SHA256:%s %s\n", fingerprint, alg)
+	return nil
+}
+
+func keysExportPublic(args []string) error {
+	fs := flag.NewFlagSet("keys export-public", flag.ExitOnError)
+	in := fs.String("in", "", "private key PEM file, stdin if empty")
+	format := fs.String("format", "pem", "output format: pem (PKIX, as the mpc-node expects) or hex (uncompressed point)")
+	out := fs.String("out", "", "output file, stdout if empty")
+	fs.Parse(args)
+
+	key, err := readAnyPublicKey(*in)
+	if err != nil {
+		return err
+	}
+	encoded, err := encodePublicKey(key, *format)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, encoded, 0644)
+}
+
+func keysBackup(args []string) error {
+	fs := flag.NewFlagSet("keys backup", flag.ExitOnError)
+	in := fs.String("in", "", "private key PEM file, stdin if empty")
+	threshold := fs.Int("threshold", 2, "number of shares required to restore the key")
+	shares := fs.Int("shares", 3, "number of shares")
+	custodians := fs.String("custodians", "", "comma separated ECDSA or X25519 public key PEM files, one per share, to encrypt the shares to")
+	outDir := fs.String("out-dir", ".", "directory the share-<index>.json files are written to")
+	fs.Parse(args)
+
+	pemData, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+	var custodianKeys []crypto.PublicKey
+	if *custodians != "" {
+		for _, path := range strings.Split(*custodians, ",") {
+			key, err := readAnyPublicKey(path)
+			if err != nil {
+				return fmt.Errorf("custodian %s: %v", path, err)
+			}
+			custodianKeys = append(custodianKeys, key)
+		}
+	}
+	backup, err := service.BackupKey(pemData, *threshold, *shares, custodianKeys)
+	if err != nil {
+		return err
+	}
+	for _, share := range backup {
+		data, err := json.MarshalIndent(share, "", "  ")
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(*outDir, fmt.Sprintf("share-%d.json", share.Index))
+		if err = ioutil.WriteFile(path, append(data, '\n'), 0600); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("wrote %d shares of SHA256:%s to %s, %d restore the key\n", *shares, backup[0].Fingerprint, *outDir, *threshold)
+	return nil
+}
+
+func keysRestore(args []string) error {
+	fs := flag.NewFlagSet("keys restore", flag.ExitOnError)
+	shares := fs.String("shares", "", "comma separated share files")
+	custodianKeys := fs.String("custodian-keys", "", "comma separated custodian private key PEM files of encrypted shares")
+	fingerprint := fs.String("fingerprint", "", "expected SHA256 fingerprint of the restored key, as printed by keys fingerprint")
+	out := fs.String("out", "", "restored private key output file, stdout if empty")
+	fs.Parse(args)
+
+	if *shares == "" {
+		return fmt.Errorf("-shares is required")
+	}
+	var backup []*service.KeyShare
+	for _, path := range strings.Split(*shares, ",") {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		share := &service.KeyShare{}
+		if err = json.Unmarshal(data, share); err != nil {
+			return fmt.Errorf("parse share %s failed, %v", path, err)
+		}
+		backup = append(backup, share)
+	}
+	var keys []crypto.PrivateKey
+	if *custodianKeys != "" {
+		for _, path := range strings.Split(*custodianKeys, ",") {
+			key, err := readDecryptKey(path)
+			if err != nil {
+				return fmt.Errorf("custodian key %s: %v", path, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+	want := strings.TrimPrefix(*fingerprint, "SHA256:")
+	if want != "" && want != backup[0].Fingerprint {
+		return fmt.Errorf("shares are of key SHA256:%s, not SHA256:%s", backup[0].Fingerprint, want)
+	}
+	pemData, err := service.RestoreKey(backup, keys)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "restored key SHA256:%s\n", backup[0].Fingerprint)
+	return writeOutput(*out, pemData, 0600)
+}
+
+func writeKeypair(key crypto.Signer, format, privateOut, publicOut string) error {
+	private, err := encodePrivateKey(key, format)
+	if err != nil {
+		return err
+	}
+	public, err := encodePublicKey(key.Public(), "pem")
+	if err != nil {
+		return err
+	}
+	if err = writeOutput(privateOut, private, 0600); err != nil {
+		return err
+	}
+	return writeOutput(publicOut, public, 0644)
+}
+
+// encodePrivateKey encodes key as sec1 or pkcs8 PEM, or as the
+// "<private hex> <public hex>" pair of ecies.PrivateKey.Marshal.
+func encodePrivateKey(key crypto.Signer, format string) ([]byte, error) {
+	if format != keyFormatHex {
+		return service.MarshalPrivateKeyPEM(key, format)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok || !ecies.IsSecp256k1(ecKey.Curve) {
+		return nil, fmt.Errorf("hex format is only supported for secp256k1 keys")
+	}
+	public, private := ecies.ImportECDSA(ecKey).Marshal()
+	return []byte(private + " " + public + "\n"), nil
+}
+
+func encodePublicKey(key crypto.PublicKey, format string) ([]byte, error) {
+	switch format {
+	case "pem":
+		return service.MarshalPublicKeyPEM(key)
+	case keyFormatHex:
+		switch k := key.(type) {
+		case *ecdsa.PublicKey:
+			return []byte(hex.EncodeToString(elliptic.Marshal(k.Curve, k.X, k.Y)) + "\n"), nil
+		case ed25519.PublicKey:
+			return []byte(hex.EncodeToString(k) + "\n"), nil
+		case ecies.X25519PublicKey:
+			return []byte(hex.EncodeToString(k) + "\n"), nil
+		}
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+	return nil, fmt.Errorf("unknown public key format %q", format)
+}
+
+// readAnyPublicKey reads a PEM file holding either a public or a private key
+// and returns the public key.
+func readAnyPublicKey(path string) (crypto.PublicKey, error) {
+	pemData, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := service.ParsePublicKeyPEM(pemData); err == nil {
+		return key, nil
+	}
+	if key, err := service.ParseX25519PrivateKeyPEM(pemData); err == nil {
+		return key.Public(), nil
+	}
+	key, err := service.ParsePrivateKeyPEM(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("no public or private key found")
+	}
+	return key.Public(), nil
+}
+
+func readPassword(path string) (string, error) {
+	var r io.Reader = os.Stdin
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		fmt.Fprint(os.Stderr, "password: ")
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "" || path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+func writeOutput(path string, data []byte, perm os.FileMode) error {
+	if path == "" || path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(path, data, perm)
+}
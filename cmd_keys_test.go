@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sinohope/mpc-node-callback-demo/service"
+	"github.com/sinohope/mpc-node-callback-demo/service/ecies"
+)
+
+func writeFile(t *testing.T, dir, name, data string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readFile(t *testing.T, path string) []byte {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// fingerprintOf returns the fingerprint of the public key of a public or
+// private key file.
+func fingerprintOf(t *testing.T, path string) string {
+	key, err := readAnyPublicKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := service.Fingerprint(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fingerprint
+}
+
+// generateKeypair runs keys generate and returns the private and public key
+// files.
+func generateKeypair(t *testing.T, dir, keyType string) (string, string) {
+	private := filepath.Join(dir, keyType+".pem")
+	public := filepath.Join(dir, keyType+"_public.pem")
+	if err := runKeys([]string{"generate", "-type", keyType, "-out", private, "-public-out", public}); err != nil {
+		t.Fatal(err)
+	}
+	return private, public
+}
+
+func TestKeysGenerate(t *testing.T) {
+	dir := t.TempDir()
+	for _, keyType := range []string{keyTypeP256, keyTypeSecp256k1, keyTypeEd25519, keyTypeX25519} {
+		for _, format := range []string{service.KeyFormatSEC1, service.KeyFormatPKCS8} {
+			private := filepath.Join(dir, keyType+"-"+format+".pem")
+			public := filepath.Join(dir, keyType+"-"+format+"_public.pem")
+			err := runKeys([]string{"generate", "-type", keyType, "-format", format, "-out", private, "-public-out", public})
+			if format == service.KeyFormatSEC1 && (keyType == keyTypeEd25519 || keyType == keyTypeX25519) {
+				if err == nil {
+					t.Errorf("%s key generated as sec1", keyType)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s %s: %v", keyType, format, err)
+			}
+			if fingerprintOf(t, private) != fingerprintOf(t, public) {
+				t.Errorf("%s %s: public key does not match the private key", keyType, format)
+			}
+			exported := filepath.Join(dir, keyType+"-"+format+"_exported.pem")
+			if err = runKeys([]string{"export-public", "-in", private, "-out", exported}); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(readFile(t, exported), readFile(t, public)) {
+				t.Errorf("%s %s: exported public key differs", keyType, format)
+			}
+		}
+	}
+}
+
+func TestKeysConvert(t *testing.T) {
+	dir := t.TempDir()
+	private, _ := generateKeypair(t, dir, keyTypeSecp256k1)
+	// pkcs8 -> sec1 -> hex -> pkcs8
+	steps := []struct {
+		from, to string
+	}{
+		{"pem", service.KeyFormatSEC1},
+		{"pem", keyFormatHex},
+		{keyFormatHex, service.KeyFormatPKCS8},
+	}
+	in := private
+	for i, step := range steps {
+		out := filepath.Join(dir, fmt.Sprintf("step%d", i))
+		if err := runKeys([]string{"convert", "-in", in, "-from", step.from, "-to", step.to, "-out", out}); err != nil {
+			t.Fatalf("%s to %s: %v", step.from, step.to, err)
+		}
+		if step.to != keyFormatHex && fingerprintOf(t, out) != fingerprintOf(t, private) {
+			t.Errorf("%s to %s: converted a different key", step.from, step.to)
+		}
+		in = out
+	}
+	if !bytes.Equal(readFile(t, in), readFile(t, private)) {
+		t.Error("round trip changed the key file")
+	}
+
+	p256, _ := generateKeypair(t, dir, keyTypeP256)
+	if err := runKeys([]string{"convert", "-in", p256, "-to", keyFormatHex, "-out", filepath.Join(dir, "p256.hex")}); err == nil {
+		t.Error("converted a p256 key to hex")
+	}
+	fields := strings.Fields(string(readFile(t, filepath.Join(dir, "step1"))))
+	_, other := generateKeypair(t, t.TempDir(), keyTypeSecp256k1)
+	otherKey, _ := readAnyPublicKey(other)
+	otherHex, _ := encodePublicKey(otherKey, keyFormatHex)
+	mismatched := writeFile(t, dir, "mismatched.hex", fields[0]+" "+strings.TrimSpace(string(otherHex)))
+	if err := runKeys([]string{"convert", "-in", mismatched, "-from", keyFormatHex, "-out", filepath.Join(dir, "mismatched.pem")}); err == nil {
+		t.Error("converted a hex keypair whose public key does not match")
+	}
+}
+
+func TestKeysBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	private, public := generateKeypair(t, dir, keyTypeP256)
+	if _, err := captureStdout(t, func() error {
+		return runKeys([]string{"backup", "-in", private, "-threshold", "2", "-shares", "3", "-out-dir", dir})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	restored := filepath.Join(dir, "restored.pem")
+	shares := filepath.Join(dir, "share-3.json") + "," + filepath.Join(dir, "share-1.json")
+	if err := runKeys([]string{"restore", "-shares", shares, "-fingerprint", fingerprintOf(t, public), "-out", restored}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readFile(t, restored), readFile(t, private)) {
+		t.Error("restored a different key file")
+	}
+	if err := runKeys([]string{"restore", "-shares", filepath.Join(dir, "share-2.json"), "-out", restored}); err == nil {
+		t.Error("restored from a single share")
+	}
+}
+
+func TestKeysDerive(t *testing.T) {
+	dir := t.TempDir()
+	password := writeFile(t, dir, "password", "correct horse battery staple\n")
+	key := filepath.Join(dir, "key.pem")
+	if err := runKeys([]string{"derive", "-password-file", password, "-out", key, "-public-out", filepath.Join(dir, "key_public.pem")}); err != nil {
+		t.Fatal(err)
+	}
+	paramsPath := filepath.Join(dir, "key.params.json")
+	params := &ecies.DeriveParams{}
+	if err := json.Unmarshal(readFile(t, paramsPath), params); err != nil {
+		t.Fatal(err)
+	}
+	if params.Version != ecies.DeriveVersion2 || params.Salt == "" || params.KeyCheck == "" {
+		t.Fatalf("unexpected derivation parameters %+v", params)
+	}
+
+	// deriving is deterministic: re-deriving with the parameters gives the
+	// same key
+	again := filepath.Join(dir, "again.pem")
+	if err := runKeys([]string{"derive", "-password-file", password, "-params", paramsPath, "-out", again, "-public-out", filepath.Join(dir, "again_public.pem")}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readFile(t, key), readFile(t, again)) {
+		t.Error("re-derived a different key")
+	}
+
+	v1 := writeFile(t, dir, "v1.json", `{"version":1}`)
+	var keys [2][]byte
+	for i := range keys {
+		out := filepath.Join(dir, fmt.Sprintf("v1-%d.pem", i))
+		if err := runKeys([]string{"derive", "-password-file", password, "-params", v1, "-out", out, "-public-out", out + ".pub"}); err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = readFile(t, out)
+	}
+	if !bytes.Equal(keys[0], keys[1]) || bytes.Equal(keys[0], readFile(t, key)) {
+		t.Error("version 1 derivation is not deterministic or ignores the salt")
+	}
+
+	wrong := writeFile(t, dir, "wrong", "wrong horse battery staple\n")
+	err := runKeys([]string{"derive", "-password-file", wrong, "-params", paramsPath, "-out", filepath.Join(dir, "wrong.pem")})
+	if err == nil || !strings.Contains(err.Error(), params.KeyCheck) {
+		t.Errorf("derived with a wrong password: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sinohope/mpc-node-callback-demo/service"
+)
+
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	auditLogPath := fs.String("audit-log", "./audit.log", "audit log to replay")
+	auditLogKey := fs.String("audit-log-key", "", "private key PEM file of an encrypted audit log")
+	policyPath := fs.String("policy", "", "candidate policy file")
+	addressBookPath := fs.String("address-book", "", "address book file looked up by the destination_lists of the policy")
+	keyRegistryPath := fs.String("key-registry", "", "key registry file looked up by the keys policy")
+	network := newBitcoinNetworkFlag(fs)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	if *policyPath == "" {
+		return fmt.Errorf("-policy is required")
+	}
+	policy, err := loadReplayPolicy(*policyPath, *addressBookPath, *network, *keyRegistryPath)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(*auditLogPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if *auditLogKey != "" {
+		key, err := readDecryptKey(*auditLogKey)
+		if err != nil {
+			return err
+		}
+		r = service.DecryptStreams(key, f)
+	}
+	// a report is returned along with the error of truncated streams
+	report, err := service.Replay(r, policy)
+	if report == nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if encErr := enc.Encode(report); encErr != nil {
+			return encErr
+		}
+	} else {
+		printReplayReport(report)
+	}
+	return err
+}
+
+// loadReplayPolicy loads the candidate policy with its address book and key
+// registry, as the callback service does.
+func loadReplayPolicy(policyPath, addressBookPath, bitcoinNetwork, keyRegistryPath string) (*service.RulePolicy, error) {
+	policy, err := service.LoadPolicy(policyPath)
+	if err != nil {
+		return nil, err
+	}
+	if addressBookPath != "" {
+		book, err := openAddressBook(addressBookPath, bitcoinNetwork)
+		if err != nil {
+			return nil, fmt.Errorf("open address book failed, %v", err)
+		}
+		policy.UseAddressBook(book)
+	}
+	if keyRegistryPath != "" {
+		keys, err := service.OpenKeyRegistry(keyRegistryPath)
+		if err != nil {
+			return nil, fmt.Errorf("open key registry failed, %v", err)
+		}
+		policy.UseKeyRegistry(keys)
+	} else if policy.RequiresKeyRegistry() {
+		return nil, fmt.Errorf("policy requires known keys, -key-registry is required")
+	}
+	return policy, nil
+}
+
+func printReplayReport(report *service.ReplayReport) {
+	fmt.Printf("replayed %d requests, skipped %d, %d decisions would change\n", report.Replayed, report.Skipped, report.Changed)
+	if report.TruncatedStreams > 0 {
+		fmt.Printf("WARNING: %d audit log streams were not closed, entries may be missing\n", report.TruncatedStreams)
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if len(report.Transitions) > 0 {
+		transitions := make([]string, 0, len(report.Transitions))
+		for t := range report.Transitions {
+			transitions = append(transitions, t)
+		}
+		sort.Strings(transitions)
+		fmt.Fprintln(w, "TRANSITION\tCOUNT")
+		for _, t := range transitions {
+			fmt.Fprintf(w, "%s\t%d\n", t, report.Transitions[t])
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "RULE\tMATCHED\tCHANGED\tAPPROVE\tREJECT\tWAIT")
+	for _, r := range report.Rules {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\n", r.RuleId, r.Matched, r.Changed,
+			r.Actions[service.Approve], r.Actions[service.Reject], r.Actions[service.Wait])
+	}
+
+	if len(report.Changes) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "TIME\tCALLBACK-ID\tTYPE\tSINO-ID\tREQUEST-ID\tOLD\tNEW")
+		for _, c := range report.Changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s (%s)\t%s (%s)\n",
+				c.Time.Format(time.RFC3339), c.CallbackId, c.RequestType, c.SinoId, c.RequestId,
+				c.OldAction, c.OldRuleId, c.NewAction, c.NewRuleId)
+		}
+	}
+	w.Flush()
+}
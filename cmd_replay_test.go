@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sinohope/mpc-node-callback-demo/service"
+)
+
+func TestLoadReplayPolicy(t *testing.T) {
+	dir := t.TempDir()
+	bookPath := filepath.Join(dir, "address_book.json")
+	book, err := service.OpenAddressBook(bookPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	denied := "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+	if err = book.Add(&service.AddressEntry{Chain: "tron", Address: denied, List: service.AddressListDeny}); err != nil {
+		t.Fatal(err)
+	}
+	policyPath := writeFile(t, dir, "policy.json", `{"default_action":"APPROVE","rules":[
+		{"id":"denied","action":"REJECT","match":{"destination_lists":["deny"]}}]}`)
+
+	request, _ := json.Marshal(&service.Check{
+		RequestType:   service.RequestTypeSign,
+		RequestDetail: service.RequestDetail{TxInfo: json.RawMessage(`{"chain":"tron","to":"` + denied + `"}`)},
+	})
+	line, _ := json.Marshal(&service.AuditEntry{Time: time.Now(), Request: request, Response: &service.ResponseData{Action: service.Approve}})
+	auditLog := writeFile(t, dir, "audit.log", string(line)+"\n")
+
+	for _, test := range []struct {
+		bookPath string
+		changed  int
+	}{
+		{"", 0},
+		{bookPath, 1},
+	} {
+		policy, err := loadReplayPolicy(policyPath, test.bookPath, "mainnet", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(auditLog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := service.Replay(f, policy)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Changed != test.changed {
+			t.Errorf("address book %q: %d changes, want %d", test.bookPath, report.Changed, test.changed)
+		}
+	}
+
+	keysPolicy := writeFile(t, dir, "keys_policy.json", `{"keys":{"require_known_key":true}}`)
+	if _, err = loadReplayPolicy(keysPolicy, "", "", ""); err == nil {
+		t.Error("policy requiring known keys loaded without a key registry")
+	}
+	if _, err = loadReplayPolicy(keysPolicy, "", "", filepath.Join(dir, "keys.json")); err != nil {
+		t.Error(err)
+	}
+}
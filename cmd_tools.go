@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sinohope/mpc-node-callback-demo/service"
+	"github.com/sinohope/mpc-node-callback-demo/service/ecies"
+)
+
+// signingFlags are the flags shared by the offline tools that must match
+// the callback server configuration.
+type signingFlags struct {
+	format    *string
+	keyID     *string
+	canonical *bool
+}
+
+func newSigningFlags(fs *flag.FlagSet) *signingFlags {
+	return &signingFlags{
+		format:    fs.String("signature-format", service.SignatureFormatHex, "signature format: hex, jws or jws-detached"),
+		keyID:     fs.String("key-id", "", "JWS key id to put in or expect in the header"),
+		canonical: fs.Bool("canonical-json", false, "sign and verify RFC 8785 canonical JSON"),
+	}
+}
+
+// payload returns the bytes a signature covers for a captured JSON body.
+func (f *signingFlags) payload(body []byte) ([]byte, error) {
+	if *f.canonical {
+		return service.CanonicalJSON(body)
+	}
+	return body, nil
+}
+
+func runSign(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	keyPath := fs.String("key", "./callback_server_private.pem", "private key PEM file")
+	in := fs.String("in", "", "message file, stdin if empty; signed as is")
+	flags := newSigningFlags(fs)
+	fs.Parse(args)
+
+	key, err := readPrivateKey(*keyPath)
+	if err != nil {
+		return err
+	}
+	body, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+	payload, err := flags.payload(body)
+	if err != nil {
+		return err
+	}
+	signature, err := service.SignPayload(*flags.format, *flags.keyID, key, payload)
+	if err != nil {
+		return err
+	}
+	fmt.Println(signature)
+	return nil
+}
+
+func runVerifyRequest(args []string) error {
+	fs := flag.NewFlagSet("verify-request", flag.ExitOnError)
+	keyPath := fs.String("key", "./mpc_node_public.pem", "mpc-node public key PEM file")
+	in := fs.String("in", "", "captured request body, stdin if empty; must be byte exact")
+	signature := fs.String("signature", "", "value of the Signature header")
+	signatureFile := fs.String("signature-file", "", "file holding the value of the Signature header")
+	flags := newSigningFlags(fs)
+	fs.Parse(args)
+
+	key, err := readAnyPublicKey(*keyPath)
+	if err != nil {
+		return err
+	}
+	if *signatureFile != "" {
+		data, err := ioutil.ReadFile(*signatureFile)
+		if err != nil {
+			return err
+		}
+		*signature = strings.TrimSpace(string(data))
+	}
+	if *signature == "" {
+		return fmt.Errorf("-signature or -signature-file is required")
+	}
+	body, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+	payload, err := flags.payload(body)
+	if err != nil {
+		return err
+	}
+	if err = service.VerifyPayload(*flags.format, *flags.keyID, key, payload, *signature); err != nil {
+		return fmt.Errorf("request signature is invalid, %v", err)
+	}
+	fmt.Println("request signature OK")
+	return nil
+}
+
+func runVerifyResponse(args []string) error {
+	fs := flag.NewFlagSet("verify-response", flag.ExitOnError)
+	keyPath := fs.String("key", "./callback_server_public.pem", "callback-server public key PEM file")
+	in := fs.String("in", "", "captured callback response, stdin if empty")
+	decryptKey := fs.String("decrypt-key", "", "mpc-node private key PEM file decrypting an encrypted response")
+	flags := newSigningFlags(fs)
+	fs.Parse(args)
+
+	key, err := readAnyPublicKey(*keyPath)
+	if err != nil {
+		return err
+	}
+	body, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+	response := &service.Response{}
+	if err = json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("parse response failed, %v", err)
+	}
+	payload, err := service.ResponsePayload(response, *flags.canonical)
+	if err != nil {
+		return err
+	}
+	if err = service.VerifyPayload(*flags.format, *flags.keyID, key, payload, response.Signature); err != nil {
+		return fmt.Errorf("response signature is invalid, %v", err)
+	}
+	fmt.Printf("response signature OK, signed payload: %s\n", payload)
+	if *decryptKey == "" {
+		return nil
+	}
+	mpcNodeKey, err := readDecryptKey(*decryptKey)
+	if err != nil {
+		return err
+	}
+	if err = service.DecryptResponse(response, mpcNodeKey); err != nil {
+		return err
+	}
+	data, err := json.Marshal(response.Data)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("decrypted data: %s\n", data)
+	return nil
+}
+
+func runEncrypt(args []string) error {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	keyPath := fs.String("key", "./decrypt_sig_public.pem", "decrypt-signature public (or private) ECDSA or X25519 key PEM file")
+	in := fs.String("in", "", "hex encoded plaintext, stdin if empty")
+	scheme := fs.String("scheme", "legacy", "ecies scheme: legacy, aes-256-gcm or chacha20-poly1305")
+	compressed := fs.Bool("compressed", false, "compress the ephemeral public key")
+	fs.Parse(args)
+
+	params, err := ecies.ParamsFromName(*scheme)
+	if err != nil {
+		return err
+	}
+	key, err := readAnyPublicKey(*keyPath)
+	if err != nil {
+		return err
+	}
+	plain, err := readHexInput(*in)
+	if err != nil {
+		return err
+	}
+	ct, err := service.EncryptSignature(key, params, *compressed, plain)
+	if err != nil {
+		return fmt.Errorf("encrypt failed, %v", err)
+	}
+	fmt.Println(hex.EncodeToString(ct))
+	return nil
+}
+
+func runDecrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	keyPath := fs.String("key", "./decrypt_sig_pirvate.pem", "decrypt-signature private ECDSA or X25519 key PEM file")
+	in := fs.String("in", "", "hex ciphertext or a captured rawdata_signature request body, stdin if empty")
+	stream := fs.Bool("stream", false, "decrypt binary ECIES streams, such as an encrypted audit log, to stdout")
+	fs.Parse(args)
+
+	key, err := readDecryptKey(*keyPath)
+	if err != nil {
+		return err
+	}
+	if *stream {
+		return decryptStreams(key, *in)
+	}
+	data, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+	cipherText := string(bytes.TrimSpace(data))
+	if strings.HasPrefix(cipherText, "{") {
+		request := &service.Check{}
+		if err = json.Unmarshal(data, request); err != nil {
+			return fmt.Errorf("parse request failed, %v", err)
+		}
+		cipherText = request.RequestDetail.Signature
+	}
+	plain, err := service.DecryptSignature(key, cipherText)
+	if err != nil {
+		return err
+	}
+	fmt.Println(plain)
+	return nil
+}
+
+func decryptStreams(key crypto.PrivateKey, path string) error {
+	var r io.Reader = os.Stdin
+	if path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	_, err := io.Copy(os.Stdout, service.DecryptStreams(key, r))
+	return err
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	if path == "" {
+		return nil, fmt.Errorf("-key is required")
+	}
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return service.ParsePrivateKeyPEM(pemData)
+}
+
+// readDecryptKey reads an X25519 or an ECDSA private key PEM file.
+func readDecryptKey(path string) (crypto.PrivateKey, error) {
+	if path == "" {
+		return nil, fmt.Errorf("-key is required")
+	}
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := service.ParseX25519PrivateKeyPEM(pemData); err == nil {
+		return key, nil
+	}
+	key, err := service.ParsePrivateKeyPEM(pemData)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := key.(*ecdsa.PrivateKey); !ok {
+		return nil, fmt.Errorf("ecies requires an ECDSA or X25519 key, got %T", key)
+	}
+	return key, nil
+}
+
+func readHexInput(path string) ([]byte, error) {
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("input is not hex, %v", err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sinohope/mpc-node-callback-demo/service"
+)
+
+// captureStdout returns what run writes to stdout.
+func captureStdout(t *testing.T, run func() error) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		out, _ := ioutil.ReadAll(r)
+		done <- out
+	}()
+	err = run()
+	os.Stdout = stdout
+	w.Close()
+	return string(<-done), err
+}
+
+func TestSignVerifyRequest(t *testing.T) {
+	dir := t.TempDir()
+	body := writeFile(t, dir, "body.json", "{\"request_type\": \"keygen\",\n \"callback_id\": \"c1\"}")
+	reordered := writeFile(t, dir, "reordered.json", `{"callback_id":"c1","request_type":"keygen"}`)
+	keys := map[string][2]string{}
+	for _, keyType := range []string{keyTypeP256, keyTypeSecp256k1, keyTypeEd25519} {
+		private, public := generateKeypair(t, dir, keyType)
+		keys[keyType] = [2]string{private, public}
+	}
+
+	for _, format := range []string{"hex", "jws", "jws-detached"} {
+		for _, canonical := range []bool{false, true} {
+			for keyType, key := range keys {
+				if format == "hex" && keyType == keyTypeEd25519 {
+					continue
+				}
+				name := fmt.Sprintf("%s canonical=%v %s", format, canonical, keyType)
+				flags := []string{"-signature-format", format, "-key-id", "k1", fmt.Sprintf("-canonical-json=%v", canonical)}
+				out, err := captureStdout(t, func() error {
+					return runSign(append([]string{"-key", key[0], "-in", body}, flags...))
+				})
+				if err != nil {
+					t.Fatalf("%s: sign: %v", name, err)
+				}
+				signature := strings.TrimSpace(out)
+
+				verify := func(in string) error {
+					_, err := captureStdout(t, func() error {
+						return runVerifyRequest(append([]string{"-key", key[1], "-in", in, "-signature", signature}, flags...))
+					})
+					return err
+				}
+				if err = verify(body); err != nil {
+					t.Errorf("%s: verify: %v", name, err)
+				}
+				// only the canonical form is independent of key order and
+				// whitespace
+				if err = verify(reordered); (err == nil) != canonical {
+					t.Errorf("%s: verify reordered body: %v", name, err)
+				}
+			}
+		}
+	}
+
+	_, other := generateKeypair(t, t.TempDir(), keyTypeP256)
+	signature, _ := captureStdout(t, func() error { return runSign([]string{"-key", keys[keyTypeP256][0], "-in", body}) })
+	if err := runVerifyRequest([]string{"-key", other, "-in", body, "-signature", strings.TrimSpace(signature)}); err == nil {
+		t.Error("verified with another key")
+	}
+}
+
+func TestVerifyResponse(t *testing.T) {
+	dir := t.TempDir()
+	private, public := generateKeypair(t, dir, keyTypeP256)
+	key, err := readPrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := &service.Response{
+		Status: service.StatusSuccess,
+		Data:   &service.ResponseData{CallbackId: "c1", Action: service.Reject},
+	}
+	payload, err := service.ResponsePayload(response, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Signature, err = service.SignPayload(service.SignatureFormatHex, "", key, payload); err != nil {
+		t.Fatal(err)
+	}
+	signed, _ := json.Marshal(response)
+	if _, err = captureStdout(t, func() error {
+		return runVerifyResponse([]string{"-key", public, "-in", writeFile(t, dir, "response.json", string(signed))})
+	}); err != nil {
+		t.Error(err)
+	}
+	response.Data.Action = service.Approve
+	tampered, _ := json.Marshal(response)
+	if err = runVerifyResponse([]string{"-key", public, "-in", writeFile(t, dir, "tampered.json", string(tampered))}); err == nil {
+		t.Error("verified a tampered response")
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	plain := "5c1f6bcd2e8a9e7b3a16f0a1e4f7c9d2b8e6a3f1c0d9e8b7a6f5e4d3c2b1a0f9"
+	in := writeFile(t, dir, "plain.hex", plain)
+	for _, keyType := range []string{keyTypeSecp256k1, keyTypeP256, keyTypeX25519} {
+		private, public := generateKeypair(t, dir, keyType)
+		for _, scheme := range []string{"legacy", "aes-256-gcm", "chacha20-poly1305"} {
+			for _, compressed := range []bool{false, true} {
+				name := fmt.Sprintf("%s %s compressed=%v", keyType, scheme, compressed)
+				ct, err := captureStdout(t, func() error {
+					return runEncrypt([]string{"-key", public, "-in", in, "-scheme", scheme, fmt.Sprintf("-compressed=%v", compressed)})
+				})
+				if err != nil {
+					t.Errorf("%s: encrypt: %v", name, err)
+					continue
+				}
+				ct = strings.TrimSpace(ct)
+				out, err := captureStdout(t, func() error {
+					return runDecrypt([]string{"-key", private, "-in", writeFile(t, dir, "ct.hex", ct)})
+				})
+				if err != nil || strings.TrimSpace(out) != plain {
+					t.Errorf("%s: decrypt: got %q, %v", name, out, err)
+				}
+
+				// a captured rawdata_signature request body
+				request := writeFile(t, dir, "request.json", `{"callback_id":"c1","request_type":"rawdata","request_detail":{"signature":"`+ct+`"}}`)
+				out, err = captureStdout(t, func() error {
+					return runDecrypt([]string{"-key", private, "-in", request})
+				})
+				if err != nil || strings.TrimSpace(out) != plain {
+					t.Errorf("%s: decrypt request: got %q, %v", name, out, err)
+				}
+			}
+		}
+	}
+}
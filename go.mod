@@ -1,6 +1,6 @@
 module github.com/sinohope/mpc-node-callback-demo
 
-go 1.19
+go 1.20
 
 require (
 	github.com/btcsuite/btcd/btcec/v2 v2.3.2
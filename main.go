@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/sinohope/mpc-node-callback-demo/service"
 )
@@ -14,9 +19,51 @@ var (
 	decryptSignaturePath = flag.String("sig-private-path", "./decrypt_sig_pirvate.pem", "decrypt signature private key path")
 	mpcNodePublicKeyPath = flag.String("mpc-node-public-key-path", "./mpc_node_public.pem", "mpc-node public key path")
 	random               = flag.Bool("random", false, "Random reject sign request")
+	canonicalJSON        = flag.Bool("canonical-json", false, "sign and verify RFC 8785 canonical JSON")
+	signatureFormat      = flag.String("signature-format", "hex", "request and response signature format: hex, jws or jws-detached")
+	keyID                = flag.String("key-id", "", "key id put in the JWS header of responses")
+	mpcNodeKeyID         = flag.String("mpc-node-key-id", "", "key id expected in the JWS header of requests")
+	policyPath           = flag.String("policy", "", "policy file, approve (or random reject) everything if empty")
+	shadowPolicyPath     = flag.String("shadow-policy", "", "policy file evaluated alongside -policy, only logged and counted")
+	auditLogPath         = flag.String("audit-log", "", "audit log file, disabled if empty")
+	auditLogPublicKey    = flag.String("audit-log-public-key", "", "ECDSA or X25519 public key PEM file to encrypt the audit log for")
+	addressBookPath      = flag.String("address-book", "", "address book file with the allowlists and denylists")
+	bitcoinNetwork       = flag.String("bitcoin-network", "mainnet", "network of the bitcoin addresses: mainnet, testnet, signet or regtest")
+	adminToken           = flag.String("admin-token", "", "bearer token of the /admin API, disabled if empty")
+	adminAddress         = flag.String("admin-address", "", "address of the /admin API, required with -admin-token")
+	keygenRegistryPath   = flag.String("keygen-registry", "", "file recording every approved keygen")
+	keyRegistryPath      = flag.String("key-registry", "", "file keeping the registered root public keys")
+	responseEncryption   = flag.String("encrypt-response", "", "encrypt responses to the mpc-node key: data, or a comma separated list of data fields")
+	responseScheme       = flag.String("response-ecies-scheme", "legacy", "ecies scheme of encrypted responses: legacy, aes-256-gcm or chacha20-poly1305")
+	responseReasons      = flag.String("response-reasons", "none", "explain REJECT and WAIT responses: none, code (rule id and reason code) or full (with the reason message)")
+	limitStatePath       = flag.String("limit-state", "", "file keeping the policy limit windows across restarts")
 )
 
+// shutdownTimeout bounds how long pending requests are waited for on
+// SIGINT or SIGTERM.
+const shutdownTimeout = 10 * time.Second
+
+// commands are run as "<binary> <command> [args]" instead of the server.
+var commands = map[string]func(args []string) error{
+	"keys":            runKeys,
+	"sign":            runSign,
+	"verify-request":  runVerifyRequest,
+	"verify-response": runVerifyResponse,
+	"encrypt":         runEncrypt,
+	"decrypt":         runDecrypt,
+	"replay":          runReplay,
+	"address-book":    runAddressBook,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
 	flag.Parse()
 
 	if *version {
@@ -24,15 +71,50 @@ func main() {
 	}
 
 	cfg := &service.CallbackServiceConfig{
-		Address:              *address,
-		PrivateKeyPath:       *path,
-		DecryptSigKeyPath:    *decryptSignaturePath,
-		MPCNodePublicKeyPath: *mpcNodePublicKeyPath,
-		RandomReject:         *random,
+		Address:                  *address,
+		PrivateKeyPath:           *path,
+		DecryptSigKeyPath:        *decryptSignaturePath,
+		MPCNodePublicKeyPath:     *mpcNodePublicKeyPath,
+		RandomReject:             *random,
+		CanonicalJSON:            *canonicalJSON,
+		SignatureFormat:          *signatureFormat,
+		KeyID:                    *keyID,
+		MPCNodeKeyID:             *mpcNodeKeyID,
+		PolicyPath:               *policyPath,
+		ShadowPolicyPath:         *shadowPolicyPath,
+		AuditLogPath:             *auditLogPath,
+		AuditLogPublicKeyPath:    *auditLogPublicKey,
+		LimitStatePath:           *limitStatePath,
+		AddressBookPath:          *addressBookPath,
+		BitcoinNetwork:           *bitcoinNetwork,
+		AdminToken:               *adminToken,
+		AdminAddress:             *adminAddress,
+		KeygenRegistryPath:       *keygenRegistryPath,
+		KeyRegistryPath:          *keyRegistryPath,
+		ResponseEncryption:       *responseEncryption,
+		ResponseEncryptionScheme: *responseScheme,
+		ResponseReasons:          *responseReasons,
 	}
-	if s, err := service.NewCallBackService(cfg); err != nil {
+	s, err := service.NewCallBackService(cfg)
+	if err != nil {
 		log.Fatal(err)
-	} else if err = s.Start(); err != nil {
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Start()
+	}()
+	select {
+	case err = <-served:
+		s.Stop()
 		log.Fatal(err)
+	case sig := <-signals:
+		log.Printf("received %v, shutting down", sig)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err = s.Shutdown(ctx); err != nil {
+		log.Fatalf("shutdown failed, %v", err)
 	}
 }
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	ChainBitcoin  = "bitcoin"
+	ChainEthereum = "ethereum"
+	ChainTron     = "tron"
+)
+
+// chainAliases maps ticker style chain names to the canonical name.
+var chainAliases = map[string]string{
+	"btc": ChainBitcoin,
+	"xbt": ChainBitcoin,
+	"eth": ChainEthereum,
+	"trx": ChainTron,
+}
+
+// evmChains use 20 byte hex addresses with an optional EIP-55 checksum.
+var evmChains = map[string]bool{
+	ChainEthereum: true,
+	"evm":         true,
+	"bsc":         true,
+	"polygon":     true,
+	"arbitrum":    true,
+	"optimism":    true,
+	"avalanche":   true,
+	"base":        true,
+}
+
+// BitcoinNetwork holds the address prefixes of a bitcoin network.
+type BitcoinNetwork struct {
+	Name string
+	// HRP is the human readable part of segwit addresses.
+	HRP string
+	// PubKeyHash and ScriptHash are the base58check versions of P2PKH and
+	// P2SH addresses.
+	PubKeyHash byte
+	ScriptHash byte
+}
+
+var (
+	BitcoinMainnet = &BitcoinNetwork{Name: "mainnet", HRP: "bc", PubKeyHash: 0x00, ScriptHash: 0x05}
+	BitcoinTestnet = &BitcoinNetwork{Name: "testnet", HRP: "tb", PubKeyHash: 0x6f, ScriptHash: 0xc4}
+	BitcoinRegtest = &BitcoinNetwork{Name: "regtest", HRP: "bcrt", PubKeyHash: 0x6f, ScriptHash: 0xc4}
+)
+
+// BitcoinNetworkByName returns the network called name, mainnet when name
+// is empty. Signet uses the testnet addresses.
+func BitcoinNetworkByName(name string) (*BitcoinNetwork, error) {
+	switch strings.ToLower(name) {
+	case "", "mainnet":
+		return BitcoinMainnet, nil
+	case "testnet", "signet":
+		return BitcoinTestnet, nil
+	case "regtest":
+		return BitcoinRegtest, nil
+	}
+	return nil, fmt.Errorf("unknown bitcoin network %q", name)
+}
+
+// NormalizeChain lower cases chain and resolves ticker aliases.
+func NormalizeChain(chain string) string {
+	chain = strings.ToLower(strings.TrimSpace(chain))
+	if alias, ok := chainAliases[chain]; ok {
+		return alias
+	}
+	return chain
+}
+
+// NormalizeAddress validates address for chain and returns the form used
+// as address book key: lower case for hex and bech32 addresses, unchanged
+// for base58 ones. Bitcoin addresses must be of the bitcoin network,
+// mainnet when nil. Addresses of chains without a known format are only
+// checked to be non-empty and free of spaces.
+func NormalizeAddress(chain, address string, bitcoin *BitcoinNetwork) (string, error) {
+	chain = NormalizeChain(chain)
+	address = strings.TrimSpace(address)
+	if address == "" || strings.ContainsAny(address, " \t\r\n") {
+		return "", fmt.Errorf("invalid %s address %q", chain, address)
+	}
+	switch {
+	case evmChains[chain]:
+		return normalizeEVMAddress(address)
+	case chain == ChainBitcoin:
+		if bitcoin == nil {
+			bitcoin = BitcoinMainnet
+		}
+		return normalizeBitcoinAddress(address, bitcoin)
+	case chain == ChainTron:
+		version, payload, err := base58CheckDecode(address)
+		if err != nil || version != 0x41 || len(payload) != 20 {
+			return "", fmt.Errorf("invalid tron address %q", address)
+		}
+		return address, nil
+	}
+	return address, nil
+}
+
+func normalizeEVMAddress(address string) (string, error) {
+	if len(address) != 42 || !strings.HasPrefix(address, "0x") {
+		return "", fmt.Errorf("invalid evm address %q", address)
+	}
+	if _, err := hex.DecodeString(address[2:]); err != nil {
+		return "", fmt.Errorf("invalid evm address %q", address)
+	}
+	lower := strings.ToLower(address)
+	// all lower or all upper case addresses carry no checksum
+	if address[2:] != lower[2:] && address[2:] != strings.ToUpper(address[2:]) {
+		if address != EIP55Checksum(lower) {
+			return "", fmt.Errorf("evm address %q has a bad EIP-55 checksum", address)
+		}
+	}
+	return lower, nil
+}
+
+// EIP55Checksum returns the mixed case checksum form of a hex address.
+func EIP55Checksum(address string) string {
+	lower := strings.ToLower(strings.TrimPrefix(address, "0x"))
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(lower))
+	digest := h.Sum(nil)
+	out := []byte(lower)
+	for i, c := range out {
+		nibble := digest[i/2]
+		if i%2 == 0 {
+			nibble >>= 4
+		}
+		if c >= 'a' && c <= 'f' && nibble&0xf >= 8 {
+			out[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(out)
+}
+
+func normalizeBitcoinAddress(address string, network *BitcoinNetwork) (string, error) {
+	if strings.HasPrefix(strings.ToLower(address), network.HRP+"1") {
+		if _, _, err := segwitDecode(network.HRP, address); err != nil {
+			return "", fmt.Errorf("invalid bitcoin %s address %q, %v", network.Name, address, err)
+		}
+		return strings.ToLower(address), nil
+	}
+	version, payload, err := base58CheckDecode(address)
+	if err != nil || (version != network.PubKeyHash && version != network.ScriptHash) || len(payload) != 20 {
+		return "", fmt.Errorf("invalid bitcoin %s address %q", network.Name, address)
+	}
+	return address, nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58CheckDecode decodes a base58check string into its version byte and
+// payload.
+func base58CheckDecode(s string) (byte, []byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		i := strings.IndexRune(base58Alphabet, c)
+		if i < 0 {
+			return 0, nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+	decoded := n.Bytes()
+	for i := 0; i < len(s) && s[i] == '1'; i++ {
+		decoded = append([]byte{0}, decoded...)
+	}
+	if len(decoded) < 5 {
+		return 0, nil, fmt.Errorf("base58check string too short")
+	}
+	data, checksum := decoded[:len(decoded)-4], decoded[len(decoded)-4:]
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], checksum) {
+		return 0, nil, fmt.Errorf("bad base58check checksum")
+	}
+	return data[0], data[1:], nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for _, c := range hrp {
+		out = append(out, byte(c>>5))
+	}
+	out = append(out, 0)
+	for _, c := range hrp {
+		out = append(out, byte(c&31))
+	}
+	return out
+}
+
+// bech32Decode decodes a bech32 or bech32m string, returning the 5 bit data
+// without checksum and the checksum constant it verified against.
+func bech32Decode(s string) (string, []byte, uint32, error) {
+	if len(s) > 90 {
+		return "", nil, 0, fmt.Errorf("bech32 string too long")
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, 0, fmt.Errorf("bech32 string has mixed case")
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, 0, fmt.Errorf("invalid bech32 separator position")
+	}
+	hrp := s[:pos]
+	data := make([]byte, 0, len(s)-pos-1)
+	for _, c := range s[pos+1:] {
+		i := strings.IndexRune(bech32Charset, c)
+		if i < 0 {
+			return "", nil, 0, fmt.Errorf("invalid bech32 character %q", c)
+		}
+		data = append(data, byte(i))
+	}
+	constant := bech32Polymod(append(bech32HRPExpand(hrp), data...))
+	if constant != bech32Const && constant != bech32mConst {
+		return "", nil, 0, fmt.Errorf("bad bech32 checksum")
+	}
+	return hrp, data[:len(data)-6], constant, nil
+}
+
+// segwitDecode decodes a BIP-173/BIP-350 segwit address for hrp.
+func segwitDecode(hrp, address string) (byte, []byte, error) {
+	gotHRP, data, constant, err := bech32Decode(address)
+	if err != nil {
+		return 0, nil, err
+	}
+	if gotHRP != hrp {
+		return 0, nil, fmt.Errorf("unexpected human readable part %q", gotHRP)
+	}
+	if len(data) < 1 || data[0] > 16 {
+		return 0, nil, fmt.Errorf("invalid witness version")
+	}
+	version := data[0]
+	if (version == 0) != (constant == bech32Const) {
+		return 0, nil, fmt.Errorf("witness version %d uses the wrong checksum", version)
+	}
+	program, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(program) < 2 || len(program) > 40 || (version == 0 && len(program) != 20 && len(program) != 32) {
+		return 0, nil, fmt.Errorf("invalid witness program length %d", len(program))
+	}
+	return version, program, nil
+}
+
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	acc, bits := uint32(0), uint(0)
+	maxv := uint32(1)<<to - 1
+	var out []byte
+	for _, v := range data {
+		acc = acc<<from | uint32(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return out, nil
+}
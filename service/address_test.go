@@ -0,0 +1,71 @@
+package service
+
+import "testing"
+
+func TestNormalizeAddress(t *testing.T) {
+	valid := []struct {
+		chain, address, want string
+		bitcoin              *BitcoinNetwork
+	}{
+		{"eth", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", nil},
+		{"bsc", "0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359", "0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359", nil},
+		{"ethereum", "0xDBF03B407C01E7CD3CBEA99509D93F8DDDC8C6FB", "0xdbf03b407c01e7cd3cbea99509d93f8dddc8c6fb", nil},
+		{"btc", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", nil},
+		{"bitcoin", "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", nil},
+		{"bitcoin", "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", nil},
+		{"bitcoin", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", nil},
+		{"tron", "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", nil},
+		{"solana", "9WzDXwBbmkg8ZTbNMqUxvQRAyrZzDsGYdLVL9zYtAWWM", "9WzDXwBbmkg8ZTbNMqUxvQRAyrZzDsGYdLVL9zYtAWWM", nil},
+		{"bitcoin", "TB1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KXPJZSX", "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", BitcoinTestnet},
+		{"bitcoin", "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", BitcoinTestnet},
+	}
+	for _, tt := range valid {
+		got, err := NormalizeAddress(tt.chain, tt.address, tt.bitcoin)
+		if err != nil {
+			t.Errorf("%s %s: %v", tt.chain, tt.address, err)
+		} else if got != tt.want {
+			t.Errorf("%s %s: got %s, want %s", tt.chain, tt.address, got, tt.want)
+		}
+	}
+
+	invalid := []struct {
+		chain, address string
+		bitcoin        *BitcoinNetwork
+	}{
+		// bad EIP-55 checksum
+		{"eth", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", nil},
+		{"eth", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1bea", nil},
+		{"eth", "5aaeb6053f3e94c9b9a09f33669435e7ef1beaed00", nil},
+		{"bitcoin", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN3", nil},
+		{"bitcoin", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5", nil},
+		// witness v1 with a bech32 instead of a bech32m checksum
+		{"bitcoin", "bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7k7grplx", nil},
+		{"bitcoin", "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", nil},
+		// a bitcoin address is not a tron address
+		{"tron", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", nil},
+		// mainnet addresses on testnet
+		{"bitcoin", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", BitcoinTestnet},
+		{"bitcoin", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", BitcoinTestnet},
+		{"bitcoin", "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", nil},
+		{"solana", "has space", nil},
+		{"solana", "", nil},
+	}
+	for _, tt := range invalid {
+		if _, err := NormalizeAddress(tt.chain, tt.address, tt.bitcoin); err == nil {
+			t.Errorf("%s %s accepted", tt.chain, tt.address)
+		}
+	}
+}
+
+func TestEIP55Checksum(t *testing.T) {
+	for _, address := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		if got := EIP55Checksum(address); got != address {
+			t.Errorf("got %s, want %s", got, address)
+		}
+	}
+}
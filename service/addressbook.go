@@ -0,0 +1,188 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	AddressListAllow = "allow"
+	AddressListDeny  = "deny"
+	// AddressListNone is reported for addresses on neither list.
+	AddressListNone = "none"
+)
+
+// AddressEntry is an address on the allowlist or denylist of a chain.
+type AddressEntry struct {
+	Chain   string    `json:"chain"`
+	Address string    `json:"address"`
+	List    string    `json:"list"`
+	Label   string    `json:"label,omitempty"`
+	Source  string    `json:"source,omitempty"`
+	Added   time.Time `json:"added"`
+}
+
+func (e *AddressEntry) key() string {
+	return e.List + "/" + e.Chain + "/" + e.Address
+}
+
+// normalize validates e and puts its chain and address in key form.
+func (e *AddressEntry) normalize(bitcoin *BitcoinNetwork) error {
+	if e.List != AddressListAllow && e.List != AddressListDeny {
+		return fmt.Errorf("invalid address list %q", e.List)
+	}
+	e.Chain = NormalizeChain(e.Chain)
+	if e.Chain == "" {
+		return fmt.Errorf("address %s has no chain", e.Address)
+	}
+	address, err := NormalizeAddress(e.Chain, e.Address, bitcoin)
+	if err != nil {
+		return err
+	}
+	e.Address = address
+	return nil
+}
+
+type addressBookState struct {
+	Entries []*AddressEntry `json:"entries"`
+}
+
+// AddressBook holds per chain allowlists and denylists, persisted in an
+// optional FileStore. Bitcoin addresses are those of one network.
+type AddressBook struct {
+	mu      sync.RWMutex
+	entries map[string]*AddressEntry
+	store   *FileStore
+	bitcoin *BitcoinNetwork
+}
+
+// NewAddressBook returns an empty address book of the bitcoin network,
+// mainnet when nil.
+func NewAddressBook(bitcoin *BitcoinNetwork) *AddressBook {
+	if bitcoin == nil {
+		bitcoin = BitcoinMainnet
+	}
+	return &AddressBook{entries: make(map[string]*AddressEntry), bitcoin: bitcoin}
+}
+
+// OpenAddressBook loads the address book kept at path.
+func OpenAddressBook(path string, bitcoin *BitcoinNetwork) (*AddressBook, error) {
+	store, err := OpenFileStore(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &addressBookState{}
+	if err = store.Load(state); err != nil {
+		return nil, err
+	}
+	b := NewAddressBook(bitcoin)
+	for _, entry := range state.Entries {
+		if err = entry.normalize(b.bitcoin); err != nil {
+			return nil, fmt.Errorf("load address book failed, %v", err)
+		}
+		b.entries[entry.key()] = entry
+	}
+	b.store = store
+	return b, nil
+}
+
+// Add validates and adds entries, replacing the label and source of
+// entries already present, and saves the address book. Nothing is added
+// when an entry is invalid.
+func (b *AddressBook) Add(entries ...*AddressEntry) error {
+	now := time.Now().UTC()
+	for _, entry := range entries {
+		if err := entry.normalize(b.bitcoin); err != nil {
+			return err
+		}
+		if entry.Added.IsZero() {
+			entry.Added = now
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, entry := range entries {
+		b.entries[entry.key()] = entry
+	}
+	return b.save()
+}
+
+// Remove removes address from list of chain and reports whether it was
+// present.
+func (b *AddressBook) Remove(list, chain, address string) (bool, error) {
+	entry := &AddressEntry{List: list, Chain: chain, Address: address}
+	if err := entry.normalize(b.bitcoin); err != nil {
+		return false, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.entries[entry.key()]; !ok {
+		return false, nil
+	}
+	delete(b.entries, entry.key())
+	return true, b.save()
+}
+
+// Lookup returns the list address of chain is on. An address on both lists
+// is reported as denied. An address without chain or that does not
+// normalize cannot be looked up and is an error.
+func (b *AddressBook) Lookup(chain, address string) (string, error) {
+	chain = NormalizeChain(chain)
+	if chain == "" {
+		return "", fmt.Errorf("address %s has no chain", address)
+	}
+	address, err := NormalizeAddress(chain, address, b.bitcoin)
+	if err != nil {
+		return "", err
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, list := range []string{AddressListDeny, AddressListAllow} {
+		if _, ok := b.entries[list+"/"+chain+"/"+address]; ok {
+			return list, nil
+		}
+	}
+	return AddressListNone, nil
+}
+
+// Entries returns the entries of list and chain sorted by address, an
+// empty list or chain selects all of them.
+func (b *AddressBook) Entries(list, chain string) []*AddressEntry {
+	chain = NormalizeChain(chain)
+	b.mu.RLock()
+	entries := make([]*AddressEntry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		if (list == "" || entry.List == list) && (chain == "" || entry.Chain == chain) {
+			entries = append(entries, entry)
+		}
+	}
+	b.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key() < entries[j].key()
+	})
+	return entries
+}
+
+// Check reports whether the address book can still be saved.
+func (b *AddressBook) Check() error {
+	if b.store == nil {
+		return nil
+	}
+	return b.store.Check()
+}
+
+func (b *AddressBook) save() error {
+	if b.store == nil {
+		return nil
+	}
+	state := &addressBookState{Entries: make([]*AddressEntry, 0, len(b.entries))}
+	for _, entry := range b.entries {
+		state.Entries = append(state.Entries, entry)
+	}
+	sort.Slice(state.Entries, func(i, j int) bool {
+		return state.Entries[i].key() < state.Entries[j].key()
+	})
+	return b.store.Save(state)
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// AddressImport is the result of parsing an address list file. Invalid
+// holds a description of every record that was skipped.
+type AddressImport struct {
+	Entries []*AddressEntry
+	Invalid []string
+
+	bitcoin *BitcoinNetwork
+}
+
+func (a *AddressImport) add(entry *AddressEntry, where string) {
+	if err := entry.normalize(a.bitcoin); err != nil {
+		a.Invalid = append(a.Invalid, fmt.Sprintf("%s: %v", where, err))
+		return
+	}
+	a.Entries = append(a.Entries, entry)
+}
+
+// ParseAddressCSV parses CSV records of chain,address[,list[,label]]. The
+// list defaults to list, an optional first line starting with "chain" is
+// taken as header. Bitcoin addresses of another network than bitcoin are
+// skipped.
+func ParseAddressCSV(r io.Reader, list, source string, bitcoin *BitcoinNetwork) (*AddressImport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	result := &AddressImport{bitcoin: bitcoin}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse address csv failed, %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "chain") {
+			continue
+		}
+		if len(record) < 2 {
+			result.Invalid = append(result.Invalid, fmt.Sprintf("line %d: expected chain,address[,list[,label]]", line))
+			continue
+		}
+		entry := &AddressEntry{Chain: record[0], Address: record[1], List: list, Source: source}
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			entry.List = strings.ToLower(strings.TrimSpace(record[2]))
+		}
+		if len(record) > 3 {
+			entry.Label = strings.TrimSpace(record[3])
+		}
+		result.add(entry, fmt.Sprintf("line %d", line))
+	}
+}
+
+// sdnDigitalCurrencyPrefix starts the idType of the digital currency
+// addresses of an SDN entry, it is followed by the currency ticker.
+const sdnDigitalCurrencyPrefix = "Digital Currency Address - "
+
+type sdnEntry struct {
+	Uid       string `xml:"uid"`
+	FirstName string `xml:"firstName"`
+	LastName  string `xml:"lastName"`
+	Ids       []struct {
+		IdType   string `xml:"idType"`
+		IdNumber string `xml:"idNumber"`
+	} `xml:"idList>id"`
+}
+
+func (e *sdnEntry) name() string {
+	return strings.TrimSpace(e.FirstName + " " + e.LastName)
+}
+
+// ParseSDNXML extracts the digital currency addresses of an OFAC style SDN
+// XML file as denylist entries labelled with the entry name and uid.
+// Bitcoin addresses of another network than bitcoin are skipped.
+func ParseSDNXML(r io.Reader, bitcoin *BitcoinNetwork) (*AddressImport, error) {
+	decoder := xml.NewDecoder(r)
+	result := &AddressImport{bitcoin: bitcoin}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse sdn xml failed, %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "sdnEntry" {
+			continue
+		}
+		entry := &sdnEntry{}
+		if err = decoder.DecodeElement(entry, &start); err != nil {
+			return nil, fmt.Errorf("parse sdn xml failed, %v", err)
+		}
+		for _, id := range entry.Ids {
+			if !strings.HasPrefix(id.IdType, sdnDigitalCurrencyPrefix) {
+				continue
+			}
+			ticker := strings.TrimSpace(strings.TrimPrefix(id.IdType, sdnDigitalCurrencyPrefix))
+			address := strings.TrimSpace(id.IdNumber)
+			result.add(&AddressEntry{
+				Chain:   sdnChain(ticker, address),
+				Address: address,
+				List:    AddressListDeny,
+				Label:   fmt.Sprintf("%s (SDN %s)", entry.name(), entry.Uid),
+				Source:  "sdn",
+			}, fmt.Sprintf("sdn %s %s", entry.Uid, ticker))
+		}
+	}
+}
+
+// sdnChain maps the currency ticker of an SDN address to a chain. Tokens
+// issued on several chains are assigned by address format.
+func sdnChain(ticker, address string) string {
+	switch strings.ToUpper(ticker) {
+	case "USDT", "USDC":
+		if strings.HasPrefix(address, "0x") {
+			return ChainEthereum
+		}
+		if strings.HasPrefix(address, "T") {
+			return ChainTron
+		}
+	}
+	return NormalizeChain(ticker)
+}
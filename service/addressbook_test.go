@@ -0,0 +1,232 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testSDN = `<?xml version="1.0" standalone="yes"?>
+<sdnList xmlns="http://tempuri.org/sdnList.xsd">
+  <publshInformation><Publish_Date>01/01/2024</Publish_Date></publshInformation>
+  <sdnEntry>
+    <uid>100</uid>
+    <lastName>MIXER</lastName>
+    <sdnType>Entity</sdnType>
+    <idList>
+      <id><uid>1</uid><idType>Digital Currency Address - ETH</idType><idNumber>0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed</idNumber></id>
+      <id><uid>2</uid><idType>Digital Currency Address - XBT</idType><idNumber>1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2</idNumber></id>
+      <id><uid>3</uid><idType>Digital Currency Address - USDT</idType><idNumber>TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t</idNumber></id>
+      <id><uid>4</uid><idType>Digital Currency Address - ETH</idType><idNumber>0xnothex</idNumber></id>
+      <id><uid>5</uid><idType>Passport</idType><idNumber>X123</idNumber></id>
+    </idList>
+  </sdnEntry>
+  <sdnEntry>
+    <uid>101</uid>
+    <firstName>John</firstName>
+    <lastName>DOE</lastName>
+    <sdnType>Individual</sdnType>
+  </sdnEntry>
+</sdnList>`
+
+func TestParseSDNXML(t *testing.T) {
+	result, err := ParseSDNXML(strings.NewReader(testSDN), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 3 || len(result.Invalid) != 1 {
+		t.Fatalf("got %d entries and %d invalid: %v", len(result.Entries), len(result.Invalid), result.Invalid)
+	}
+	want := []string{
+		"deny/ethereum/0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed",
+		"deny/bitcoin/1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		"deny/tron/TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t",
+	}
+	for i, entry := range result.Entries {
+		if entry.key() != want[i] || entry.Label != "MIXER (SDN 100)" {
+			t.Errorf("#%d: got %s %q", i, entry.key(), entry.Label)
+		}
+	}
+}
+
+func TestParseAddressCSV(t *testing.T) {
+	csv := `chain,address,list,label
+eth,0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359,allow,treasury
+# comment
+tron,TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t
+eth,0xbad
+eth
+`
+	result, err := ParseAddressCSV(strings.NewReader(csv), AddressListDeny, "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 2 || len(result.Invalid) != 2 {
+		t.Fatalf("got %d entries and %d invalid: %v", len(result.Entries), len(result.Invalid), result.Invalid)
+	}
+	if e := result.Entries[0]; e.List != AddressListAllow || e.Label != "treasury" || e.Chain != ChainEthereum {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if e := result.Entries[1]; e.List != AddressListDeny || e.Source != "test" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+}
+
+func TestAddressBook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "address_book.json")
+	book, err := OpenAddressBook(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const address = "0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359"
+	if err = book.Add(&AddressEntry{Chain: "eth", Address: address, List: AddressListAllow}); err != nil {
+		t.Fatal(err)
+	}
+	if err = book.Add(&AddressEntry{Chain: "eth", Address: "0x0", List: AddressListAllow}); err == nil {
+		t.Error("invalid address added")
+	}
+	if list, err := book.Lookup("ethereum", "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359"); err != nil || list != AddressListAllow {
+		t.Errorf("got %s", list)
+	}
+	if list, err := book.Lookup("bsc", address); err != nil || list != AddressListNone {
+		t.Errorf("got %s on another chain", list)
+	}
+	for _, chain := range []string{"eth", ""} {
+		if _, err = book.Lookup(chain, "0xfb6916095ca1df60bb79ce92ce3ea74c37c5d35"); err == nil {
+			t.Errorf("looked up an invalid address on chain %q", chain)
+		}
+	}
+	if err = book.Add(&AddressEntry{Chain: "eth", Address: address, List: AddressListDeny}); err != nil {
+		t.Fatal(err)
+	}
+
+	book, err = OpenAddressBook(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list, err := book.Lookup("eth", address); err != nil || list != AddressListDeny {
+		t.Errorf("got %s, deny must win", list)
+	}
+	if removed, err := book.Remove(AddressListDeny, "eth", address); !removed || err != nil {
+		t.Fatalf("remove: %v %v", removed, err)
+	}
+	if list, err := book.Lookup("eth", address); err != nil || list != AddressListAllow {
+		t.Errorf("got %s after removal", list)
+	}
+	if n := len(book.Entries("", "")); n != 1 {
+		t.Errorf("got %d entries", n)
+	}
+}
+
+func TestRulePolicyDestinationLists(t *testing.T) {
+	book := NewAddressBook(nil)
+	if err := book.Add(&AddressEntry{Chain: "tron", Address: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", List: AddressListDeny}); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewRulePolicy(&PolicyConfig{
+		Rules: []*Rule{
+			{Id: "denied", Action: Reject, Match: RuleMatch{DestinationLists: []string{AddressListDeny}}},
+			{Id: "unknown", Action: Wait, Match: RuleMatch{DestinationLists: []string{AddressListNone}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy.UseAddressBook(book)
+	tests := []struct {
+		txInfo string
+		ruleId string
+		code   string
+	}{
+		{`{"chain":"trx","to":"TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"}`, "denied", ReasonDenylisted},
+		{`{"chain":"tron","to":"TJRyWwFs9wTFGZg3JbrVriFbNfCug5tDeC"}`, "unknown", ReasonRule},
+		// a sign request without destination is on the deny list
+		{``, "denied", ReasonDenylisted},
+		{`{"chain":"tron","amount":"1"}`, "denied", ReasonDenylisted},
+		{`{"to":"TJRyWwFs9wTFGZg3JbrVriFbNfCug5tDeC","amount":"x"}`, TxInfoRuleId, ReasonParseFailure},
+		// a denylisted address the address book cannot look up is rejected
+		{`{"chain":"tron","to":"TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6T"}`, TxInfoRuleId, ReasonLookupFailure},
+		{`{"to":"TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"}`, TxInfoRuleId, ReasonLookupFailure},
+	}
+	for _, tt := range tests {
+		decision, err := policy.Evaluate(signRequest("a", tt.txInfo), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decision.RuleId != tt.ruleId || decision.Code != tt.code {
+			t.Errorf("%s: got rule %s (%s), want %s (%s)", tt.txInfo, decision.RuleId, decision.Code, tt.ruleId, tt.code)
+		}
+	}
+	keygen := signRequest("a", "")
+	keygen.RequestType = RequestTypeKeygen
+	if decision, err := policy.Evaluate(keygen, time.Now()); err != nil || decision.RuleId != DefaultRuleId {
+		t.Errorf("keygen: got %+v, %v", decision, err)
+	}
+}
+
+func TestAdminAddressBook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &CallbackService{
+		cfg:     &CallbackServiceConfig{AdminToken: "secret"},
+		book:    NewAddressBook(nil),
+		signer:  &hexSigner{key: key},
+		metrics: NewMetrics(),
+	}
+	r := c.AdminRouter()
+	do := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("GET", "/admin/address-book", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: got %d", w.Code)
+	}
+	for _, authorization := range []string{"Bearer wrong", "secret", "Basic secret"} {
+		if w := do("GET", "/admin/address-book", authorization, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got %d", authorization, w.Code)
+		}
+	}
+	// the callback API does not serve the admin API
+	w := httptest.NewRecorder()
+	c.Router().ServeHTTP(w, httptest.NewRequest("GET", "/admin/address-book", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("callback router: got %d", w.Code)
+	}
+	body := `[{"chain":"eth","address":"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed","list":"deny","label":"mixer"}]`
+	if w := do("POST", "/admin/address-book", "Bearer secret", body); w.Code != http.StatusOK {
+		t.Fatalf("add: got %d %s", w.Code, w.Body)
+	}
+	if w := do("POST", "/admin/address-book", "Bearer secret", `[{"chain":"eth","address":"0x1","list":"deny"}]`); w.Code != http.StatusBadRequest {
+		t.Errorf("add invalid: got %d", w.Code)
+	}
+	w = do("GET", "/admin/address-book?list=deny", "Bearer secret", "")
+	var entries []*AddressEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || len(entries) != 1 || entries[0].Source != "admin" {
+		t.Fatalf("list: %s %v", w.Body, err)
+	}
+	path := "/admin/address-book/deny/eth/0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"
+	if w := do("DELETE", path, "Bearer secret", ""); w.Code != http.StatusNoContent {
+		t.Errorf("remove: got %d %s", w.Code, w.Body)
+	}
+	if w := do("DELETE", path, "Bearer secret", ""); w.Code != http.StatusNotFound {
+		t.Errorf("remove again: got %d", w.Code)
+	}
+}
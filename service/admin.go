@@ -0,0 +1,223 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth rejects requests without the configured admin bearer token.
+func (c *CallbackService) AdminAuth() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		header := g.GetHeader("Authorization")
+		token := strings.TrimPrefix(header, "Bearer ")
+		if token == header || c.cfg.AdminToken == "" ||
+			subtle.ConstantTimeCompare([]byte(token), []byte(c.cfg.AdminToken)) != 1 {
+			c.fail(g, ErrUnauthorized, nil)
+			return
+		}
+		g.Next()
+	}
+}
+
+func (c *CallbackService) adminRoutes(admin *gin.RouterGroup) {
+	admin.GET("/address-book", c.ListAddresses)
+	admin.POST("/address-book", c.AddAddresses)
+	admin.DELETE("/address-book/:list/:chain/:address", c.RemoveAddress)
+	admin.GET("/keygens", c.ListKeygens)
+	admin.POST("/keygens/:request_id/public-key", c.CompleteKeygen)
+	admin.GET("/keys", c.ListKeys)
+	admin.POST("/keys", c.RegisterKey)
+	admin.DELETE("/keys/:public_key", c.RemoveKey)
+}
+
+// addressBook returns the address book or fails g when none is configured.
+func (c *CallbackService) addressBook(g *gin.Context) *AddressBook {
+	if c.book == nil {
+		c.fail(g, ErrNotFound, fmt.Errorf("address book not configured"))
+	}
+	return c.book
+}
+
+// keygenRegistry returns the keygen registry or fails g when none is
+// configured.
+func (c *CallbackService) keygenRegistry(g *gin.Context) *KeygenRegistry {
+	if c.keygens == nil {
+		c.fail(g, ErrNotFound, fmt.Errorf("keygen registry not configured"))
+	}
+	return c.keygens
+}
+
+func (c *CallbackService) ListAddresses(g *gin.Context) {
+	book := c.addressBook(g)
+	if book == nil {
+		return
+	}
+	g.JSON(http.StatusOK, book.Entries(g.Query("list"), g.Query("chain")))
+}
+
+// AddAddresses adds the AddressEntry list of the request body.
+func (c *CallbackService) AddAddresses(g *gin.Context) {
+	book := c.addressBook(g)
+	if book == nil {
+		return
+	}
+	var entries []*AddressEntry
+	if err := g.ShouldBindJSON(&entries); err != nil {
+		c.fail(g, ErrMalformedBody, err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.Source == "" {
+			entry.Source = "admin"
+		}
+		if err := entry.normalize(book.bitcoin); err != nil {
+			c.fail(g, ErrMalformedBody, err)
+			return
+		}
+	}
+	if err := book.Add(entries...); err != nil {
+		c.fail(g, ErrInternal, err)
+		return
+	}
+	g.JSON(http.StatusOK, entries)
+}
+
+func (c *CallbackService) RemoveAddress(g *gin.Context) {
+	book := c.addressBook(g)
+	if book == nil {
+		return
+	}
+	entry := &AddressEntry{List: g.Param("list"), Chain: g.Param("chain"), Address: g.Param("address")}
+	if err := entry.normalize(book.bitcoin); err != nil {
+		c.fail(g, ErrMalformedBody, err)
+		return
+	}
+	removed, err := book.Remove(entry.List, entry.Chain, entry.Address)
+	if err != nil {
+		c.fail(g, ErrInternal, err)
+		return
+	}
+	if !removed {
+		c.fail(g, ErrNotFound, nil)
+		return
+	}
+	g.Status(http.StatusNoContent)
+}
+
+func (c *CallbackService) ListKeygens(g *gin.Context) {
+	registry := c.keygenRegistry(g)
+	if registry == nil {
+		return
+	}
+	g.JSON(http.StatusOK, registry.Keygens())
+}
+
+// CompleteKeygen records the public key produced by a keygen, the body is
+// {"public_key": "<hex>"}.
+func (c *CallbackService) CompleteKeygen(g *gin.Context) {
+	registry := c.keygenRegistry(g)
+	if registry == nil {
+		return
+	}
+	var body struct {
+		PublicKey string `json:"public_key"`
+		// ChainCode lets the key policy check the keys derived from a
+		// secp256k1 root key, which otherwise must match it directly.
+		ChainCode string `json:"chain_code"`
+	}
+	if err := g.ShouldBindJSON(&body); err != nil {
+		c.fail(g, ErrMalformedBody, err)
+		return
+	}
+	record, err := registry.Complete(g.Param("request_id"), body.PublicKey, body.ChainCode, c.clock.Now())
+	switch {
+	case errors.Is(err, ErrKeygenNotFound):
+		c.fail(g, ErrNotFound, err)
+	case errors.Is(err, ErrKeygenCompleted):
+		c.fail(g, ErrConflict, err)
+	case err != nil && record == nil:
+		c.fail(g, ErrMalformedBody, err)
+	case err != nil:
+		c.fail(g, ErrInternal, err)
+	default:
+		if c.keys != nil {
+			err = c.keys.Register(&RootKey{
+				PublicKey:       record.PublicKey,
+				ChainCode:       record.ChainCode,
+				Cryptography:    record.Cryptography,
+				SinoId:          record.SinoId,
+				KeygenRequestId: record.RequestId,
+			})
+			if err != nil {
+				c.fail(g, ErrInternal, fmt.Errorf("register root key failed, %v", err))
+				return
+			}
+		}
+		g.JSON(http.StatusOK, record)
+	}
+}
+
+// keyRegistry returns the key registry or fails g when none is configured.
+func (c *CallbackService) keyRegistry(g *gin.Context) *KeyRegistry {
+	if c.keys == nil {
+		c.fail(g, ErrNotFound, fmt.Errorf("key registry not configured"))
+	}
+	return c.keys
+}
+
+func (c *CallbackService) ListKeys(g *gin.Context) {
+	registry := c.keyRegistry(g)
+	if registry == nil {
+		return
+	}
+	g.JSON(http.StatusOK, registry.Keys())
+}
+
+// RegisterKey registers the RootKey of the request body, replacing the
+// key if it is already registered.
+func (c *CallbackService) RegisterKey(g *gin.Context) {
+	registry := c.keyRegistry(g)
+	if registry == nil {
+		return
+	}
+	key := &RootKey{}
+	if err := g.ShouldBindJSON(key); err != nil {
+		c.fail(g, ErrMalformedBody, err)
+		return
+	}
+	if err := key.normalize(); err != nil {
+		c.fail(g, ErrMalformedBody, err)
+		return
+	}
+	if err := registry.Register(key); err != nil {
+		c.fail(g, ErrInternal, err)
+		return
+	}
+	g.JSON(http.StatusOK, key)
+}
+
+func (c *CallbackService) RemoveKey(g *gin.Context) {
+	registry := c.keyRegistry(g)
+	if registry == nil {
+		return
+	}
+	if _, err := normalizePublicKeyHex(g.Param("public_key")); err != nil {
+		c.fail(g, ErrMalformedBody, err)
+		return
+	}
+	removed, err := registry.Remove(g.Param("public_key"))
+	if err != nil {
+		c.fail(g, ErrInternal, err)
+		return
+	}
+	if !removed {
+		c.fail(g, ErrNotFound, nil)
+		return
+	}
+	g.Status(http.StatusNoContent)
+}
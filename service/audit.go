@@ -0,0 +1,178 @@
+package service
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sinohope/mpc-node-callback-demo/service/ecies"
+)
+
+// AuditEntry is one line of the audit log: a verified callback request and
+// what the callback server answered.
+type AuditEntry struct {
+	Time      time.Time       `json:"time"`
+	Path      string          `json:"path"`
+	Signature string          `json:"signature"`
+	Request   json.RawMessage `json:"request"`
+	Response  *ResponseData   `json:"response,omitempty"`
+	RuleId    string          `json:"rule_id,omitempty"`
+	// Shadow is the decision of the shadow policy, when one is configured.
+	Shadow *Decision `json:"shadow,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// AuditLog appends AuditEntry records as JSON lines to a file. An
+// encrypted audit log appends an ECIES stream per run instead, see
+// DecryptStreams to read it.
+type AuditLog struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	stream *ecies.StreamWriter
+}
+
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log failed, %v", err)
+	}
+	return &AuditLog{path: path, file: file}, nil
+}
+
+// OpenEncryptedAuditLog opens an audit log encrypted for pub, an ECDSA or an
+// X25519 key. Every entry is flushed to the file as it is recorded, Close
+// ends the stream of this run.
+func OpenEncryptedAuditLog(path string, pub crypto.PublicKey) (*AuditLog, error) {
+	a, err := OpenAuditLog(path)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := hashFile(path)
+	if err != nil {
+		a.file.Close()
+		return nil, fmt.Errorf("read audit log failed, %v", err)
+	}
+	if a.stream, err = EncryptStream(pub, a.file, chain); err != nil {
+		a.file.Close()
+		return nil, fmt.Errorf("encrypt audit log failed, %v", err)
+	}
+	return a, nil
+}
+
+// hashFile returns the SHA-256 of the file at path.
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func (a *AuditLog) Record(entry *AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return fmt.Errorf("audit log %s is closed", a.path)
+	}
+	if a.stream == nil {
+		_, err = a.file.Write(append(line, '\n'))
+		return err
+	}
+	if _, err = a.stream.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return a.stream.Flush()
+}
+
+// Check reports whether the audit log file is still open and present.
+func (a *AuditLog) Check() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return fmt.Errorf("audit log %s is closed", a.path)
+	}
+	if _, err := os.Stat(a.path); err != nil {
+		return err
+	}
+	_, err := a.file.Stat()
+	return err
+}
+
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	var err error
+	if a.stream != nil {
+		err = a.stream.Close()
+	}
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	a.file = nil
+	return err
+}
+
+// ReadAuditLog calls fn for every entry of an audit log.
+func ReadAuditLog(r io.Reader, fn func(entry *AuditEntry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := &AuditEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return fmt.Errorf("audit log line %d: %v", line, err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// audit records the verified request of g with the given outcome. Requests
+// that did not pass signature verification are not recorded.
+func (c *CallbackService) audit(g *gin.Context, entry *AuditEntry) {
+	if c.auditLog == nil {
+		return
+	}
+	body := VerifiedBodyBytes(g)
+	if body == nil {
+		return
+	}
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Time = entry.Time.UTC()
+	entry.Path = g.Request.URL.Path
+	entry.Signature = g.GetHeader("Signature")
+	entry.Request = body
+	if err := c.auditLog.Record(entry); err != nil {
+		log.Printf("write audit log failed, %v", err)
+	}
+}
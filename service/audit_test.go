@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sinohope/mpc-node-callback-demo/service/ecies"
+)
+
+func TestEncryptedAuditLog(t *testing.T) {
+	x25519Key, _ := ParseX25519PrivateKeyPEM([]byte(testX25519PrivatePEM))
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	for _, key := range []crypto.PrivateKey{x25519Key, ecdsaKey} {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		// the first run crashed without closing its stream
+		for i, closed := range []bool{false, true} {
+			a, err := OpenEncryptedAuditLog(path, decryptKeyPublic(key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j := 0; j < 2; j++ {
+				if err = a.Record(&AuditEntry{Path: fmt.Sprintf("/%d/%d", i, j)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if closed {
+				a.Close()
+			} else {
+				a.file.Close()
+			}
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths, err := readAuditPaths(key, data)
+		var truncated *TruncatedStreamsError
+		if !errors.As(err, &truncated) || truncated.Truncated != 1 || truncated.Streams != 2 {
+			t.Errorf("%T: got %v, want 1 of 2 streams truncated", key, err)
+		}
+		if strings.Join(paths, " ") != "/0/0 /0/1 /1/0 /1/1" {
+			t.Errorf("%T: got %v", key, paths)
+		}
+	}
+}
+
+func TestTruncatedAuditLog(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := OpenEncryptedAuditLog(path, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, _ := json.Marshal(&Check{CallbackId: "c", RequestType: RequestTypeKeygen})
+	for i := 0; i < 2; i++ {
+		entry := &AuditEntry{Path: fmt.Sprintf("/%d", i), Request: request, Response: &ResponseData{Action: Approve}}
+		if err = a.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.Close()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readAuditPaths(key, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// the final segment is a length and an empty sealed segment
+	final := 4 + 16
+	cut := data[:len(data)-final]
+	paths, err := readAuditPaths(key, cut)
+	var truncated *TruncatedStreamsError
+	if !errors.As(err, &truncated) || len(paths) != 2 {
+		t.Errorf("final segment cut off: got %v, %v", paths, err)
+	}
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-final-1] ^= 1
+	for name, data := range map[string][]byte{"cut in a segment": data[:len(data)-final-1], "tampered": tampered} {
+		if _, err = readAuditPaths(key, data); err == nil {
+			t.Errorf("%s: audit log read without error", name)
+		}
+	}
+
+	policy, _ := NewRulePolicy(&PolicyConfig{DefaultAction: Approve})
+	report, err := Replay(DecryptStreams(key, bytes.NewReader(cut)), policy)
+	if !errors.As(err, &truncated) || report == nil || report.Replayed != 2 || report.TruncatedStreams != 1 {
+		t.Errorf("replay of a truncated audit log: got %+v, %v", report, err)
+	}
+}
+
+func TestShutdownClosesAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	auditKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	auditPath := filepath.Join(dir, "audit.log")
+	s := newTestService(t, &CallbackServiceConfig{
+		Address:               "127.0.0.1:0",
+		AuditLogPath:          auditPath,
+		AuditLogPublicKeyPath: writeTestKey(t, dir, "audit_public.pem", &auditKey.PublicKey),
+	})
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Start()
+	}()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// the first stream is chained to the empty file
+	chain := sha256.Sum256(nil)
+	stream, err := ecies.ImportECDSA(auditKey).DecryptStream(bufio.NewReader(f), nil, chain[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadAll(stream); err != nil {
+		t.Errorf("audit log stream is not closed, %v", err)
+	}
+}
+
+// writeAuditRuns appends a stream per run to the encrypted audit log at
+// path, each with an entry per path, and returns where every stream starts.
+func writeAuditRuns(t *testing.T, path string, pub crypto.PublicKey, runs ...[]string) []int {
+	var starts []int
+	for _, paths := range runs {
+		start := 0
+		if info, err := os.Stat(path); err == nil {
+			start = int(info.Size())
+		}
+		starts = append(starts, start)
+		a, err := OpenEncryptedAuditLog(path, pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range paths {
+			if err = a.Record(&AuditEntry{Path: p}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = a.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return starts
+}
+
+func TestAuditLogStreamChain(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	dir := t.TempDir()
+
+	// the first run crashed while writing its second entry, the cut off
+	// segment is followed by the stream of the next run
+	path := filepath.Join(dir, "crashed.log")
+	writeAuditRuns(t, path, &key.PublicKey, []string{"/0/0", "/0/1"})
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the final segment is a length and an empty sealed segment
+	if err = ioutil.WriteFile(path, data[:len(data)-4-16-10], 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeAuditRuns(t, path, &key.PublicKey, []string{"/1/0"})
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := readAuditPaths(key, data)
+	var truncated *TruncatedStreamsError
+	if !errors.As(err, &truncated) || truncated.Truncated != 1 || truncated.Streams != 2 {
+		t.Errorf("crashed run: got %v, want 1 of 2 streams truncated", err)
+	}
+	if strings.Join(paths, " ") != "/0/0 /1/0" {
+		t.Errorf("crashed run: got %v", paths)
+	}
+
+	path = filepath.Join(dir, "audit.log")
+	starts := writeAuditRuns(t, path, &key.PublicKey, []string{"/0"}, []string{"/1"}, []string{"/2"})
+	if data, err = ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if paths, err = readAuditPaths(key, data); err != nil || strings.Join(paths, " ") != "/0 /1 /2" {
+		t.Fatalf("got %v, %v", paths, err)
+	}
+	first, second, third := data[:starts[1]], data[starts[1]:starts[2]], data[starts[2]:]
+	for name, tampered := range map[string][]byte{
+		"first removed":  bytes.Join([][]byte{second, third}, nil),
+		"second removed": bytes.Join([][]byte{first, third}, nil),
+		"reordered":      bytes.Join([][]byte{first, third, second}, nil),
+	} {
+		if paths, err = readAuditPaths(key, tampered); err == nil {
+			t.Errorf("%s: got %v without error", name, paths)
+		}
+	}
+}
+
+// readAuditPaths returns the paths of the entries of an encrypted audit
+// log.
+func readAuditPaths(key crypto.PrivateKey, data []byte) ([]string, error) {
+	var paths []string
+	err := ReadAuditLog(DecryptStreams(key, bytes.NewReader(data)), func(entry *AuditEntry) error {
+		paths = append(paths, entry.Path)
+		return nil
+	})
+	return paths, err
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"golang.org/x/crypto/sha3"
+)
+
+// extendedKeyLength is the length of a serialized BIP-32 extended key,
+// without the base58check checksum.
+const extendedKeyLength = 78
+
+// ParseExtendedPublicKey decodes a base58check BIP-32 extended public key
+// (xpub, tpub, ...) into its public key and chain code.
+func ParseExtendedPublicKey(xpub string) (*btcec.PublicKey, []byte, error) {
+	version, payload, err := base58CheckDecode(xpub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid extended public key, %v", err)
+	}
+	data := append([]byte{version}, payload...)
+	if len(data) != extendedKeyLength {
+		return nil, nil, fmt.Errorf("invalid extended public key length %d", len(data))
+	}
+	chainCode, key := data[13:45], data[45:]
+	if key[0] != 0x02 && key[0] != 0x03 {
+		return nil, nil, fmt.Errorf("extended key is not a public key")
+	}
+	pub, err := btcec.ParsePubKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid extended public key, %v", err)
+	}
+	return pub, chainCode, nil
+}
+
+// DeriveChildPublicKey derives the non-hardened child index of a BIP-32
+// public key and returns the child key and chain code.
+func DeriveChildPublicKey(pub *btcec.PublicKey, chainCode []byte, index uint32) (*btcec.PublicKey, []byte, error) {
+	if index >= HardenedKeyStart {
+		return nil, nil, fmt.Errorf("hardened child %d cannot be derived from a public key", index-HardenedKeyStart)
+	}
+	data := make([]byte, 0, 37)
+	data = append(data, pub.SerializeCompressed()...)
+	data = binary.BigEndian.AppendUint32(data, index)
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	var tweak btcec.ModNScalar
+	if overflow := tweak.SetByteSlice(sum[:32]); overflow {
+		return nil, nil, fmt.Errorf("invalid child %d", index)
+	}
+	var parent, point, child btcec.JacobianPoint
+	pub.AsJacobian(&parent)
+	btcec.ScalarBaseMultNonConst(&tweak, &point)
+	btcec.AddNonConst(&point, &parent, &child)
+	if (child.X.IsZero() && child.Y.IsZero()) || child.Z.IsZero() {
+		return nil, nil, fmt.Errorf("invalid child %d", index)
+	}
+	child.ToAffine()
+	return btcec.NewPublicKey(&child.X, &child.Y), sum[32:], nil
+}
+
+// DerivePublicKey derives pub along a non-hardened BIP-32 path.
+func DerivePublicKey(pub *btcec.PublicKey, chainCode []byte, path []uint32) (*btcec.PublicKey, error) {
+	var err error
+	for _, index := range path {
+		if pub, chainCode, err = DeriveChildPublicKey(pub, chainCode, index); err != nil {
+			return nil, err
+		}
+	}
+	return pub, nil
+}
+
+// EVMAddress returns the lower case address of an EVM account key.
+func EVMAddress(pub *btcec.PublicKey) string {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(pub.SerializeUncompressed()[1:])
+	return "0x" + hex.EncodeToString(h.Sum(nil)[12:])
+}
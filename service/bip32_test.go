@@ -0,0 +1,60 @@
+package service
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// extended public keys of BIP-32 test vector 1
+const (
+	testXpub0H      = "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"
+	testXpub0H1     = "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"
+	testXpub0H12H   = "xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5"
+	testXpub0H12H2G = "xpub6H1LXWLaKsWFhvm6RVpEL9P4KfRZSW7abD2ttkWP3SSQvnyA8FSVqNTEcYFgJS2UaFcxupHiYkro49S8yGasTvXEYBVPamhGW6cFJodrTHy"
+)
+
+func TestDerivePublicKey(t *testing.T) {
+	tests := []struct {
+		parent, child string
+		path          []uint32
+	}{
+		{testXpub0H, testXpub0H1, []uint32{1}},
+		{testXpub0H12H, testXpub0H12H2G, []uint32{2, 1000000000}},
+	}
+	for _, tt := range tests {
+		pub, chainCode, err := ParseExtendedPublicKey(tt.parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _, err := ParseExtendedPublicKey(tt.child)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := DerivePublicKey(pub, chainCode, tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.IsEqual(want) {
+			t.Errorf("derive %v: got %x", tt.path, got.SerializeCompressed())
+		}
+	}
+	pub, chainCode, _ := ParseExtendedPublicKey(testXpub0H)
+	if _, err := DerivePublicKey(pub, chainCode, []uint32{HardenedKeyStart}); err == nil {
+		t.Error("hardened child derived from a public key")
+	}
+	if _, _, err := ParseExtendedPublicKey(testXpub0H[:len(testXpub0H)-1] + "x"); err == nil {
+		t.Error("bad checksum accepted")
+	}
+}
+
+func TestEVMAddress(t *testing.T) {
+	// the key of private key 1
+	key, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	root := &RootKey{PublicKey: hex.EncodeToString(key)}
+	if err := root.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if got := EVMAddress(root.pub); got != "0x7e5f4552091a69125d5dfcb7b8c2659029395bdf" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -1,15 +1,14 @@
 package service
 
 import (
+	"context"
+	"crypto"
 	"crypto/ecdsa"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"math/rand"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,84 +19,310 @@ type CallbackServiceConfig struct {
 	DecryptSigKeyPath    string
 	MPCNodePublicKeyPath string
 	RandomReject         bool
+	// CanonicalJSON signs responses and verifies requests over the RFC 8785
+	// canonical form of the JSON instead of the bytes as sent.
+	CanonicalJSON bool
+	// SignatureFormat is one of SignatureFormatHex (default),
+	// SignatureFormatJWS or SignatureFormatJWSDetached and applies to both
+	// the request Signature header and Response.Signature.
+	SignatureFormat string
+	// KeyID is put in the JWS header of responses.
+	KeyID string
+	// MPCNodeKeyID, when set, must match the JWS header of requests.
+	MPCNodeKeyID string
+	// PolicyPath is a JSON PolicyConfig. Without it every request is
+	// approved, or randomly rejected when RandomReject is set.
+	PolicyPath string
+	// ShadowPolicyPath is a JSON PolicyConfig evaluated next to the active
+	// policy. Its decisions are only logged, audited and counted.
+	ShadowPolicyPath string
+	// AuditLogPath, when set, receives a JSON line per verified request.
+	AuditLogPath string
+	// AuditLogPublicKeyPath, when set, is the ECDSA or X25519 public key
+	// the audit log is stream encrypted for.
+	AuditLogPublicKeyPath string
+	// ResponseEncryption, when set, ECIES encrypts responses to the
+	// mpc-node public key: "data" for the whole ResponseData, or a comma
+	// separated list of ResponseData JSON fields. ResponseEncryptionScheme
+	// names the ecies parameters, legacy if empty.
+	ResponseEncryption       string
+	ResponseEncryptionScheme string
+	// ResponseReasons is how much of the decision explains a REJECT or
+	// WAIT response: ResponseReasonsNone (default), ResponseReasonsCode for
+	// the rule id and reason code, or ResponseReasonsFull to add the reason
+	// message, which may name addresses and keys.
+	ResponseReasons string
+	// LimitStatePath keeps the sliding windows of the policy limits across
+	// restarts. Without it the windows start empty on every start.
+	LimitStatePath string
+	// AddressBookPath keeps the address allowlists and denylists looked up
+	// by the destination_lists of the policy.
+	AddressBookPath string
+	// BitcoinNetwork is the network of the bitcoin addresses: mainnet
+	// (default), testnet, signet or regtest.
+	BitcoinNetwork string
+	// AdminToken enables the /admin API for bearer requests carrying it.
+	AdminToken string
+	// AdminAddress is where the /admin API listens, apart from the
+	// callback API. It is required with AdminToken.
+	AdminAddress string
+	// KeygenRegistryPath, when set, records every approved keygen.
+	KeygenRegistryPath string
+	// KeyRegistryPath keeps the root keys looked up by the keys policy.
+	// Public keys reported for recorded keygens are registered in it.
+	KeyRegistryPath string
 }
 
 type CallbackService struct {
-	cfg              *CallbackServiceConfig
+	cfg *CallbackServiceConfig
+	// PrivateKey, PublicKey and MPCNodePublicKey are nil when the
+	// corresponding key is not an ECDSA key (JWS with EdDSA).
 	PrivateKey       *ecdsa.PrivateKey
 	PublicKey        *ecdsa.PublicKey
-	DecryptSigKey    *ecdsa.PrivateKey
+	DecryptSigKey    crypto.PrivateKey // *ecdsa.PrivateKey or ecies.X25519PrivateKey
 	MPCNodePublicKey *ecdsa.PublicKey
 	RandomReject     bool
+
+	signingKey crypto.Signer
+	mpcNodeKey crypto.PublicKey
+	signer     responseSigner
+	verifier   requestVerifier
+	policy     Policy
+	shadow     Policy
+	auditLog   *AuditLog
+	limitState *FileStore
+	book       *AddressBook
+	keygens    *KeygenRegistry
+	keys       *KeyRegistry
+	encryption *responseEncryption
+	metrics    *Metrics
+	clock      Clock
+	readiness  readiness
+	server     *http.Server
+	admin      *http.Server
 }
 
 func NewCallBackService(cfg *CallbackServiceConfig) (*CallbackService, error) {
-	tssNodePublicKey, err := loadTSSNodePublicKey(cfg.MPCNodePublicKeyPath)
+	mpcNodeKey, err := loadPublicKey(cfg.MPCNodePublicKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("load mpc-node public key failed, %v", err)
 	}
-	private, public, err := loadKeypair(cfg.PrivateKeyPath)
+	verifier, err := newRequestVerifier(cfg.SignatureFormat, cfg.MPCNodeKeyID, mpcNodeKey)
+	if err != nil {
+		return nil, fmt.Errorf("load mpc-node public key failed, %v", err)
+	}
+	signingKey, err := loadPrivateKey(cfg.PrivateKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("load callback server keypair failed, %v", err)
 	}
-
-	privateSigKey, _, err := loadKeypair(cfg.DecryptSigKeyPath)
+	signer, err := newResponseSigner(cfg.SignatureFormat, cfg.KeyID, signingKey)
 	if err != nil {
-		// return nil, fmt.Errorf("load decrypte sig keypair failed, %v", err)
-		log.Printf("load decrypte sig keypair failed, %v", err)
+		return nil, fmt.Errorf("load callback server keypair failed, %v", err)
+	}
+	if (cfg.AdminToken == "") != (cfg.AdminAddress == "") {
+		return nil, fmt.Errorf("the admin token and the admin address must be set together")
 	}
-	return &CallbackService{
+	if cfg.AdminAddress != "" && cfg.AdminAddress == cfg.Address {
+		return nil, fmt.Errorf("the admin address must differ from the callback address")
+	}
+	switch cfg.ResponseReasons {
+	case "", ResponseReasonsNone, ResponseReasonsCode, ResponseReasonsFull:
+	default:
+		return nil, fmt.Errorf("invalid response reasons %q", cfg.ResponseReasons)
+	}
+	encryption, err := newResponseEncryption(cfg.ResponseEncryption, cfg.ResponseEncryptionScheme, mpcNodeKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response encryption, %v", err)
+	}
+	bitcoin, err := BitcoinNetworkByName(cfg.BitcoinNetwork)
+	if err != nil {
+		return nil, err
+	}
+	var book *AddressBook
+	if cfg.AddressBookPath != "" {
+		if book, err = OpenAddressBook(cfg.AddressBookPath, bitcoin); err != nil {
+			return nil, fmt.Errorf("open address book failed, %v", err)
+		}
+	}
+	var keygens *KeygenRegistry
+	if cfg.KeygenRegistryPath != "" {
+		if keygens, err = OpenKeygenRegistry(cfg.KeygenRegistryPath); err != nil {
+			return nil, fmt.Errorf("open keygen registry failed, %v", err)
+		}
+	}
+	var keys *KeyRegistry
+	if cfg.KeyRegistryPath != "" {
+		if keys, err = OpenKeyRegistry(cfg.KeyRegistryPath); err != nil {
+			return nil, fmt.Errorf("open key registry failed, %v", err)
+		}
+	}
+	var policy Policy = &randomPolicy{reject: cfg.RandomReject}
+	var limitState *FileStore
+	if cfg.PolicyPath != "" {
+		rulePolicy, err := LoadPolicy(cfg.PolicyPath)
+		if err != nil {
+			return nil, fmt.Errorf("load policy failed, %v", err)
+		}
+		rulePolicy.UseAddressBook(book)
+		rulePolicy.UseKeyRegistry(keys)
+		if rulePolicy.RequiresKeyRegistry() && keys == nil {
+			return nil, fmt.Errorf("policy requires known keys but no key registry is configured")
+		}
+		if cfg.LimitStatePath != "" {
+			if limitState, err = OpenFileStore(cfg.LimitStatePath); err != nil {
+				return nil, fmt.Errorf("open limit state failed, %v", err)
+			}
+			if err = rulePolicy.PersistLimits(limitState); err != nil {
+				return nil, fmt.Errorf("load limit state failed, %v", err)
+			}
+		}
+		policy = rulePolicy
+	}
+	var shadow Policy
+	if cfg.ShadowPolicyPath != "" {
+		shadowPolicy, err := LoadPolicy(cfg.ShadowPolicyPath)
+		if err != nil {
+			return nil, fmt.Errorf("load shadow policy failed, %v", err)
+		}
+		shadowPolicy.UseAddressBook(book)
+		shadowPolicy.UseKeyRegistry(keys)
+		if shadowPolicy.RequiresKeyRegistry() && keys == nil {
+			return nil, fmt.Errorf("shadow policy requires known keys but no key registry is configured")
+		}
+		shadow = shadowPolicy
+	}
+	var auditLog *AuditLog
+	if cfg.AuditLogPath != "" {
+		if cfg.AuditLogPublicKeyPath == "" {
+			auditLog, err = OpenAuditLog(cfg.AuditLogPath)
+		} else {
+			var auditKey crypto.PublicKey
+			if auditKey, err = loadPublicKey(cfg.AuditLogPublicKeyPath); err != nil {
+				return nil, fmt.Errorf("load audit log public key failed, %v", err)
+			}
+			auditLog, err = OpenEncryptedAuditLog(cfg.AuditLogPath, auditKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	tssNodePublicKey, _ := mpcNodeKey.(*ecdsa.PublicKey)
+	private, _ := signingKey.(*ecdsa.PrivateKey)
+	var public *ecdsa.PublicKey
+	if private != nil {
+		public = &private.PublicKey
+	}
+
+	var privateSigKey crypto.PrivateKey
+	if cfg.DecryptSigKeyPath != "" {
+		if privateSigKey, err = loadDecryptKey(cfg.DecryptSigKeyPath); err != nil {
+			// return nil, fmt.Errorf("load decrypte sig keypair failed, %v", err)
+			log.Printf("load decrypte sig keypair failed, %v", err)
+		}
+	}
+	c := &CallbackService{
 		cfg:              cfg,
 		PrivateKey:       private,
 		PublicKey:        public,
 		DecryptSigKey:    privateSigKey,
 		MPCNodePublicKey: tssNodePublicKey,
 		RandomReject:     cfg.RandomReject,
-	}, nil
+		signingKey:       signingKey,
+		mpcNodeKey:       mpcNodeKey,
+		signer:           signer,
+		verifier:         verifier,
+		policy:           policy,
+		shadow:           shadow,
+		auditLog:         auditLog,
+		limitState:       limitState,
+		book:             book,
+		keygens:          keygens,
+		keys:             keys,
+		encryption:       encryption,
+		metrics:          NewMetrics(),
+		clock:            SystemClock,
+	}
+	c.registerDefaultChecks()
+	c.server = &http.Server{Addr: cfg.Address, Handler: c.Router()}
+	if cfg.AdminAddress != "" {
+		c.admin = &http.Server{Addr: cfg.AdminAddress, Handler: c.AdminRouter()}
+	}
+	return c, nil
 }
 
+// Start serves the callback API, and the admin API when configured, until
+// Shutdown is called or one of them fails.
 func (c *CallbackService) Start() error {
+	servers := []*http.Server{c.server}
+	if c.admin != nil {
+		servers = append(servers, c.admin)
+	}
+	served := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			log.Printf("listening on %s", server.Addr)
+			err := server.ListenAndServe()
+			if err == http.ErrServerClosed {
+				err = nil
+			}
+			served <- err
+		}(server)
+	}
+	for range servers {
+		if err := <-served; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown stops accepting requests, waits for the pending ones until ctx
+// is done and then stops the service.
+func (c *CallbackService) Shutdown(ctx context.Context) error {
+	err := c.server.Shutdown(ctx)
+	if c.admin != nil {
+		if adminErr := c.admin.Shutdown(ctx); err == nil {
+			err = adminErr
+		}
+	}
+	if stopErr := c.Stop(); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+// Router returns the gin engine serving the callback API.
+func (c *CallbackService) Router() *gin.Engine {
 	r := gin.Default()
 	api := r.Group("/")
-	api.POST("/check", c.Check)
-	api.POST("/rawdata_signature", c.RawDataSignature)
-
-	log.Fatal(r.Run(c.cfg.Address))
+	api.POST("/check", c.VerifiedBody(), c.Check)
+	api.POST("/rawdata_signature", c.VerifiedBody(), c.RawDataSignature)
+	api.GET("/healthz", c.Healthz)
+	api.GET("/readyz", c.Readyz)
+	api.GET("/metrics", c.Metrics)
+	return r
+}
 
-	return nil
+// AdminRouter returns the gin engine serving the /admin API.
+func (c *CallbackService) AdminRouter() *gin.Engine {
+	r := gin.Default()
+	c.adminRoutes(r.Group("/admin", c.AdminAuth()))
+	return r
 }
 
+// Stop closes the audit log, which ends its encrypted stream.
 func (c *CallbackService) Stop() error {
+	if c.auditLog != nil {
+		return c.auditLog.Close()
+	}
 	return nil
 }
 
 func (c *CallbackService) Check(g *gin.Context) {
 	log.Print("check >>")
-	bodyBytes, err := io.ReadAll(g.Request.Body)
-	if err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "read body failed"})
-		return
-	}
-	log.Print("check >>")
-	signature, ok := g.Request.Header["Signature"]
-	if !ok {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "signature not found"})
-		return
-	}
-	log.Printf("check request with signature: %v", signature)
-	hash := sha256.Sum256(bodyBytes)
-	signatureBytes, err := hex.DecodeString(signature[0])
-	if err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "verify signature failed"})
-		return
-	}
-	if !ecdsa.VerifyASN1(c.MPCNodePublicKey, hash[:], signatureBytes) {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "verify signature failed"})
-		return
-	}
 	request := &Check{}
-	if err = json.Unmarshal(bodyBytes, request); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "verify signature failed"})
+	if err := BindVerified(g, request); err != nil {
+		c.fail(g, ErrMalformedBody, err)
 		return
 	}
 	log.Printf("new check request, callback-id: [%s] request-type: [%s] sino-id: [%s] request-id: [%s] sign-type: [%s] t: [%d] n: [%d] cryptography: [%s] party-ids: [%v] message: [%s] signature: [%s] tx_info: [%s] ",
@@ -108,60 +333,22 @@ func (c *CallbackService) Check(g *gin.Context) {
 		request.RequestDetail.T, request.RequestDetail.N, request.RequestDetail.Cryptography, request.RequestDetail.PartyIds,
 		request.RequestDetail.Message, request.RequestDetail.Signature,
 		string(request.TxInfo))
-	response := &Response{
-		Status:    "0",
-		Signature: "",
-		Data: &ResponseData{
-			CallbackId: request.CallbackId,
-			SinoId:     request.ExtraInfo.SinoId,
-			RequestId:  request.ExtraInfo.RequestId,
-			Action:     c.randAction(request.RequestType),
-		},
-	}
-	if response.Data.Action == Wait {
-		response.Data.WaitTime = "60"
-	}
-	message, err := json.Marshal(response.Data)
-	if err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "marshal check response failed"})
-		return
-	}
-	if signature, err := Sign(c.PrivateKey, hex.EncodeToString(message)); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "sign check response failed"})
-		return
-	} else {
-		response.Signature = signature
-	}
-	g.JSON(http.StatusOK, response)
+	c.respond(g, request)
 }
 
 func (c *CallbackService) RawDataSignature(g *gin.Context) {
 	log.Print("rawdata_signature >>")
-	//var selected string
 	request := &Check{}
-	if err := g.BindJSON(request); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "parse check request failed"})
-		return
-	}
-	signature, ok := g.Request.Header["Signature"]
-	if !ok {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "signature not found"})
-		return
-	}
-	log.Printf("check request with signature: %v", signature)
-	if message, err := json.Marshal(request); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "marshal check request failed"})
-		return
-	} else if !Verify(c.MPCNodePublicKey, hex.EncodeToString(message), signature[0]) {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "verify signature failed"})
+	if err := BindVerified(g, request); err != nil {
+		c.fail(g, ErrMalformedBody, err)
 		return
 	}
 
 	log.Printf("RequestDetail.Signature: %v", request.RequestDetail.Signature)
 	if c.DecryptSigKey != nil {
-		decodeSig, err := Decrypt(c.DecryptSigKey, request.RequestDetail.Signature)
+		decodeSig, err := DecryptSignature(c.DecryptSigKey, request.RequestDetail.Signature)
 		if err != nil {
-			g.JSON(http.StatusBadRequest, gin.H{"status": "501", "error": "decrypt sig error"})
+			c.fail(g, ErrDecryptFailed, err)
 			return
 		}
 		log.Print("use private key decrypt signature >>")
@@ -171,55 +358,153 @@ func (c *CallbackService) RawDataSignature(g *gin.Context) {
 			decodeSig,
 			request.ExtraInfo.SinoId, request.ExtraInfo.RequestId)
 	}
+	c.respond(g, request)
+}
 
-	response := &Response{
-		Status:    "0",
-		Signature: "",
-		Data: &ResponseData{
-			CallbackId: request.CallbackId,
-			SinoId:     request.ExtraInfo.SinoId,
-			RequestId:  request.ExtraInfo.RequestId,
-			Action:     c.randAction(request.RequestType),
-		},
-	}
-	if response.Data.Action == Wait {
-		response.Data.WaitTime = "60"
-	}
-	message, err := json.Marshal(response.Data)
+// respond evaluates request with the policy and sends the signed decision.
+func (c *CallbackService) respond(g *gin.Context, request *Check) {
+	now := c.clock.Now()
+	decision, err := c.policy.Evaluate(request, now)
 	if err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "marshal check response failed"})
+		c.fail(g, ErrPolicy, err)
 		return
 	}
-	if signature, err := Sign(c.PrivateKey, hex.EncodeToString(message)); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"status": "400", "error": "sign check response failed"})
+	log.Printf("callback-id: [%s] request-type: [%s] action: [%s] rule: [%s] reason: [%s]",
+		request.CallbackId, request.RequestType, decision.Action, decision.RuleId, decision.Reason)
+	data := &ResponseData{
+		CallbackId: request.CallbackId,
+		SinoId:     request.ExtraInfo.SinoId,
+		RequestId:  request.ExtraInfo.RequestId,
+		Action:     decision.Action,
+		WaitTime:   decision.WaitTime,
+	}
+	if decision.Action != Approve {
+		switch c.cfg.ResponseReasons {
+		case ResponseReasonsFull:
+			data.Reason = decision.Reason
+			fallthrough
+		case ResponseReasonsCode:
+			data.RuleId = decision.RuleId
+			data.ReasonCode = decision.Code
+		}
+	}
+	if !c.reply(g, data, &AuditEntry{Time: now, RuleId: decision.RuleId, Shadow: c.evaluateShadow(request, now, decision)}) {
 		return
-	} else {
-		response.Signature = signature
 	}
+	// only keygens the mpc-node was told to approve are recorded
+	if request.RequestType == RequestTypeKeygen && decision.Action == Approve && c.keygens != nil {
+		if err = c.keygens.Record(request, now); err != nil {
+			log.Printf("callback-id: [%s] record keygen failed, %v", request.CallbackId, err)
+		}
+	}
+}
+
+// evaluateShadow runs the shadow policy, if any, on request and records
+// whether it agrees with the active decision. The shadow decision never
+// changes the response.
+func (c *CallbackService) evaluateShadow(request *Check, now time.Time, active *Decision) *Decision {
+	if c.shadow == nil {
+		return nil
+	}
+	shadow, err := c.shadow.Evaluate(request, now)
+	if err != nil {
+		log.Printf("callback-id: [%s] shadow policy failed, %v", request.CallbackId, err)
+		c.metrics.ShadowErrors.Inc()
+		return nil
+	}
+	c.metrics.ShadowEvaluations.Inc(shadow.Action, shadow.RuleId)
+	if shadow.Action != active.Action {
+		log.Printf("callback-id: [%s] request-type: [%s] shadow policy disagrees, active: [%s] rule: [%s] shadow: [%s] rule: [%s]",
+			request.CallbackId, request.RequestType, active.Action, active.RuleId, shadow.Action, shadow.RuleId)
+		c.metrics.ShadowDisagreements.Inc(active.Action, shadow.Action, shadow.RuleId)
+	}
+	return shadow
+}
+
+// reply signs data and sends it as a successful Response, entry is
+// completed with data and written to the audit log. It reports whether the
+// response was sent, g is failed otherwise.
+func (c *CallbackService) reply(g *gin.Context, data *ResponseData, entry *AuditEntry) bool {
+	response := &Response{
+		Status: StatusSuccess,
+		Data:   data,
+	}
+	if c.encryption != nil {
+		if err := c.encryption.Encrypt(response); err != nil {
+			c.fail(g, ErrInternal, err)
+			return false
+		}
+	}
+	if err := c.signResponse(response); err != nil {
+		c.fail(g, ErrInternal, err)
+		return false
+	}
+	entry.Response = data
+	c.audit(g, entry)
+	c.metrics.Requests.Inc(g.Request.URL.Path, data.Action, entry.RuleId)
 	g.JSON(http.StatusOK, response)
+	return true
+}
+
+// fail aborts the request with a signed error Response built from apiErr,
+// cause is only logged.
+func (c *CallbackService) fail(g *gin.Context, apiErr *APIError, cause error) {
+	if cause != nil {
+		log.Printf("%s %s failed, %v: %v", g.Request.Method, g.Request.URL.Path, apiErr, cause)
+	} else {
+		log.Printf("%s %s failed, %v", g.Request.Method, g.Request.URL.Path, apiErr)
+	}
+	response := &Response{
+		Status: apiErr.Code,
+		Error:  apiErr.Message,
+	}
+	if err := c.signResponse(response); err != nil {
+		log.Printf("sign error response failed, %v", err)
+	}
+	c.audit(g, &AuditEntry{Error: apiErr.Code})
+	c.metrics.Errors.Inc(g.Request.URL.Path, apiErr.Code)
+	g.AbortWithStatusJSON(apiErr.HTTPStatus, response)
+}
+
+// signResponse fills in response.Signature.
+func (c *CallbackService) signResponse(response *Response) error {
+	message, err := ResponsePayload(response, c.cfg.CanonicalJSON)
+	if err != nil {
+		return fmt.Errorf("marshal response failed, %v", err)
+	}
+	signature, err := c.signer.Sign(message)
+	if err != nil {
+		return fmt.Errorf("sign response failed, %v", err)
+	}
+	response.Signature = signature
+	return nil
+}
+
+// ResponsePayload returns the bytes covered by Response.Signature: the JSON
+// of Data, or of EncryptedData, for successful responses and of ErrorData
+// for error responses, canonicalized when canonical is set.
+func ResponsePayload(response *Response, canonical bool) ([]byte, error) {
+	var payload interface{} = response.Data
+	if response.EncryptedData != "" {
+		payload = &EncryptedData{EncryptedData: response.EncryptedData}
+	} else if response.Data == nil {
+		payload = &ErrorData{Status: response.Status, Error: response.Error}
+	}
+	if canonical {
+		return MarshalCanonical(payload)
+	}
+	return json.Marshal(payload)
 }
 
+// ResponseReasons values.
+const (
+	ResponseReasonsNone = "none"
+	ResponseReasonsCode = "code"
+	ResponseReasonsFull = "full"
+)
+
 const (
 	Approve = "APPROVE"
 	Reject  = "REJECT"
 	Wait    = "WAIT"
 )
-
-func (c *CallbackService) randAction(t string) string {
-	if c.RandomReject == false {
-		return Approve
-	}
-	switch t {
-	case "keygen":
-		return Approve
-	default:
-		r := rand.Float32()
-		if r < 0.80 {
-			return Approve
-		} else if r < 0.90 {
-			return Reject
-		} else {
-			return Wait
-		}
-	}
-}
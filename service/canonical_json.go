@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// CanonicalJSON re-encodes a JSON document according to the RFC 8785 JSON
+// Canonicalization Scheme: object members sorted by their UTF-16 code units,
+// no insignificant whitespace, minimal string escaping and ECMAScript number
+// serialization. Duplicate object keys are rejected.
+func CanonicalJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	buf := &bytes.Buffer{}
+	if err := canonicalValue(dec, buf); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("jcs: unexpected data after top-level value")
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalCanonical is json.Marshal followed by CanonicalJSON.
+func MarshalCanonical(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return CanonicalJSON(data)
+}
+
+func canonicalValue(dec *json.Decoder, buf *bytes.Buffer) error {
+	token, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("jcs: %v", err)
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			return canonicalObject(dec, buf)
+		case '[':
+			return canonicalArray(dec, buf)
+		}
+		return fmt.Errorf("jcs: unexpected delimiter %s", t)
+	case string:
+		canonicalString(buf, t)
+	case json.Number:
+		f, err := strconv.ParseFloat(string(t), 64)
+		if err != nil {
+			return fmt.Errorf("jcs: invalid number %s, %v", t, err)
+		}
+		s, err := canonicalNumber(f)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case bool:
+		buf.WriteString(strconv.FormatBool(t))
+	case nil:
+		buf.WriteString("null")
+	default:
+		return fmt.Errorf("jcs: unexpected token %v", token)
+	}
+	return nil
+}
+
+func canonicalArray(dec *json.Decoder, buf *bytes.Buffer) error {
+	buf.WriteByte('[')
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := canonicalValue(dec, buf); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("jcs: %v", err)
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+type canonicalMember struct {
+	key   string
+	sort  []uint16
+	value []byte
+}
+
+func canonicalObject(dec *json.Decoder, buf *bytes.Buffer) error {
+	var members []canonicalMember
+	seen := make(map[string]bool)
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("jcs: %v", err)
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("jcs: object key %v is not a string", token)
+		}
+		if seen[key] {
+			return fmt.Errorf("jcs: duplicate object key %q", key)
+		}
+		seen[key] = true
+		value := &bytes.Buffer{}
+		if err := canonicalValue(dec, value); err != nil {
+			return err
+		}
+		members = append(members, canonicalMember{
+			key:   key,
+			sort:  utf16.Encode([]rune(key)),
+			value: value.Bytes(),
+		})
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("jcs: %v", err)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return lessUTF16(members[i].sort, members[j].sort)
+	})
+	buf.WriteByte('{')
+	for i, m := range members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		canonicalString(buf, m.key)
+		buf.WriteByte(':')
+		buf.Write(m.value)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func lessUTF16(a, b []uint16) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func canonicalString(buf *bytes.Buffer, s string) {
+	const hexDigits = "0123456789abcdef"
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			buf.WriteString(`\"`)
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '\b':
+			buf.WriteString(`\b`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\f':
+			buf.WriteString(`\f`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r < 0x20:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hexDigits[r>>4])
+			buf.WriteByte(hexDigits[r&0xf])
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// canonicalNumber formats f the way ECMAScript Number.prototype.toString
+// does, as required by RFC 8785 section 3.2.2.3.
+func canonicalNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("jcs: %v is not a valid JSON number", f)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+	// shortest round-trip digits in the form d.ddde±x
+	sci := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp := sci, 0
+	if i := strings.IndexByte(sci, 'e'); i >= 0 {
+		mantissa = sci[:i]
+		e, err := strconv.Atoi(sci[i+1:])
+		if err != nil {
+			return "", fmt.Errorf("jcs: format %v failed, %v", f, err)
+		}
+		exp = e
+	}
+	digits := strings.Replace(mantissa, ".", "", 1)
+	k := len(digits)
+	n := exp + 1
+
+	var out string
+	switch {
+	case k <= n && n <= 21:
+		out = digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		out = digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		out = "0." + strings.Repeat("0", -n) + digits
+	default:
+		out = digits[:1]
+		if k > 1 {
+			out += "." + digits[1:]
+		}
+		if n-1 >= 0 {
+			out += "e+" + strconv.Itoa(n-1)
+		} else {
+			out += "e" + strconv.Itoa(n-1)
+		}
+	}
+	return sign + out, nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+)
+
+// Test vectors from RFC 8785 section 3.2.2, 3.2.3 and appendix B; the same
+// vectors are shipped by the reference implementations in other languages.
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+	}{
+		{
+			`{
+  "numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+  "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+  "literals": [null, true, false]
+}`,
+			`{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			`{
+  "\u20ac": "Euro Sign",
+  "\r": "Carriage Return",
+  "\ufb33": "Hebrew Letter Dalet With Dagesh",
+  "1": "One",
+  "\ud83d\ude00": "Emoji: Grinning Face",
+  "\u0080": "Control",
+  "\u00f6": "Latin Small Letter O With Diaeresis"
+}`,
+			"{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\",\"\u20ac\":\"Euro Sign\",\"\U0001f600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		{
+			`{"b": {"z": [], "a": {}}, "a": "<&>", "c": "\u2028"}`,
+			"{\"a\":\"<&>\",\"b\":{\"a\":{},\"z\":[]},\"c\":\"\u2028\"}",
+		},
+		{`  "top level string" `, `"top level string"`},
+	}
+	for _, test := range tests {
+		out, err := CanonicalJSON([]byte(test.input))
+		if err != nil {
+			t.Fatalf("canonicalize %s failed, %v", test.input, err)
+		}
+		if string(out) != test.output {
+			t.Fatalf("canonical json mismatch:\nhave: %s\nwant: %s", out, test.output)
+		}
+	}
+}
+
+func TestCanonicalNumber(t *testing.T) {
+	tests := []struct {
+		bits   string
+		output string
+	}{
+		{"0000000000000000", "0"},
+		{"8000000000000000", "0"},
+		{"0000000000000001", "5e-324"},
+		{"8000000000000001", "-5e-324"},
+		{"7fefffffffffffff", "1.7976931348623157e+308"},
+		{"ffefffffffffffff", "-1.7976931348623157e+308"},
+		{"4340000000000000", "9007199254740992"},
+		{"c340000000000000", "-9007199254740992"},
+		{"4430000000000000", "295147905179352830000"},
+		{"44b52d02c7e14af5", "9.999999999999997e+22"},
+		{"44b52d02c7e14af6", "1e+23"},
+		{"44b52d02c7e14af7", "1.0000000000000001e+23"},
+		{"444b1ae4d6e2ef4e", "999999999999999700000"},
+		{"444b1ae4d6e2ef4f", "999999999999999900000"},
+		{"444b1ae4d6e2ef50", "1e+21"},
+		{"3eb0c6f7a0b5ed8c", "9.999999999999997e-7"},
+		{"3eb0c6f7a0b5ed8d", "0.000001"},
+		{"41b3de4355555553", "333333333.3333332"},
+		{"41b3de4355555554", "333333333.33333325"},
+		{"41b3de4355555555", "333333333.3333333"},
+		{"41b3de4355555556", "333333333.3333334"},
+		{"41b3de4355555557", "333333333.33333343"},
+		{"becbf647612f3696", "-0.0000033333333333333333"},
+		{"43143ff3c1cb0959", "1424953923781206.2"},
+	}
+	for _, test := range tests {
+		b := decodeHex(test.bits)
+		var u uint64
+		for _, x := range b {
+			u = u<<8 | uint64(x)
+		}
+		out, err := canonicalNumber(math.Float64frombits(u))
+		if err != nil {
+			t.Fatalf("%s: %v", test.bits, err)
+		}
+		if out != test.output {
+			t.Fatalf("%s: have %s want %s", test.bits, out, test.output)
+		}
+	}
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := canonicalNumber(f); err == nil {
+			t.Fatalf("%v should not be serializable", f)
+		}
+	}
+}
+
+func TestCanonicalJSONInvalid(t *testing.T) {
+	for _, input := range []string{
+		`{"a":1,"a":2}`,
+		`{"a":1} {}`,
+		`{"a":`,
+		`[1,]`,
+	} {
+		if out, err := CanonicalJSON([]byte(input)); err == nil {
+			t.Fatalf("%s should be rejected, got %s", input, out)
+		}
+	}
+}
+
+// The signed payload of a check response, as a non-Go mpc-node must rebuild it.
+func TestMarshalCanonicalResponseData(t *testing.T) {
+	data := &ResponseData{
+		CallbackId: "cb-<1>",
+		SinoId:     "sino",
+		RequestId:  "req",
+		Action:     Wait,
+		WaitTime:   "60",
+	}
+	out, err := MarshalCanonical(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"action":"WAIT","callback_id":"cb-<1>","request_id":"req","sino_id":"sino","wait_time":"60"}`
+	if string(out) != want {
+		t.Fatalf("have: %s\nwant: %s", out, want)
+	}
+}
+
+func decodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
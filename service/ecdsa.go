@@ -1,13 +1,19 @@
 package service
 
 import (
+	"bufio"
+	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding"
 	"encoding/hex"
 	"encoding/pem"
 	"fmt"
+	"hash"
+	"io"
 
 	"github.com/sinohope/mpc-node-callback-demo/service/ecies"
 )
@@ -59,7 +65,8 @@ func PEM2PrivateKey(pemData []byte) (*ecdsa.PrivateKey, error) {
 	return priKey, nil
 }
 
-// Decrypt decrypts an ECIES ciphertext.
+// Decrypt decrypts an ECIES ciphertext, either legacy or versioned with
+// the scheme detected from its header.
 func Decrypt(pri *ecdsa.PrivateKey, cipherText string) (string, error) {
 	private := ecies.ImportECDSA(pri)
 
@@ -73,3 +80,230 @@ func Decrypt(pri *ecdsa.PrivateKey, cipherText string) (string, error) {
 	}
 	return hex.EncodeToString(m), nil
 }
+
+// EncryptSignature ECIES encrypts plain for a decrypt signature public key,
+// an ECDSA or an X25519 key. nil params select the default parameters of
+// the key, compress compresses the ephemeral key of ECDSA keys.
+func EncryptSignature(pub crypto.PublicKey, params *ecies.ECIESParams, compress bool, plain []byte) ([]byte, error) {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		public := ecies.ImportECDSAPublic(key)
+		if params != nil {
+			public.Params = params
+		}
+		if compress && public.Params != nil {
+			public.Params = public.Params.WithCompressedKeys()
+		}
+		return ecies.Encrypt(rand.Reader, public, plain, nil, nil)
+	case ecies.X25519PublicKey:
+		return ecies.EncryptX25519(rand.Reader, key, params, plain, nil, nil)
+	}
+	return nil, fmt.Errorf("unsupported decrypt signature key type %T", pub)
+}
+
+// DecryptSignature decrypts a hex ECIES ciphertext with a decrypt signature
+// private key, an ECDSA or an X25519 key.
+func DecryptSignature(key crypto.PrivateKey, cipherText string) (string, error) {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return Decrypt(k, cipherText)
+	case ecies.X25519PrivateKey:
+		ct, err := hex.DecodeString(cipherText)
+		if err != nil {
+			return "", fmt.Errorf("decode cipher text failed, %v", err)
+		}
+		m, err := k.Decrypt(ct, nil, nil)
+		if err != nil {
+			return "", fmt.Errorf("decrypt failed, %v", err)
+		}
+		return hex.EncodeToString(m), nil
+	}
+	return "", fmt.Errorf("unsupported decrypt signature key type %T", key)
+}
+
+// EncryptStream starts an ECIES stream encrypted for pub, an ECDSA or an
+// X25519 key, on w. chain is the SHA-256 of the data preceding the stream,
+// see DecryptStreams. The returned writer must be closed to end the stream.
+func EncryptStream(pub crypto.PublicKey, w io.Writer, chain []byte) (*ecies.StreamWriter, error) {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		return ecies.EncryptStream(rand.Reader, ecies.ImportECDSAPublic(key), nil, w, nil, chain)
+	case ecies.X25519PublicKey:
+		return ecies.EncryptStreamX25519(rand.Reader, key, nil, w, nil, chain)
+	}
+	return nil, fmt.Errorf("unsupported stream encryption key type %T", pub)
+}
+
+const (
+	// maxStreamStart bounds a stream header and its first segment.
+	maxStreamStart = 128 + ecies.StreamBufferSize
+	// streamsBufferSize lets resync look for a stream past the rest of a
+	// cut off segment.
+	streamsBufferSize = 2 * maxStreamStart
+)
+
+// pendingReader keeps the data read from r until it is hashed.
+type pendingReader struct {
+	r       io.Reader
+	pending []byte
+}
+
+func (p *pendingReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.pending = append(p.pending, b[:n]...)
+	return n, err
+}
+
+// streamsReader reads concatenated ECIES streams.
+type streamsReader struct {
+	key       crypto.PrivateKey
+	raw       *pendingReader
+	r         *bufio.Reader
+	chain     hash.Hash // of the data consumed from r
+	stream    io.Reader
+	streams   int
+	truncated int
+}
+
+// TruncatedStreamsError is returned by DecryptStreams at the end of its
+// input when some streams were not closed.
+type TruncatedStreamsError struct {
+	Truncated int
+	Streams   int
+}
+
+func (e *TruncatedStreamsError) Error() string {
+	return fmt.Sprintf("%d of %d streams were not closed, they were cut off or tampered with", e.Truncated, e.Streams)
+}
+
+// DecryptStreams returns the plaintext of the ECIES streams of
+// EncryptStream concatenated in r. Every stream is chained to the SHA-256
+// of the data preceding it, so a removed or reordered stream fails to
+// decrypt. A stream that was never closed, as when its writer crashed or
+// its tail was cut off, is read up to its last authenticated segment and
+// the next stream is looked for from there. Such streams are reported by a
+// *TruncatedStreamsError once r is exhausted.
+func DecryptStreams(key crypto.PrivateKey, r io.Reader) io.Reader {
+	raw := &pendingReader{r: r}
+	return &streamsReader{key: key, raw: raw, r: bufio.NewReaderSize(raw, streamsBufferSize), chain: sha256.New()}
+}
+
+func (s *streamsReader) Read(p []byte) (int, error) {
+	for {
+		if s.stream == nil {
+			if _, err := s.r.Peek(1); err != nil {
+				if err == io.EOF && s.truncated > 0 {
+					err = &TruncatedStreamsError{Truncated: s.truncated, Streams: s.streams}
+				}
+				return 0, err
+			}
+			s.hashConsumed()
+			stream, err := s.openStream(s.r, s.chainAt(nil))
+			if err != nil {
+				return 0, fmt.Errorf("decrypt stream %d failed, %v", s.streams+1, err)
+			}
+			s.stream = stream
+			s.streams++
+		}
+		n, err := s.stream.Read(p)
+		if len(s.raw.pending) > streamsBufferSize {
+			s.hashConsumed()
+		}
+		if err == ecies.ErrTruncated || err == ecies.ErrInvalidMessage {
+			s.truncated++
+			if err = s.resync(); err == nil {
+				err = io.EOF
+			}
+		}
+		if err == io.EOF {
+			s.stream = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		} else if err != nil {
+			err = fmt.Errorf("decrypt stream %d failed, %v", s.streams, err)
+		}
+		return n, err
+	}
+}
+
+func (s *streamsReader) openStream(r *bufio.Reader, chain []byte) (io.Reader, error) {
+	switch k := s.key.(type) {
+	case *ecdsa.PrivateKey:
+		return ecies.ImportECDSA(k).DecryptStream(r, nil, chain)
+	case ecies.X25519PrivateKey:
+		return k.DecryptStream(r, nil, chain)
+	}
+	return nil, fmt.Errorf("unsupported stream decryption key type %T", s.key)
+}
+
+// hashConsumed adds the data consumed from r to the chain.
+func (s *streamsReader) hashConsumed() {
+	n := len(s.raw.pending) - s.r.Buffered()
+	s.chain.Write(s.raw.pending[:n])
+	s.raw.pending = append(s.raw.pending[:0], s.raw.pending[n:]...)
+}
+
+// chainAt returns the chain of a stream starting after the consumed data
+// and next.
+func (s *streamsReader) chainAt(next []byte) []byte {
+	state, _ := s.chain.(encoding.BinaryMarshaler).MarshalBinary()
+	h := sha256.New()
+	h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state)
+	h.Write(next)
+	return h.Sum(nil)
+}
+
+// resync skips the rest of a stream that failed, up to the next stream
+// whose first segment decrypts, or to the end of the input.
+func (s *streamsReader) resync() error {
+	for {
+		s.hashConsumed()
+		window, err := s.r.Peek(streamsBufferSize)
+		last := len(window) - 1
+		if err == nil {
+			last = len(window) - maxStreamStart
+		}
+		for i := 0; i <= last; i++ {
+			if s.startsStream(window[i:], window[:i]) {
+				_, err = s.r.Discard(i)
+				return err
+			}
+		}
+		if _, discardErr := s.r.Discard(last + 1); err == nil {
+			err = discardErr
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// startsStream reports whether data starts with a stream following
+// skipped whose first segment decrypts.
+func (s *streamsReader) startsStream(data, skipped []byte) bool {
+	if !ecies.IsStreamHeader(data) {
+		return false
+	}
+	stream, err := s.openStream(bufio.NewReaderSize(bytes.NewReader(data), ecies.StreamBufferSize), s.chainAt(skipped))
+	if err != nil {
+		return false
+	}
+	_, err = stream.Read(make([]byte, 1))
+	return err == nil || err == io.EOF
+}
+
+// decryptKeyPublic returns the public key of a decrypt signature key.
+func decryptKeyPublic(key crypto.PrivateKey) crypto.PublicKey {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return &k.PublicKey
+	case ecies.X25519PrivateKey:
+		return k.Public()
+	}
+	return nil
+}
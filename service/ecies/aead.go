@@ -0,0 +1,141 @@
+package ecies
+
+// This file contains the AEAD variant of ECIES. The shared secret is
+// expanded with HKDF and the message sealed with an AEAD, the ciphertext
+// carries a header naming the parameter set:
+//
+//	0xec | version | scheme | R | nonce | sealed message
+//
+// R is the ephemeral public key, compressed or not. HKDF is salted with R
+// and its info is the header followed by s1, the AEAD additional data is
+// the header followed by s2. Legacy ciphertexts start with R, whose first
+// byte is 2, 3 or 4, so Decrypt tells both formats apart.
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	headerMagic = 0xec
+	Version1    = 1
+	headerLen   = 3
+)
+
+var ErrUnsupportedVersion = fmt.Errorf("ecies: unsupported ciphertext version")
+
+// aeadKey derives the AEAD key from the shared secret z.
+func aeadKey(params *ECIESParams, z, R, header, s1 []byte) ([]byte, error) {
+	info := make([]byte, 0, len(header)+len(s1))
+	info = append(append(info, header...), s1...)
+	key := make([]byte, params.KeyLen)
+	if _, err := io.ReadFull(hkdf.New(params.Hash, z, R, info), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func additionalData(header, s2 []byte) []byte {
+	ad := make([]byte, 0, len(header)+len(s2))
+	return append(append(ad, header...), s2...)
+}
+
+// sealAEAD returns the versioned ciphertext of m for the shared secret z
+// and the encoded ephemeral public key R.
+func sealAEAD(rand io.Reader, params *ECIESParams, z, R, m, s1, s2 []byte) ([]byte, error) {
+	header := []byte{headerMagic, Version1, params.Scheme}
+	key, err := aeadKey(params, z, R, header, s1)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := params.AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	ct := make([]byte, 0, len(header)+len(R)+aead.NonceSize()+len(m)+aead.Overhead())
+	ct = append(append(ct, header...), R...)
+	nonce := ct[len(ct) : len(ct)+aead.NonceSize()]
+	if _, err = io.ReadFull(rand, nonce); err != nil {
+		return nil, err
+	}
+	ct = ct[:len(ct)+len(nonce)]
+	return aead.Seal(ct, nonce, m, additionalData(header, s2)), nil
+}
+
+// parseHeader returns the header of a versioned ciphertext and its AEAD
+// parameters.
+func parseHeader(c []byte) ([]byte, *ECIESParams, error) {
+	if len(c) < headerLen || c[0] != headerMagic {
+		return nil, nil, ErrInvalidMessage
+	}
+	header := c[:headerLen]
+	if header[1] != Version1 {
+		return nil, nil, ErrUnsupportedVersion
+	}
+	params := ParamsFromScheme(header[2])
+	if params == nil {
+		return nil, nil, ErrUnsupportedECIESParameters
+	}
+	return header, params, nil
+}
+
+// openAEAD opens the nonce and sealed message c of a versioned ciphertext.
+func openAEAD(params *ECIESParams, header, z, R, c, s1, s2 []byte) ([]byte, error) {
+	key, err := aeadKey(params, z, R, header, s1)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := params.AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(c) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidMessage
+	}
+	m, err := aead.Open(nil, c[:aead.NonceSize()], c[aead.NonceSize():], additionalData(header, s2))
+	if err != nil {
+		return nil, ErrInvalidMessage
+	}
+	return m, nil
+}
+
+func encryptAEAD(rand io.Reader, pub *PublicKey, params *ECIESParams, m, s1, s2 []byte) ([]byte, error) {
+	R, err := GenerateKey(rand, pub.Curve, params)
+	if err != nil {
+		return nil, err
+	}
+	z, err := R.GenerateShared(pub, MaxSharedKeyLength(pub), 0)
+	if err != nil {
+		return nil, err
+	}
+	Rb := marshalPoint(pub.Curve, R.PublicKey.X, R.PublicKey.Y, params.CompressKeys)
+	return sealAEAD(rand, params, z, Rb, m, s1, s2)
+}
+
+func (prv *PrivateKey) decryptAEAD(c, s1, s2 []byte) ([]byte, error) {
+	header, params, err := parseHeader(c)
+	if err != nil {
+		return nil, err
+	}
+	c = c[headerLen:]
+	if len(c) == 0 || (c[0] != 2 && c[0] != 3 && c[0] != 4) {
+		return nil, ErrInvalidPublicKey
+	}
+	rLen := pointLen(prv.PublicKey.Curve, c[0] != 4)
+	if len(c) < rLen {
+		return nil, ErrInvalidMessage
+	}
+	R := new(PublicKey)
+	R.Curve = prv.PublicKey.Curve
+	R.X, R.Y = unmarshalPoint(R.Curve, c[:rLen])
+	if R.X == nil {
+		return nil, ErrInvalidPublicKey
+	}
+	z, err := prv.GenerateShared(R, MaxSharedKeyLength(R), 0)
+	if err != nil {
+		return nil, err
+	}
+	return openAEAD(params, header, z, c[:rLen], c[rLen:], s1, s2)
+}
@@ -0,0 +1,103 @@
+package ecies
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// aeadTestKey is the recipient of the AEAD test vectors.
+func aeadTestKey() *PrivateKey {
+	prv, _ := btcec.PrivKeyFromBytes(decode("c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721"))
+	return ImportECDSA(prv.ToECDSA())
+}
+
+// TestAEADVectors decrypts "Hello, world." encrypted with s1 "s1" and s2
+// "s2". The vectors were checked against an independent implementation
+// (node crypto: ECDH secp256k1, hkdfSync and createDecipheriv).
+func TestAEADVectors(t *testing.T) {
+	vectors := []string{
+		"ec010104ac47b593a9049dd733a5394153bc3750f924bd8d5e243b245563296d2d4cded84b558577d5397c0cf1acb2bd79716958088d690b2bb25f3b0fc7e39cf47eeb70222222222222222222222222769ec1ecceb43900e68c33885959b15f4ab5961e60daa0f35b6270465e",
+		"ec010204ac47b593a9049dd733a5394153bc3750f924bd8d5e243b245563296d2d4cded84b558577d5397c0cf1acb2bd79716958088d690b2bb25f3b0fc7e39cf47eeb7022222222222222222222222228a4b58f96ab0505240bc6d6373f1fc0609eea01abcd8e85c78b6aa03b",
+	}
+	prv := aeadTestKey()
+	for _, vector := range vectors {
+		m, err := prv.Decrypt(decode(vector), []byte("s1"), []byte("s2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(m) != "Hello, world." {
+			t.Errorf("got %q", m)
+		}
+		if _, err = prv.Decrypt(decode(vector), nil, []byte("s2")); err != ErrInvalidMessage {
+			t.Errorf("decrypted with a wrong s1: %v", err)
+		}
+		if _, err = prv.Decrypt(decode(vector), []byte("s1"), nil); err != ErrInvalidMessage {
+			t.Errorf("decrypted with a wrong s2: %v", err)
+		}
+	}
+}
+
+func TestAEADEncryptDecrypt(t *testing.T) {
+	prv := aeadTestKey()
+	other, err := GenerateKey(rand.Reader, DefaultCurve, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("Hello, world.")
+	for _, params := range []*ECIESParams{ECIES_AES256GCM_HKDF_SHA256, ECIES_CHACHA20POLY1305_HKDF_SHA256} {
+		pub := prv.PublicKey
+		pub.Params = params
+		ct, err := Encrypt(rand.Reader, &pub, message, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct[0] != headerMagic || ct[1] != Version1 || ct[2] != params.Scheme {
+			t.Fatalf("unexpected header %x", ct[:headerLen])
+		}
+		// the key's own parameters do not matter, the header names the scheme
+		pt, err := prv.Decrypt(ct, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pt, message) {
+			t.Fatal("ecies: plaintext doesn't match message")
+		}
+		if _, err = other.Decrypt(ct, nil, nil); err == nil {
+			t.Fatal("ecies: decrypted with the wrong key")
+		}
+
+		tampered := append([]byte{}, ct...)
+		tampered[len(tampered)-1] ^= 1
+		if _, err = prv.Decrypt(tampered, nil, nil); err != ErrInvalidMessage {
+			t.Errorf("tampered ciphertext: %v", err)
+		}
+		tampered = append([]byte{}, ct...)
+		tampered[2] = SchemeAES256GCM + SchemeChaCha20Poly1305 - params.Scheme
+		if _, err = prv.Decrypt(tampered, nil, nil); err != ErrInvalidMessage {
+			t.Errorf("switched scheme: %v", err)
+		}
+		tampered[1] = 9
+		if _, err = prv.Decrypt(tampered, nil, nil); err != ErrUnsupportedVersion {
+			t.Errorf("unknown version: %v", err)
+		}
+		tampered[1], tampered[2] = Version1, 9
+		if _, err = prv.Decrypt(tampered, nil, nil); err != ErrUnsupportedECIESParameters {
+			t.Errorf("unknown scheme: %v", err)
+		}
+		if _, err = prv.Decrypt(ct[:headerLen+70], nil, nil); err != ErrInvalidMessage {
+			t.Errorf("truncated ciphertext: %v", err)
+		}
+	}
+
+	// legacy ciphertexts still decrypt with the same key
+	ct, err := Encrypt(rand.Reader, &prv.PublicKey, message, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt, err := prv.Decrypt(ct, nil, nil); err != nil || !bytes.Equal(pt, message) {
+		t.Errorf("legacy ciphertext: %v", err)
+	}
+}
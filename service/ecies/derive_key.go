@@ -1,8 +1,10 @@
 package ecies
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 
 	"golang.org/x/crypto/argon2"
@@ -21,12 +23,140 @@ var (
 	argon2_derive_salt, _ = hex.DecodeString(argon2_derive_salt_hex)
 )
 
-// DeriveKeyPairAccordingPasswords derive a keypair by an user inputed password
-func DeriveKeyPairAccordingPasswords(password string) (prv *PrivateKey, err error) {
+const (
+	// DeriveVersion1 derives with the fixed salt and costs above, as
+	// DeriveKeyPairAccordingPasswords.
+	DeriveVersion1 = 1
+	// DeriveVersion2 derives with a per-user salt and the costs of the
+	// record.
+	DeriveVersion2 = 2
+
+	minSaltLen      = 16
+	maxArgon2Time   = 64
+	maxArgon2Memory = 4 * 1024 * 1024 // 4GB
+	keyCheckLen     = 8
+)
+
+var ErrKeyCheck = errors.New("derived key does not match the key check value, wrong password")
+
+// DeriveParams records how a key pair is derived from a password. It is
+// not secret, store it alongside the public key to re-derive the key pair.
+type DeriveParams struct {
+	Version int `json:"version"`
+	// Salt is hex encoded, it and the argon2id costs are fixed by version 1
+	// and may be omitted.
+	Salt    string `json:"salt,omitempty"`
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory_kib,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+	// KeyCheck is the hex key check value of the derived public key, empty
+	// until the first derivation.
+	KeyCheck string `json:"key_check,omitempty"`
+}
+
+// DeriveParamsV1 returns the parameters of DeriveKeyPairAccordingPasswords.
+func DeriveParamsV1() *DeriveParams {
+	return &DeriveParams{
+		Version: DeriveVersion1,
+		Salt:    argon2_derive_salt_hex,
+		Time:    argon2_time,
+		Memory:  argon2_memory,
+		Threads: argon2_threads,
+	}
+}
+
+// NewDeriveParams returns version 2 parameters with a random salt and the
+// second recommended argon2id option of RFC 9106.
+func NewDeriveParams(rand io.Reader) (*DeriveParams, error) {
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return nil, err
+	}
+	return &DeriveParams{
+		Version: DeriveVersion2,
+		Salt:    hex.EncodeToString(salt),
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+	}, nil
+}
+
+// Validate checks the parameters are complete and their costs bounded.
+func (p *DeriveParams) Validate() error {
+	_, _, err := p.argon2()
+	return err
+}
+
+// argon2 validates the parameters and returns the argon2id salt and
+// parameters to derive with.
+func (p *DeriveParams) argon2() ([]byte, *DeriveParams, error) {
+	switch p.Version {
+	case DeriveVersion1:
+		v1 := DeriveParamsV1()
+		if (p.Salt != "" || p.Time != 0 || p.Memory != 0 || p.Threads != 0) &&
+			(p.Salt != v1.Salt || p.Time != v1.Time || p.Memory != v1.Memory || p.Threads != v1.Threads) {
+			return nil, nil, fmt.Errorf("version %d parameters are fixed", DeriveVersion1)
+		}
+		return argon2_derive_salt, v1, nil
+	case DeriveVersion2:
+	default:
+		return nil, nil, fmt.Errorf("unsupported derivation version %d", p.Version)
+	}
+	salt, err := hex.DecodeString(p.Salt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid salt, %v", err)
+	}
+	if len(salt) < minSaltLen {
+		return nil, nil, fmt.Errorf("salt must be at least %d bytes", minSaltLen)
+	}
+	if p.Time < 1 || p.Time > maxArgon2Time {
+		return nil, nil, fmt.Errorf("argon2 time must be between 1 and %d", maxArgon2Time)
+	}
+	if p.Threads < 1 {
+		return nil, nil, errors.New("argon2 threads must be at least 1")
+	}
+	if p.Memory < 8*uint32(p.Threads) || p.Memory > maxArgon2Memory {
+		return nil, nil, fmt.Errorf("argon2 memory must be between 8 KiB per thread and %d KiB", maxArgon2Memory)
+	}
+	return salt, p, nil
+}
+
+// keyCheck returns the key check value of pub.
+func keyCheck(pub *PublicKey) string {
+	h := sha256.New()
+	h.Write([]byte("ecies derive key check"))
+	h.Write(marshalPoint(pub.Curve, pub.X, pub.Y, false))
+	return hex.EncodeToString(h.Sum(nil)[:keyCheckLen])
+}
+
+// DeriveKeyPair derives a keypair from a password with params. It returns
+// the parameters with their key check value set, when params already has
+// one the derived key must match it.
+func DeriveKeyPair(password string, params *DeriveParams) (*PrivateKey, *DeriveParams, error) {
 	if len(password) < min_len {
-		return nil, errors.New("need a strong password, at least 12 characters")
+		return nil, nil, errors.New("need a strong password, at least 12 characters")
+	}
+	salt, costs, err := params.argon2()
+	if err != nil {
+		return nil, nil, err
+	}
+	prv, err := GenerateKey(newDeriveReader([]byte(password), salt, costs), DefaultCurve, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	check := keyCheck(&prv.PublicKey)
+	if params.KeyCheck != "" && params.KeyCheck != check {
+		return nil, nil, ErrKeyCheck
 	}
-	return GenerateKey(newDeriveReader([]byte(password)), DefaultCurve, nil)
+	record := *params
+	record.KeyCheck = check
+	return prv, &record, nil
+}
+
+// DeriveKeyPairAccordingPasswords derive a keypair by an user inputed password
+func DeriveKeyPairAccordingPasswords(password string) (prv *PrivateKey, err error) {
+	prv, _, err = DeriveKeyPair(password, DeriveParamsV1())
+	return prv, err
 }
 
 // deriveReader implements io.Reader for deriving key,
@@ -35,16 +165,20 @@ type deriveReader struct {
 	source     []byte
 	lastSource []byte
 	readed     int
+	salt       []byte
+	params     *DeriveParams
 }
 
-func newDeriveReader(password []byte) io.Reader {
-	rawBytes := argon2.IDKey(password, argon2_derive_salt, argon2_time, argon2_memory, argon2_threads, ecdsa_key_len)
+func newDeriveReader(password, salt []byte, params *DeriveParams) io.Reader {
+	rawBytes := argon2.IDKey(password, salt, params.Time, params.Memory, params.Threads, ecdsa_key_len)
 	lastSource := make([]byte, ecdsa_key_len)
 	copy(lastSource, rawBytes)
 	return &deriveReader{
 		source:     rawBytes,
 		lastSource: lastSource,
 		readed:     0,
+		salt:       salt,
+		params:     params,
 	}
 }
 
@@ -52,7 +186,7 @@ func (r *deriveReader) Read(p []byte) (n int, err error) {
 	if len(p) > len(r.source[r.readed:]) {
 		// if the previous value is not a valid private key of the given curve,
 		// then we continue to generates more data using the argon2id, with the `lastSource` as new password.
-		rawBytes := argon2.IDKey(r.lastSource, argon2_derive_salt, argon2_time, argon2_memory, argon2_threads, ecdsa_key_len)
+		rawBytes := argon2.IDKey(r.lastSource, r.salt, r.params.Time, r.params.Memory, r.params.Threads, ecdsa_key_len)
 		r.lastSource = rawBytes
 		r.source = append(r.source, rawBytes...)
 	}
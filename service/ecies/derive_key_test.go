@@ -2,6 +2,7 @@ package ecies
 
 import (
 	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"fmt"
 	mrand "math/rand"
@@ -83,3 +84,94 @@ func simpleNewPwd(length int) (pwd string, err error) {
 	})
 	return string(b), nil
 }
+
+// cheapDeriveParams are version 2 parameters fast enough for tests.
+func cheapDeriveParams(t *testing.T) *DeriveParams {
+	params, err := NewDeriveParams(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.Time, params.Memory, params.Threads = 1, 64, 1
+	return params
+}
+
+func TestDeriveParamsV1(t *testing.T) {
+	const password = "correct horse battery staple"
+	// derived by DeriveKeyPairAccordingPasswords before versioned parameters
+	const want = "da1c96156a3cd9ebea34cc60eb87562e937775578856b7010eaa167bb236e6e1"
+	prv, err := DeriveKeyPairAccordingPasswords(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%x", prv.D.Bytes()); got != want {
+		t.Fatalf("got %s", got)
+	}
+	// a stored version 1 record may omit the fixed parameters
+	prv2, record, err := DeriveKeyPair(password, &DeriveParams{Version: DeriveVersion1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prv2.D.Cmp(prv.D) != 0 || record.KeyCheck == "" {
+		t.Errorf("got %x, key check %q", prv2.D.Bytes(), record.KeyCheck)
+	}
+}
+
+func TestDeriveParams(t *testing.T) {
+	const password = "correct horse battery staple"
+	params := cheapDeriveParams(t)
+	prv, record, err := DeriveKeyPair(password, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.KeyCheck != "" || len(record.KeyCheck) != 2*keyCheckLen {
+		t.Fatalf("key check %q, %q", params.KeyCheck, record.KeyCheck)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := &DeriveParams{}
+	if err = json.Unmarshal(data, stored); err != nil {
+		t.Fatal(err)
+	}
+	again, _, err := DeriveKeyPair(password, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.D.Cmp(prv.D) != 0 {
+		t.Error("re-derived a different key")
+	}
+	if _, _, err = DeriveKeyPair("wrong horse battery staple", stored); err != ErrKeyCheck {
+		t.Errorf("wrong password: %v", err)
+	}
+
+	other, _, err := DeriveKeyPair(password, cheapDeriveParams(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.D.Cmp(prv.D) == 0 {
+		t.Error("different salts derived the same key")
+	}
+
+	invalid := []func(p *DeriveParams){
+		func(p *DeriveParams) { p.Version = 3 },
+		func(p *DeriveParams) { p.Salt = "abcd" },
+		func(p *DeriveParams) { p.Salt = "zz" },
+		func(p *DeriveParams) { p.Time = 0 },
+		func(p *DeriveParams) { p.Threads = 0 },
+		func(p *DeriveParams) { p.Memory = 4 },
+		func(p *DeriveParams) { p.Memory = maxArgon2Memory + 1 },
+		func(p *DeriveParams) { p.Version = DeriveVersion1 },
+	}
+	for i, mutate := range invalid {
+		p := cheapDeriveParams(t)
+		mutate(p)
+		if err = p.Validate(); err == nil {
+			t.Errorf("case %d: %+v is valid", i, p)
+		}
+	}
+	if err = DeriveParamsV1().Validate(); err != nil {
+		t.Error(err)
+	}
+}
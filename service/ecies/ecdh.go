@@ -0,0 +1,218 @@
+package ecies
+
+// This file contains the ECDH of GenerateShared. The NIST curves use
+// crypto/ecdh, secp256k1 uses a constant-time fixed window scalar
+// multiplication over the complete formulas of Renes, Costello and Batina,
+// "Complete addition formulas for prime order elliptic curves".
+//
+// The peer public key must be a point of the curve other than the point at
+// infinity. The supported curves have a cofactor of 1, so such a point is
+// in the prime order subgroup and no small subgroup confinement applies.
+
+import (
+	"crypto/ecdh"
+	"crypto/elliptic"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+var ErrInvalidPrivateKey = fmt.Errorf("ecies: invalid private key")
+
+// ecdhCurves maps the NIST curves to their crypto/ecdh implementation.
+var ecdhCurves = map[elliptic.Curve]ecdh.Curve{
+	elliptic.P256(): ecdh.P256(),
+	elliptic.P384(): ecdh.P384(),
+	elliptic.P521(): ecdh.P521(),
+}
+
+// IsSecp256k1 reports whether curve is secp256k1, whichever package
+// implements it.
+func IsSecp256k1(curve elliptic.Curve) bool {
+	params, s256 := curve.Params(), btcec.S256().Params()
+	return params.P.Cmp(s256.P) == 0 && params.B.Cmp(s256.B) == 0 &&
+		params.Gx.Cmp(s256.Gx) == 0 && params.Gy.Cmp(s256.Gy) == 0
+}
+
+// sharedX returns the fixed length x coordinate of D * pub.
+func sharedX(prv *PrivateKey, pub *PublicKey) ([]byte, error) {
+	params := pub.Curve.Params()
+	byteLen := (params.BitSize + 7) / 8
+	if pub.X == nil || pub.Y == nil ||
+		pub.X.Sign() < 0 || pub.X.Cmp(params.P) >= 0 ||
+		pub.Y.Sign() < 0 || pub.Y.Cmp(params.P) >= 0 {
+		return nil, ErrInvalidPublicKey
+	}
+	if prv.D == nil || prv.D.Sign() <= 0 || prv.D.Cmp(params.N) >= 0 {
+		return nil, ErrInvalidPrivateKey
+	}
+	if curve, ok := ecdhCurves[pub.Curve]; ok {
+		key, err := curve.NewPrivateKey(prv.D.FillBytes(make([]byte, byteLen)))
+		if err != nil {
+			return nil, ErrInvalidPrivateKey
+		}
+		point := make([]byte, 1+2*byteLen)
+		point[0] = 4
+		pub.X.FillBytes(point[1 : 1+byteLen])
+		pub.Y.FillBytes(point[1+byteLen:])
+		peer, err := curve.NewPublicKey(point)
+		if err != nil {
+			return nil, ErrInvalidPublicKey
+		}
+		z, err := key.ECDH(peer)
+		if err != nil {
+			return nil, ErrSharedKeyIsPointAtInfinity
+		}
+		return z, nil
+	}
+	if IsSecp256k1(pub.Curve) {
+		return secp256k1SharedX(prv.D, pub.X, pub.Y)
+	}
+	return nil, ErrUnsupportedECDHAlgorithm
+}
+
+// secp256k1SharedX returns the x coordinate of k * (x, y) in constant time
+// with respect to k, using a fixed 4 bit window.
+func secp256k1SharedX(k, x, y *big.Int) ([]byte, error) {
+	var px, py btcec.FieldVal
+	px.SetByteSlice(x.Bytes())
+	py.SetByteSlice(y.Bytes())
+	// y² = x³ + 7
+	var lhs, rhs btcec.FieldVal
+	lhs.SquareVal(&py).Normalize()
+	rhs.SquareVal(&px).Mul(&px).AddInt(7).Normalize()
+	if !lhs.Equals(&rhs) {
+		return nil, ErrInvalidPublicKey
+	}
+
+	var scalar [32]byte
+	k.FillBytes(scalar[:])
+	// table[i] = i * (x, y) encoded as the big endian words of X | Y | Z,
+	// table[0] is the point at infinity
+	var table [16][12]uint64
+	var t, p1 projectivePoint
+	var encoded [3 * 32]byte
+	t.y.SetInt(1)
+	p1 = projectivePoint{x: px, y: py}
+	p1.z.SetInt(1)
+	for i := range table {
+		t.normalize()
+		t.x.PutBytesUnchecked(encoded[:32])
+		t.y.PutBytesUnchecked(encoded[32:64])
+		t.z.PutBytesUnchecked(encoded[64:])
+		for w := range table[i] {
+			table[i][w] = binary.BigEndian.Uint64(encoded[8*w:])
+		}
+		t.add(&t, &p1)
+	}
+	var r projectivePoint
+	r.y.SetInt(1)
+	for i := 0; i < 64; i++ {
+		for j := 0; j < 4; j++ {
+			r.double(&r)
+		}
+		window := scalar[i/2] >> (4 * (1 - i%2)) & 0xf
+		var entry [12]uint64
+		for j := range table {
+			mask := -uint64(subtle.ConstantTimeByteEq(window, uint8(j)))
+			for w := range entry {
+				entry[w] |= table[j][w] & mask
+			}
+		}
+		for w := range entry {
+			binary.BigEndian.PutUint64(encoded[8*w:], entry[w])
+		}
+		t.x.SetByteSlice(encoded[:32])
+		t.y.SetByteSlice(encoded[32:64])
+		t.z.SetByteSlice(encoded[64:])
+		r.add(&r, &t)
+	}
+	r.z.Normalize()
+	if r.z.IsZero() {
+		return nil, ErrSharedKeyIsPointAtInfinity
+	}
+	var zInv, sx btcec.FieldVal
+	zInv.Set(&r.z).Inverse()
+	sx.Mul2(&r.x, &zInv).Normalize()
+	out := sx.Bytes()
+	return out[:], nil
+}
+
+// projectivePoint is a secp256k1 point in homogeneous projective
+// coordinates, the point at infinity is (0 : 1 : 0). Coordinates have a
+// magnitude of at most 3.
+type projectivePoint struct {
+	x, y, z btcec.FieldVal
+}
+
+func (p *projectivePoint) normalize() {
+	p.x.Normalize()
+	p.y.Normalize()
+	p.z.Normalize()
+}
+
+// double sets p = 2a with the complete doubling formulas for a = 0
+// (Algorithm 9). The comments give the magnitude of each result.
+func (p *projectivePoint) double(a *projectivePoint) {
+	var t0, t1, t2, x3, y3, z3 btcec.FieldVal
+	t0.SquareVal(&a.y)          // 1
+	z3.Set(&t0).MulInt(8)       // 8
+	t1.Mul2(&a.y, &a.z)         // 1
+	t2.SquareVal(&a.z)          // 1
+	t2.MulInt(21).Normalize()   // 1, t2 = 3b * t2
+	x3.Mul2(&t2, &z3)           // 1
+	y3.Add2(&t0, &t2)           // 2
+	z3.Mul(&t1)                 // 1
+	t1.Add2(&t2, &t2)           // 2
+	t2.Add(&t1)                 // 3
+	t0.Add(t2.Negate(3))        // 5
+	y3.Mul(&t0)                 // 1
+	y3.Add(&x3)                 // 2
+	t1.Mul2(&a.x, &a.y)         // 1
+	x3.Mul2(&t0, &t1).MulInt(2) // 2
+	p.x, p.y, p.z = x3, y3, z3
+}
+
+// add sets p = a + b with the complete addition formulas for a = 0
+// (Algorithm 7), which also handle doubling and the point at infinity.
+// p may alias a or b. The comments give the magnitude of each result.
+func (p *projectivePoint) add(a, b *projectivePoint) {
+	var t0, t1, t2, t3, t4, x3, y3, z3 btcec.FieldVal
+	t0.Mul2(&a.x, &b.x)                   // 1
+	t1.Mul2(&a.y, &b.y)                   // 1
+	t2.Mul2(&a.z, &b.z)                   // 1
+	t3.Add2(&a.x, &a.y)                   // 6
+	t4.Add2(&b.x, &b.y)                   // 6
+	t3.Mul(&t4)                           // 1
+	t4.Add2(&t0, &t1)                     // 2
+	t3.Add(t4.Negate(2))                  // 4
+	t4.Add2(&a.y, &a.z)                   // 6
+	x3.Add2(&b.y, &b.z)                   // 6
+	t4.Mul(&x3)                           // 1
+	x3.Add2(&t1, &t2)                     // 2
+	t4.Add(x3.Negate(2))                  // 4
+	x3.Add2(&a.x, &a.z)                   // 6
+	y3.Add2(&b.x, &b.z)                   // 6
+	x3.Mul(&y3)                           // 1
+	y3.Add2(&t0, &t2)                     // 2
+	y3.Negate(2).Add(&x3)                 // 4
+	x3.Add2(&t0, &t0)                     // 2
+	t0.Add(&x3)                           // 3
+	t2.MulInt(21).Normalize()             // 1, t2 = 3b * t2
+	z3.Add2(&t1, &t2)                     // 2
+	t1.Add(t2.Negate(1))                  // 3
+	y3.Normalize().MulInt(21).Normalize() // 1
+	x3.Mul2(&t4, &y3)                     // 1
+	t2.Mul2(&t3, &t1)                     // 1
+	x3.Negate(1).Add(&t2)                 // 3
+	y3.Mul(&t0)                           // 1
+	t1.Mul(&z3)                           // 1
+	y3.Add(&t1)                           // 2
+	t0.Mul(&t3)                           // 1
+	z3.Mul(&t4)                           // 1
+	z3.Add(&t0)                           // 2
+	p.x, p.y, p.z = x3, y3, z3
+}
@@ -0,0 +1,127 @@
+package ecies
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSecp256k1ScalarMult(t *testing.T) {
+	curve := btcec.S256()
+	n := curve.Params().N
+	scalars := []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3), new(big.Int).Sub(n, big.NewInt(1))}
+	for i := 0; i < 32; i++ {
+		k, err := rand.Int(rand.Reader, new(big.Int).Sub(n, big.NewInt(1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scalars = append(scalars, k.Add(k, big.NewInt(1)))
+	}
+	for _, k := range scalars {
+		prv, err := GenerateKey(rand.Reader, curve, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := secp256k1SharedX(k, prv.X, prv.Y)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, _ := curve.ScalarMult(prv.X, prv.Y, k.Bytes())
+		if want := x.FillBytes(make([]byte, 32)); !bytes.Equal(got, want) {
+			t.Fatalf("k=%x: got %x, want %x", k, got, want)
+		}
+	}
+}
+
+func TestGenerateSharedValidation(t *testing.T) {
+	for _, curve := range append(pointTestCurves, crypto.S256()) {
+		name := curve.Params().Name
+		prv1, err := GenerateKey(rand.Reader, curve, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prv2, err := GenerateKey(rand.Reader, curve, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sk1, err := prv1.GenerateShared(&prv2.PublicKey, 16, 16)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		sk2, err := prv2.GenerateShared(&prv1.PublicKey, 16, 16)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(sk1, sk2) {
+			t.Fatalf("%s: shared keys differ", name)
+		}
+
+		p := curve.Params().P
+		invalid := [][2]*big.Int{
+			{nil, nil},
+			{prv2.X, new(big.Int).Add(prv2.Y, big.NewInt(1))},
+			{new(big.Int).Add(prv2.X, p), prv2.Y},
+			{new(big.Int).Neg(prv2.X), prv2.Y},
+			{new(big.Int), new(big.Int)},
+		}
+		for _, point := range invalid {
+			pub := &PublicKey{X: point[0], Y: point[1], Curve: curve}
+			if _, err = prv1.GenerateShared(pub, 16, 16); err != ErrInvalidPublicKey {
+				t.Errorf("%s: (%v, %v) got %v", name, point[0], point[1], err)
+			}
+		}
+
+		for _, d := range []*big.Int{new(big.Int), curve.Params().N} {
+			prv := &PrivateKey{PublicKey: prv1.PublicKey, D: d}
+			if _, err = prv.GenerateShared(&prv2.PublicKey, 16, 16); err != ErrInvalidPrivateKey {
+				t.Errorf("%s: D=%v got %v", name, d, err)
+			}
+		}
+	}
+}
+
+// Benchmark the variable time scalar multiplication GenerateShared used
+// for S256 before, to compare with BenchmarkGenSharedKeyS256.
+func BenchmarkScalarMultS256(b *testing.B) {
+	prv, err := GenerateKey(rand.Reader, crypto.S256(), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		prv.Curve.ScalarMult(prv.X, prv.Y, prv.D.Bytes())
+	}
+}
+
+// Benchmark the generation of btcec S256 shared keys.
+func BenchmarkGenSharedKeyS256Btcec(b *testing.B) {
+	prv, err := GenerateKey(rand.Reader, btcec.S256(), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := prv.GenerateShared(&prv.PublicKey, 16, 16); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Benchmark the generation of P384 shared keys.
+func BenchmarkGenSharedKeyP384(b *testing.B) {
+	prv, err := GenerateKey(rand.Reader, elliptic.P384(), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := prv.GenerateShared(&prv.PublicKey, 16, 16); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -168,14 +168,15 @@ func (prv *PrivateKey) GenerateShared(pub *PublicKey, skLen, macLen int) (sk []b
 		return nil, ErrSharedKeyTooBig
 	}
 
-	x, _ := pub.Curve.ScalarMult(pub.X, pub.Y, prv.D.Bytes())
-	if x == nil {
-		return nil, ErrSharedKeyIsPointAtInfinity
+	x, err := sharedX(prv, pub)
+	if err != nil {
+		return nil, err
 	}
 
-	sk = make([]byte, skLen+macLen)
-	skBytes := x.Bytes()
-	copy(sk[len(sk)-len(skBytes):], skBytes)
+	// the whole x coordinate is the shared secret, even if skLen+macLen is
+	// shorter, as for P-521
+	sk = make([]byte, MaxSharedKeyLength(pub))
+	copy(sk[len(sk)-len(x):], x)
 	return sk, nil
 }
 
@@ -271,11 +272,15 @@ func symDecrypt(params *ECIESParams, key, ct []byte) (m []byte, err error) {
 // s1 and s2 contain shared information that is not part of the resulting
 // ciphertext. s1 is fed into key derivation, s2 is fed into the MAC. If the
 // shared information parameters aren't being used, they should be nil.
+// AEAD parameters produce a versioned ciphertext, see aead.go.
 func Encrypt(rand io.Reader, pub *PublicKey, m, s1, s2 []byte) (ct []byte, err error) {
 	params, err := pubkeyParams(pub)
 	if err != nil {
 		return nil, err
 	}
+	if params.AEAD != nil {
+		return encryptAEAD(rand, pub, params, m, s1, s2)
+	}
 
 	R, err := GenerateKey(rand, pub.Curve, params)
 	if err != nil {
@@ -297,7 +302,7 @@ func Encrypt(rand io.Reader, pub *PublicKey, m, s1, s2 []byte) (ct []byte, err e
 
 	d := messageTag(params.Hash, Km, em, s2)
 
-	Rb := elliptic.Marshal(pub.Curve, R.PublicKey.X, R.PublicKey.Y)
+	Rb := marshalPoint(pub.Curve, R.PublicKey.X, R.PublicKey.Y, params.CompressKeys)
 	ct = make([]byte, len(Rb)+len(em)+len(d))
 	copy(ct, Rb)
 	copy(ct[len(Rb):], em)
@@ -305,11 +310,16 @@ func Encrypt(rand io.Reader, pub *PublicKey, m, s1, s2 []byte) (ct []byte, err e
 	return ct, nil
 }
 
-// Decrypt decrypts an ECIES ciphertext.
+// Decrypt decrypts an ECIES ciphertext. Versioned ciphertexts are
+// decrypted with the parameters named in their header, legacy ones with
+// the parameters of the key.
 func (prv *PrivateKey) Decrypt(c, s1, s2 []byte) (m []byte, err error) {
 	if len(c) == 0 {
 		return nil, ErrInvalidMessage
 	}
+	if c[0] == headerMagic {
+		return prv.decryptAEAD(c, s1, s2)
+	}
 	params, err := pubkeyParams(&prv.PublicKey)
 	if err != nil {
 		return nil, err
@@ -326,7 +336,7 @@ func (prv *PrivateKey) Decrypt(c, s1, s2 []byte) (m []byte, err error) {
 
 	switch c[0] {
 	case 2, 3, 4:
-		rLen = (prv.PublicKey.Curve.Params().BitSize + 7) / 4
+		rLen = pointLen(prv.PublicKey.Curve, c[0] != 4)
 		if len(c) < (rLen + hLen + 1) {
 			return nil, ErrInvalidMessage
 		}
@@ -339,7 +349,7 @@ func (prv *PrivateKey) Decrypt(c, s1, s2 []byte) (m []byte, err error) {
 
 	R := new(PublicKey)
 	R.Curve = prv.PublicKey.Curve
-	R.X, R.Y = elliptic.Unmarshal(R.Curve, c[:rLen])
+	R.X, R.Y = unmarshalPoint(R.Curve, c[:rLen])
 	if R.X == nil {
 		return nil, ErrInvalidPublicKey
 	}
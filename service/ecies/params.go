@@ -43,6 +43,7 @@ import (
 	"hash"
 
 	"github.com/btcsuite/btcd/btcec/v2"
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 var (
@@ -63,6 +64,23 @@ type ECIESParams struct {
 	Cipher    func([]byte) (cipher.Block, error) // symmetric cipher
 	BlockSize int                                // block size of symmetric cipher
 	KeyLen    int                                // length of symmetric key
+
+	// AEAD is set for the AEAD parameter sets, which derive the key with
+	// HKDF and produce versioned ciphertexts, see aead.go.
+	AEAD   func([]byte) (cipher.AEAD, error)
+	Scheme byte // scheme id in the versioned ciphertext header
+
+	// CompressKeys makes Encrypt put the ephemeral public key in SEC1
+	// compressed form. Decrypt accepts both forms.
+	CompressKeys bool
+}
+
+// WithCompressedKeys returns a copy of params that compresses ephemeral
+// public keys.
+func (params *ECIESParams) WithCompressedKeys() *ECIESParams {
+	compressed := *params
+	compressed.CompressKeys = true
+	return &compressed
 }
 
 // Standard ECIES parameters:
@@ -113,6 +131,71 @@ var (
 	}
 )
 
+// AEAD ECIES parameters:
+// * ECIES using HKDF-SHA-256 and AES256-GCM
+// * ECIES using HKDF-SHA-256 and ChaCha20-Poly1305
+
+const (
+	SchemeAES256GCM        byte = 1
+	SchemeChaCha20Poly1305 byte = 2
+)
+
+var (
+	ECIES_AES256GCM_HKDF_SHA256 = &ECIESParams{
+		Hash:     sha256.New,
+		hashAlgo: crypto.SHA256,
+		KeyLen:   32,
+		AEAD:     newGCM,
+		Scheme:   SchemeAES256GCM,
+	}
+
+	ECIES_CHACHA20POLY1305_HKDF_SHA256 = &ECIESParams{
+		Hash:     sha256.New,
+		hashAlgo: crypto.SHA256,
+		KeyLen:   chacha20poly1305.KeySize,
+		AEAD:     chacha20poly1305.New,
+		Scheme:   SchemeChaCha20Poly1305,
+	}
+)
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+var paramsFromScheme = map[byte]*ECIESParams{
+	SchemeAES256GCM:        ECIES_AES256GCM_HKDF_SHA256,
+	SchemeChaCha20Poly1305: ECIES_CHACHA20POLY1305_HKDF_SHA256,
+}
+
+// ParamsFromScheme returns the AEAD parameters of a ciphertext header
+// scheme id, nil if unknown.
+func ParamsFromScheme(scheme byte) *ECIESParams {
+	return paramsFromScheme[scheme]
+}
+
+var paramsFromName = map[string]*ECIESParams{
+	"aes-256-gcm":       ECIES_AES256GCM_HKDF_SHA256,
+	"chacha20-poly1305": ECIES_CHACHA20POLY1305_HKDF_SHA256,
+}
+
+// ParamsFromName returns the AEAD parameters named aes-256-gcm or
+// chacha20-poly1305. The legacy name, or an empty one, returns nil, which
+// selects the AES-CTR and HMAC parameters of the curve.
+func ParamsFromName(name string) (*ECIESParams, error) {
+	if name == "" || name == "legacy" {
+		return nil, nil
+	}
+	params, ok := paramsFromName[name]
+	if !ok {
+		return nil, fmt.Errorf("ecies: unknown scheme %q", name)
+	}
+	return params, nil
+}
+
 var paramsFromCurve = map[elliptic.Curve]*ECIESParams{
 	btcec.S256():    ECIES_AES128_SHA256,
 	elliptic.P256(): ECIES_AES128_SHA256,
@@ -127,7 +210,10 @@ func AddParamsForCurve(curve elliptic.Curve, params *ECIESParams) {
 // ParamsFromCurve selects parameters optimal for the selected elliptic curve.
 // Only the curves P256, P384, and P512 are supported.
 func ParamsFromCurve(curve elliptic.Curve) (params *ECIESParams) {
-	return paramsFromCurve[curve]
+	if params = paramsFromCurve[curve]; params == nil && IsSecp256k1(curve) {
+		params = paramsFromCurve[btcec.S256()]
+	}
+	return params
 }
 
 func pubkeyParams(key *PublicKey) (*ECIESParams, error) {
@@ -0,0 +1,74 @@
+package ecies
+
+import (
+	"crypto/elliptic"
+	"math/big"
+)
+
+// pointLen returns the length of a SEC1 encoded point of curve.
+func pointLen(curve elliptic.Curve, compressed bool) int {
+	byteLen := (curve.Params().BitSize + 7) / 8
+	if compressed {
+		return 1 + byteLen
+	}
+	return 1 + 2*byteLen
+}
+
+// marshalPoint encodes a point in SEC1 form, compressed or uncompressed.
+func marshalPoint(curve elliptic.Curve, x, y *big.Int, compressed bool) []byte {
+	if compressed {
+		return elliptic.MarshalCompressed(curve, x, y)
+	}
+	return elliptic.Marshal(curve, x, y)
+}
+
+// isNIST reports whether curve is a NIST curve, whose a coefficient is -3.
+func isNIST(curve elliptic.Curve) bool {
+	switch curve {
+	case elliptic.P224(), elliptic.P256(), elliptic.P384(), elliptic.P521():
+		return true
+	}
+	return false
+}
+
+// unmarshalPoint decodes a SEC1 point in either form. Compressed points are
+// supported for the NIST curves and for curves with a zero a coefficient,
+// such as secp256k1. x is nil if data is not a point of curve.
+func unmarshalPoint(curve elliptic.Curve, data []byte) (x, y *big.Int) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	switch data[0] {
+	case 4:
+		return elliptic.Unmarshal(curve, data)
+	case 2, 3:
+		if isNIST(curve) {
+			return elliptic.UnmarshalCompressed(curve, data)
+		}
+	default:
+		return nil, nil
+	}
+	params := curve.Params()
+	if len(data) != pointLen(curve, true) {
+		return nil, nil
+	}
+	x = new(big.Int).SetBytes(data[1:])
+	if x.Cmp(params.P) >= 0 {
+		return nil, nil
+	}
+	// y² = x³ + b
+	y = new(big.Int).Mul(x, x)
+	y.Mul(y, x)
+	y.Add(y, params.B)
+	y.Mod(y, params.P)
+	if y.ModSqrt(y, params.P) == nil {
+		return nil, nil
+	}
+	if byte(y.Bit(0)) != data[0]&1 {
+		y.Sub(params.P, y)
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, nil
+	}
+	return x, y
+}
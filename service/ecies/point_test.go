@@ -0,0 +1,89 @@
+package ecies
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+var pointTestCurves = []elliptic.Curve{DefaultCurve, elliptic.P256(), elliptic.P384(), elliptic.P521()}
+
+func TestPointEncoding(t *testing.T) {
+	for _, curve := range pointTestCurves {
+		prefixes := make(map[byte]bool)
+		for i := 0; i < 16; i++ {
+			prv, err := GenerateKey(rand.Reader, curve, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, compressed := range []bool{false, true} {
+				data := marshalPoint(curve, prv.X, prv.Y, compressed)
+				if len(data) != pointLen(curve, compressed) {
+					t.Fatalf("%s: got %d bytes", curve.Params().Name, len(data))
+				}
+				prefixes[data[0]] = true
+				x, y := unmarshalPoint(curve, data)
+				if x == nil || x.Cmp(prv.X) != 0 || y.Cmp(prv.Y) != 0 {
+					t.Fatalf("%s: %x does not round trip", curve.Params().Name, data)
+				}
+			}
+		}
+		if !prefixes[2] || !prefixes[3] || !prefixes[4] {
+			t.Errorf("%s: prefixes %v not all covered", curve.Params().Name, prefixes)
+		}
+
+		invalid := [][]byte{
+			nil,
+			{2},
+			append([]byte{5}, make([]byte, pointLen(curve, true)-1)...),
+			// x = p is not a field element
+			append([]byte{2}, curve.Params().P.FillBytes(make([]byte, pointLen(curve, true)-1))...),
+		}
+		for _, data := range invalid {
+			if x, _ := unmarshalPoint(curve, data); x != nil {
+				t.Errorf("%s: invalid point %x accepted", curve.Params().Name, data)
+			}
+		}
+	}
+}
+
+func TestEncryptDecryptCompressed(t *testing.T) {
+	message := []byte("Hello, world.")
+	for _, curve := range pointTestCurves {
+		prv, err := GenerateKey(rand.Reader, curve, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, params := range []*ECIESParams{ParamsFromCurve(curve), ECIES_AES256GCM_HKDF_SHA256} {
+			for _, compressed := range []bool{false, true} {
+				pub := prv.PublicKey
+				pub.Params = params
+				if compressed {
+					pub.Params = params.WithCompressedKeys()
+				}
+				ct, err := Encrypt(rand.Reader, &pub, message, nil, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r := ct
+				if params.AEAD != nil {
+					r = ct[headerLen:]
+				}
+				if compressed != (r[0] != 4) {
+					t.Errorf("%s: ephemeral key prefix %d", curve.Params().Name, r[0])
+				}
+				pt, err := prv.Decrypt(ct, nil, nil)
+				if err != nil {
+					t.Fatalf("%s compressed %v: %v", curve.Params().Name, compressed, err)
+				}
+				if !bytes.Equal(pt, message) {
+					t.Fatal("ecies: plaintext doesn't match message")
+				}
+			}
+		}
+	}
+	if ECIES_AES128_SHA256.CompressKeys {
+		t.Error("WithCompressedKeys changed the shared parameters")
+	}
+}
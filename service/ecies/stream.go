@@ -0,0 +1,378 @@
+package ecies
+
+// This file contains streaming ECIES. The key is agreed and derived as for
+// the AEAD ciphertexts of aead.go, the message is then sealed in segments
+// of at most SegmentSize bytes:
+//
+//	0xec | VersionStream | scheme | R | nonce prefix | segment...
+//	segment: length | sealed segment
+//
+// length is the big endian uint32 length of the sealed segment, its top bit
+// set on the final segment. The nonce of a segment is the nonce prefix
+// followed by the big endian uint32 segment counter and a byte set to 1 on
+// the final segment, so reordered, dropped or duplicated segments fail to
+// open and a stream without its final segment is reported as truncated.
+//
+// Streams can be concatenated: a DecryptStream reader stops after the final
+// segment, leaving what follows in the *bufio.Reader it was given. A
+// segment is only consumed once it is authenticated, a reader failing on a
+// segment leaves it in the *bufio.Reader, where the next stream may be
+// looked for.
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	VersionStream = 2
+	// SegmentSize is the largest plaintext segment of a stream.
+	SegmentSize = 64 * 1024
+
+	// StreamBufferSize is the *bufio.Reader size DecryptStream needs to
+	// peek at a whole sealed segment.
+	StreamBufferSize = 4 + SegmentSize + segmentOverhead
+
+	finalSegment    = 1 << 31
+	segmentTrailer  = 5  // counter and final flag
+	segmentOverhead = 16 // tag of the AEAD schemes
+)
+
+var (
+	ErrTruncated    = fmt.Errorf("ecies: truncated stream")
+	errStreamClosed = fmt.Errorf("ecies: stream is closed")
+)
+
+// StreamWriter encrypts a stream, see EncryptStream.
+type StreamWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	ad      []byte
+	nonce   []byte
+	counter uint32
+	buf     []byte
+	err     error
+}
+
+// StreamReader decrypts a stream, see DecryptStream.
+type StreamReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	ad      []byte
+	nonce   []byte
+	counter uint32
+	plain   []byte
+	buf     []byte
+	done    bool
+	err     error
+}
+
+func newStreamWriter(rand io.Reader, params *ECIESParams, z, R []byte, w io.Writer, s1, s2 []byte) (*StreamWriter, error) {
+	header := []byte{headerMagic, VersionStream, params.Scheme}
+	key, err := aeadKey(params, z, R, header, s1)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := params.AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	prefix := nonce[:len(nonce)-segmentTrailer]
+	if _, err = io.ReadFull(rand, prefix); err != nil {
+		return nil, err
+	}
+	start := make([]byte, 0, len(header)+len(R)+len(prefix))
+	start = append(append(append(start, header...), R...), prefix...)
+	if _, err = w.Write(start); err != nil {
+		return nil, err
+	}
+	return &StreamWriter{
+		w:     w,
+		aead:  aead,
+		ad:    additionalData(header, s2),
+		nonce: nonce,
+		buf:   make([]byte, 0, SegmentSize),
+	}, nil
+}
+
+// Write buffers p and seals every full segment.
+func (s *StreamWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(s.buf) == SegmentSize {
+			if err := s.seal(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(s.buf[len(s.buf):SegmentSize], p)
+		s.buf = s.buf[:len(s.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Flush seals the buffered data, if any, as a segment shorter than
+// SegmentSize, so that it reaches the underlying writer.
+func (s *StreamWriter) Flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	if len(s.buf) == 0 {
+		return nil
+	}
+	return s.seal(false)
+}
+
+// Close seals the final segment. It does not close the underlying writer.
+func (s *StreamWriter) Close() error {
+	if s.err == errStreamClosed {
+		return nil
+	}
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.seal(true); err != nil {
+		return err
+	}
+	s.err = errStreamClosed
+	return nil
+}
+
+func (s *StreamWriter) seal(final bool) error {
+	if s.counter == math.MaxUint32 {
+		s.err = fmt.Errorf("ecies: stream has too many segments")
+		return s.err
+	}
+	segmentNonce(s.nonce, s.counter, final)
+	out := make([]byte, 4, 4+len(s.buf)+s.aead.Overhead())
+	out = s.aead.Seal(out, s.nonce, s.buf, s.ad)
+	length := uint32(len(out) - 4)
+	if final {
+		length |= finalSegment
+	}
+	binary.BigEndian.PutUint32(out, length)
+	if _, err := s.w.Write(out); err != nil {
+		s.err = err
+		return err
+	}
+	s.counter++
+	s.buf = s.buf[:0]
+	return nil
+}
+
+func segmentNonce(nonce []byte, counter uint32, final bool) {
+	trailer := nonce[len(nonce)-segmentTrailer:]
+	binary.BigEndian.PutUint32(trailer, counter)
+	trailer[4] = 0
+	if final {
+		trailer[4] = 1
+	}
+}
+
+// IsStreamHeader reports whether b starts with the header of a stream of
+// known parameters.
+func IsStreamHeader(b []byte) bool {
+	return len(b) >= headerLen && b[0] == headerMagic && b[1] == VersionStream && ParamsFromScheme(b[2]) != nil
+}
+
+// readStreamHeader reads the header of a stream and returns its parameters.
+func readStreamHeader(r *bufio.Reader) ([]byte, *ECIESParams, error) {
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, ErrInvalidMessage
+	}
+	if header[0] != headerMagic {
+		return nil, nil, ErrInvalidMessage
+	}
+	if header[1] != VersionStream {
+		return nil, nil, ErrUnsupportedVersion
+	}
+	params := ParamsFromScheme(header[2])
+	if params == nil {
+		return nil, nil, ErrUnsupportedECIESParameters
+	}
+	return header, params, nil
+}
+
+func newStreamReader(r *bufio.Reader, params *ECIESParams, header, z, R, s1, s2 []byte) (*StreamReader, error) {
+	key, err := aeadKey(params, z, R, header, s1)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := params.AEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(r, nonce[:len(nonce)-segmentTrailer]); err != nil {
+		return nil, ErrInvalidMessage
+	}
+	return &StreamReader{
+		r:     r,
+		aead:  aead,
+		ad:    additionalData(header, s2),
+		nonce: nonce,
+	}, nil
+}
+
+// Read returns decrypted data. Data is only returned once its segment is
+// authenticated, io.EOF once the final segment was read and ErrTruncated
+// when the stream ends, or another stream starts, before its final segment.
+func (s *StreamReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.err = s.open()
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+func (s *StreamReader) open() error {
+	prefix, err := s.r.Peek(4)
+	if len(prefix) > 0 && prefix[0] == headerMagic {
+		return ErrTruncated
+	}
+	if err != nil {
+		return truncated(err)
+	}
+	length := binary.BigEndian.Uint32(prefix)
+	final := length&finalSegment != 0
+	length &^= finalSegment
+	if length < uint32(s.aead.Overhead()) || length > uint32(SegmentSize+s.aead.Overhead()) {
+		return ErrInvalidMessage
+	}
+	segment, err := s.r.Peek(4 + int(length))
+	if err != nil {
+		return truncated(err)
+	}
+	if s.plain == nil {
+		s.plain = make([]byte, 0, SegmentSize)
+	}
+	// the segment is opened out of place, it stays intact when it fails
+	segmentNonce(s.nonce, s.counter, final)
+	m, err := s.aead.Open(s.plain[:0], s.nonce, segment[4:], s.ad)
+	if err != nil {
+		return ErrInvalidMessage
+	}
+	if _, err = s.r.Discard(len(segment)); err != nil {
+		return err
+	}
+	s.counter++
+	s.buf = m
+	s.done = final
+	return nil
+}
+
+// truncated maps the end of the input within a segment to ErrTruncated.
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
+
+// EncryptStream writes the header of a stream encrypted for pub to w and
+// returns the writer of its plaintext, which must be closed to seal the
+// final segment. params must be AEAD parameters,
+// ECIES_AES256GCM_HKDF_SHA256 if nil. s1 and s2 are used as in Encrypt.
+func EncryptStream(rand io.Reader, pub *PublicKey, params *ECIESParams, w io.Writer, s1, s2 []byte) (*StreamWriter, error) {
+	if params == nil {
+		params = ECIES_AES256GCM_HKDF_SHA256
+	}
+	if params.AEAD == nil {
+		return nil, ErrUnsupportedECIESParameters
+	}
+	R, err := GenerateKey(rand, pub.Curve, params)
+	if err != nil {
+		return nil, err
+	}
+	z, err := R.GenerateShared(pub, MaxSharedKeyLength(pub), 0)
+	if err != nil {
+		return nil, err
+	}
+	Rb := marshalPoint(pub.Curve, R.PublicKey.X, R.PublicKey.Y, params.CompressKeys)
+	return newStreamWriter(rand, params, z, Rb, w, s1, s2)
+}
+
+// DecryptStream reads the header of a stream of EncryptStream from r and
+// returns the reader of its plaintext. Unless r is a *bufio.Reader of at
+// least StreamBufferSize bytes, data following the stream may be consumed.
+func (prv *PrivateKey) DecryptStream(r io.Reader, s1, s2 []byte) (*StreamReader, error) {
+	br := bufio.NewReaderSize(r, StreamBufferSize)
+	header, params, err := readStreamHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	first, err := br.Peek(1)
+	if err != nil || (first[0] != 2 && first[0] != 3 && first[0] != 4) {
+		return nil, ErrInvalidPublicKey
+	}
+	Rb := make([]byte, pointLen(prv.PublicKey.Curve, first[0] != 4))
+	if _, err = io.ReadFull(br, Rb); err != nil {
+		return nil, ErrInvalidMessage
+	}
+	R := new(PublicKey)
+	R.Curve = prv.PublicKey.Curve
+	R.X, R.Y = unmarshalPoint(R.Curve, Rb)
+	if R.X == nil {
+		return nil, ErrInvalidPublicKey
+	}
+	z, err := prv.GenerateShared(R, MaxSharedKeyLength(R), 0)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamReader(br, params, header, z, Rb, s1, s2)
+}
+
+// EncryptStreamX25519 is EncryptStream for an X25519 public key.
+func EncryptStreamX25519(rand io.Reader, pub X25519PublicKey, params *ECIESParams, w io.Writer, s1, s2 []byte) (*StreamWriter, error) {
+	if params == nil {
+		params = ECIES_AES256GCM_HKDF_SHA256
+	}
+	if params.AEAD == nil {
+		return nil, ErrUnsupportedECIESParameters
+	}
+	R, err := GenerateX25519Key(rand)
+	if err != nil {
+		return nil, err
+	}
+	z, err := x25519(R, pub)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamWriter(rand, params, z, R.Public(), w, s1, s2)
+}
+
+// DecryptStream is PrivateKey.DecryptStream for a stream of
+// EncryptStreamX25519.
+func (prv X25519PrivateKey) DecryptStream(r io.Reader, s1, s2 []byte) (*StreamReader, error) {
+	br := bufio.NewReaderSize(r, StreamBufferSize)
+	header, params, err := readStreamHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	R := make(X25519PublicKey, X25519KeySize)
+	if _, err = io.ReadFull(br, R); err != nil {
+		return nil, ErrInvalidMessage
+	}
+	z, err := x25519(prv, R)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamReader(br, params, header, z, R, s1, s2)
+}
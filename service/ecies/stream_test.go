@@ -0,0 +1,156 @@
+package ecies
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func encryptStream(t *testing.T, pub *PublicKey, params *ECIESParams, parts ...[]byte) []byte {
+	var buf bytes.Buffer
+	w, err := EncryptStream(rand.Reader, pub, params, &buf, []byte("s1"), []byte("s2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range parts {
+		if _, err = w.Write(part); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStream(t *testing.T) {
+	prv := aeadTestKey()
+	for _, params := range []*ECIESParams{ECIES_AES256GCM_HKDF_SHA256, ECIES_CHACHA20POLY1305_HKDF_SHA256.WithCompressedKeys()} {
+		for _, size := range []int{0, 1, SegmentSize - 1, SegmentSize, SegmentSize + 1, 3*SegmentSize + 100} {
+			message := make([]byte, size)
+			rand.Read(message)
+			ct := encryptStream(t, &prv.PublicKey, params, message)
+			if ct[0] != headerMagic || ct[1] != VersionStream || ct[2] != params.Scheme {
+				t.Fatalf("unexpected header %x", ct[:headerLen])
+			}
+			r, err := prv.DecryptStream(bytes.NewReader(ct), []byte("s1"), []byte("s2"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("size %d: %v", size, err)
+			}
+			if !bytes.Equal(m, message) {
+				t.Fatalf("size %d: message mismatch", size)
+			}
+			if _, err = prv.Decrypt(ct, []byte("s1"), []byte("s2")); err != ErrUnsupportedVersion {
+				t.Errorf("Decrypt of a stream: %v", err)
+			}
+		}
+	}
+
+	x := X25519PrivateKey(decode("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a"))
+	var buf bytes.Buffer
+	w, err := EncryptStreamX25519(rand.Reader, x.Public(), nil, &buf, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("Hello, world."))
+	w.Close()
+	r, err := x.DecryptStream(&buf, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, err := io.ReadAll(r); err != nil || string(m) != "Hello, world." {
+		t.Errorf("got %q, %v", m, err)
+	}
+}
+
+// segments splits a stream of the test key into its start and segments.
+func segments(ct []byte) ([]byte, [][]byte) {
+	start := headerLen + pointLen(DefaultCurve, false) + 12 - segmentTrailer
+	var segs [][]byte
+	for rest := ct[start:]; len(rest) > 0; {
+		n := 4 + int(binary.BigEndian.Uint32(rest)&^finalSegment)
+		segs = append(segs, rest[:n])
+		rest = rest[n:]
+	}
+	return ct[:start], segs
+}
+
+func TestStreamTampering(t *testing.T) {
+	prv := aeadTestKey()
+	ct := encryptStream(t, &prv.PublicKey, nil, []byte("one\n"), []byte("two\n"), []byte("three\n"))
+	start, segs := segments(ct)
+	if len(segs) != 4 {
+		t.Fatalf("got %d segments", len(segs))
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(append([][]byte{start}, parts...), nil)
+	}
+	flip := append([]byte{}, segs[1]...)
+	flip[len(flip)-1] ^= 1
+	notFinal := append([]byte{}, segs[3]...)
+	notFinal[0] &^= 0x80
+	cases := []struct {
+		name string
+		ct   []byte
+		want error
+	}{
+		{"truncated", join(segs[0], segs[1], segs[2]), ErrTruncated},
+		{"cut segment", ct[:len(ct)-1], ErrTruncated},
+		{"reordered", join(segs[1], segs[0], segs[2], segs[3]), ErrInvalidMessage},
+		{"dropped", join(segs[0], segs[2], segs[3]), ErrInvalidMessage},
+		{"duplicated", join(segs[0], segs[0], segs[1], segs[2], segs[3]), ErrInvalidMessage},
+		{"modified", join(segs[0], flip, segs[2], segs[3]), ErrInvalidMessage},
+		{"final flag removed", join(segs[0], segs[1], segs[2], notFinal), ErrInvalidMessage},
+		{"early final", join(segs[3]), ErrInvalidMessage},
+	}
+	for _, c := range cases {
+		r, err := prv.DecryptStream(bytes.NewReader(c.ct), []byte("s1"), []byte("s2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = io.ReadAll(r); err != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+	if r, err := prv.DecryptStream(bytes.NewReader(ct), nil, []byte("s2")); err == nil {
+		if _, err = io.ReadAll(r); err != ErrInvalidMessage {
+			t.Errorf("decrypted with a wrong s1: %v", err)
+		}
+	}
+}
+
+func TestStreamConcatenated(t *testing.T) {
+	prv := aeadTestKey()
+	first := encryptStream(t, &prv.PublicKey, nil, []byte("one\n"))
+	second := encryptStream(t, &prv.PublicKey, nil, []byte("two\n"))
+	// the first stream was never closed
+	_, segs := segments(first)
+	unclosed := first[:len(first)-len(segs[len(segs)-1])]
+
+	r := bufio.NewReaderSize(bytes.NewReader(bytes.Join([][]byte{first, unclosed, second}, nil)), StreamBufferSize)
+	for _, want := range []struct {
+		m   string
+		err error
+	}{{"one\n", nil}, {"one\n", ErrTruncated}, {"two\n", nil}} {
+		s, err := prv.DecryptStream(r, []byte("s1"), []byte("s2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m, err := io.ReadAll(s); string(m) != want.m || err != want.err {
+			t.Errorf("got %q, %v, want %q, %v", m, err, want.m, want.err)
+		}
+	}
+	if _, err := r.Peek(1); err != io.EOF {
+		t.Errorf("trailing data: %v", err)
+	}
+}
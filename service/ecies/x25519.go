@@ -0,0 +1,93 @@
+package ecies
+
+// This file contains ECIES over Curve25519: X25519 key agreement followed by
+// the HKDF and AEAD construction of aead.go. The ciphertext format is the
+// versioned one with a 32 byte ephemeral public key as R.
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+const X25519KeySize = curve25519.ScalarSize
+
+var ErrInvalidX25519Key = fmt.Errorf("ecies: invalid X25519 key")
+
+// X25519PublicKey is a Curve25519 public key.
+type X25519PublicKey []byte
+
+// X25519PrivateKey is a Curve25519 private key (scalar).
+type X25519PrivateKey []byte
+
+// GenerateX25519Key generates a Curve25519 private key.
+func GenerateX25519Key(rand io.Reader) (X25519PrivateKey, error) {
+	key := make(X25519PrivateKey, X25519KeySize)
+	if _, err := io.ReadFull(rand, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Public returns the public key of prv.
+func (prv X25519PrivateKey) Public() X25519PublicKey {
+	pub, _ := curve25519.X25519(prv, curve25519.Basepoint)
+	return pub
+}
+
+// Equal reports whether pub and x are the same key.
+func (pub X25519PublicKey) Equal(x X25519PublicKey) bool {
+	return subtle.ConstantTimeCompare(pub, x) == 1
+}
+
+// x25519 computes the shared secret, rejecting low order points.
+func x25519(prv X25519PrivateKey, pub X25519PublicKey) ([]byte, error) {
+	if len(prv) != X25519KeySize || len(pub) != X25519KeySize {
+		return nil, ErrInvalidX25519Key
+	}
+	z, err := curve25519.X25519(prv, pub)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	return z, nil
+}
+
+// EncryptX25519 encrypts m for pub with the AEAD parameters params,
+// ECIES_AES256GCM_HKDF_SHA256 if nil. s1 and s2 are used as in Encrypt.
+func EncryptX25519(rand io.Reader, pub X25519PublicKey, params *ECIESParams, m, s1, s2 []byte) ([]byte, error) {
+	if params == nil {
+		params = ECIES_AES256GCM_HKDF_SHA256
+	}
+	if params.AEAD == nil {
+		return nil, ErrUnsupportedECIESParameters
+	}
+	R, err := GenerateX25519Key(rand)
+	if err != nil {
+		return nil, err
+	}
+	z, err := x25519(R, pub)
+	if err != nil {
+		return nil, err
+	}
+	return sealAEAD(rand, params, z, R.Public(), m, s1, s2)
+}
+
+// Decrypt decrypts a ciphertext of EncryptX25519.
+func (prv X25519PrivateKey) Decrypt(c, s1, s2 []byte) ([]byte, error) {
+	header, params, err := parseHeader(c)
+	if err != nil {
+		return nil, err
+	}
+	c = c[headerLen:]
+	if len(c) < X25519KeySize {
+		return nil, ErrInvalidMessage
+	}
+	R := X25519PublicKey(c[:X25519KeySize])
+	z, err := x25519(prv, R)
+	if err != nil {
+		return nil, err
+	}
+	return openAEAD(params, header, z, R, c[X25519KeySize:], s1, s2)
+}
@@ -0,0 +1,64 @@
+package ecies
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+// TestX25519Vectors decrypts "Hello, world." encrypted with s1 "s1" and s2
+// "s2" for the RFC 7748 test key of Alice. The vectors were checked against
+// node crypto (diffieHellman, hkdfSync and createDecipheriv).
+func TestX25519Vectors(t *testing.T) {
+	prv := X25519PrivateKey(decode("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a"))
+	if !prv.Public().Equal(decode("8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")) {
+		t.Fatalf("unexpected public key %x", prv.Public())
+	}
+	vectors := []string{
+		"ec01017b4e909bbe7ffe44c465a220037d608ee35897d31ef972f07f74892cb0f73f13222222222222222222222222b2aab790ebd62d021aaac6aab487c914d8867f5ba384a53a797b46e36a",
+		"ec01027b4e909bbe7ffe44c465a220037d608ee35897d31ef972f07f74892cb0f73f13222222222222222222222222812a02200fe89a28f001141fcab8982e835a6d14891ad66be6d9d30df2",
+	}
+	for _, vector := range vectors {
+		m, err := prv.Decrypt(decode(vector), []byte("s1"), []byte("s2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(m) != "Hello, world." {
+			t.Errorf("got %q", m)
+		}
+	}
+}
+
+func TestX25519EncryptDecrypt(t *testing.T) {
+	prv, err := GenerateX25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := GenerateX25519Key(rand.Reader)
+	message := []byte("Hello, world.")
+	for _, params := range []*ECIESParams{nil, ECIES_CHACHA20POLY1305_HKDF_SHA256} {
+		ct, err := EncryptX25519(rand.Reader, prv.Public(), params, message, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pt, err := prv.Decrypt(ct, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pt, message) {
+			t.Fatal("ecies: plaintext doesn't match message")
+		}
+		if _, err = other.Decrypt(ct, nil, nil); err != ErrInvalidMessage {
+			t.Errorf("decrypted with the wrong key: %v", err)
+		}
+	}
+	if _, err = EncryptX25519(rand.Reader, prv.Public(), ECIES_AES128_SHA256, message, nil, nil); err != ErrUnsupportedECIESParameters {
+		t.Errorf("non AEAD parameters: %v", err)
+	}
+	// a low order ephemeral key yields an all zero shared secret
+	ct, _ := EncryptX25519(rand.Reader, prv.Public(), nil, message, nil, nil)
+	copy(ct[headerLen:], make([]byte, X25519KeySize))
+	if _, err = prv.Decrypt(ct, nil, nil); err != ErrInvalidPublicKey {
+		t.Errorf("low order point: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"net/http"
+)
+
+// StatusSuccess is the Response.Status of every successful reply.
+const StatusSuccess = "0"
+
+// APIError is an entry of the error catalogue returned to the mpc-node.
+// Code is stable across releases and is what clients should match on,
+// Message is informational only.
+type APIError struct {
+	Code       string
+	HTTPStatus int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	ErrInternal         = &APIError{Code: "1000", HTTPStatus: http.StatusInternalServerError, Message: "internal error"}
+	ErrSignatureMissing = &APIError{Code: "1001", HTTPStatus: http.StatusBadRequest, Message: "signature not found"}
+	ErrSignatureBadHex  = &APIError{Code: "1002", HTTPStatus: http.StatusBadRequest, Message: "signature is not valid hex"}
+	ErrBadSignature     = &APIError{Code: "1003", HTTPStatus: http.StatusUnauthorized, Message: "verify signature failed"}
+	ErrMalformedBody    = &APIError{Code: "1004", HTTPStatus: http.StatusBadRequest, Message: "malformed request body"}
+	ErrDecryptFailed    = &APIError{Code: "1005", HTTPStatus: http.StatusUnprocessableEntity, Message: "decrypt signature failed"}
+	ErrPolicy           = &APIError{Code: "1006", HTTPStatus: http.StatusInternalServerError, Message: "policy evaluation failed"}
+	ErrUnauthorized     = &APIError{Code: "1007", HTTPStatus: http.StatusUnauthorized, Message: "admin token missing or invalid"}
+	ErrNotFound         = &APIError{Code: "1008", HTTPStatus: http.StatusNotFound, Message: "not found"}
+	ErrConflict         = &APIError{Code: "1009", HTTPStatus: http.StatusConflict, Message: "conflicts with the current state"}
+)
+
+// ErrorCatalogue lists every APIError the callback server may return.
+var ErrorCatalogue = []*APIError{
+	ErrInternal,
+	ErrSignatureMissing,
+	ErrSignatureBadHex,
+	ErrBadSignature,
+	ErrMalformedBody,
+	ErrDecryptFailed,
+	ErrPolicy,
+	ErrUnauthorized,
+	ErrNotFound,
+	ErrConflict,
+}
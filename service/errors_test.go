@@ -0,0 +1,73 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errorCode returns the status of an error Response and checks it is
+// signed by the callback server.
+func (s *testService) errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	response := &Response{}
+	if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	message, err := json.Marshal(&ErrorData{Status: response.Status, Error: response.Error})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(&s.key.PublicKey, hex.EncodeToString(message), response.Signature) {
+		t.Errorf("error response %s is not signed by the callback server", response.Status)
+	}
+	return response.Status
+}
+
+func TestErrorCatalogue(t *testing.T) {
+	tests := []struct {
+		err        *APIError
+		code       string
+		httpStatus int
+	}{
+		{ErrInternal, "1000", http.StatusInternalServerError},
+		{ErrSignatureMissing, "1001", http.StatusBadRequest},
+		{ErrSignatureBadHex, "1002", http.StatusBadRequest},
+		{ErrBadSignature, "1003", http.StatusUnauthorized},
+		{ErrMalformedBody, "1004", http.StatusBadRequest},
+		{ErrDecryptFailed, "1005", http.StatusUnprocessableEntity},
+		{ErrPolicy, "1006", http.StatusInternalServerError},
+		{ErrUnauthorized, "1007", http.StatusUnauthorized},
+		{ErrNotFound, "1008", http.StatusNotFound},
+		{ErrConflict, "1009", http.StatusConflict},
+	}
+	if len(ErrorCatalogue) != len(tests) {
+		t.Fatalf("catalogue has %d errors, want %d", len(ErrorCatalogue), len(tests))
+	}
+
+	s := newTestService(t, &CallbackServiceConfig{})
+	for i, tt := range tests {
+		if ErrorCatalogue[i] != tt.err {
+			t.Errorf("catalogue entry %d is %v, want %v", i, ErrorCatalogue[i], tt.err)
+		}
+		if tt.err.Code != tt.code || tt.err.HTTPStatus != tt.httpStatus || tt.err.Message == "" {
+			t.Errorf("%v: got code %s status %d, want %s %d", tt.err, tt.err.Code, tt.err.HTTPStatus, tt.code, tt.httpStatus)
+		}
+
+		r := gin.New()
+		r.GET("/fail", func(g *gin.Context) {
+			s.fail(g, tt.err, nil)
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fail", nil))
+		if w.Code != tt.httpStatus {
+			t.Errorf("%v: got HTTP status %d", tt.err, w.Code)
+		}
+		if code := s.errorCode(t, w); code != tt.code {
+			t.Errorf("%v: got error %s", tt.err, code)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HardenedKeyStart is the first hardened BIP-32 child index.
+const HardenedKeyStart = 0x80000000
+
+// ParsePath parses a BIP-32 derivation path such as m/44'/60'/0'/0/1 into
+// child indexes. Hardened components end with ' or h.
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("derivation path %q does not start with m", path)
+	}
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		number, hardened := trimHardened(part)
+		index, err := strconv.ParseUint(number, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid derivation path %q", path)
+		}
+		if hardened {
+			index += HardenedKeyStart
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+func trimHardened(part string) (string, bool) {
+	if strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") || strings.HasSuffix(part, "H") {
+		return part[:len(part)-1], true
+	}
+	return part, false
+}
+
+// PathPattern matches derivation paths component by component. A pattern
+// component is an index, an inclusive range "0-99" or "*" for any index,
+// followed by ' when the component must be hardened.
+type PathPattern struct {
+	pattern    string
+	components []pathComponent
+}
+
+type pathComponent struct {
+	min, max uint32
+	hardened bool
+}
+
+func ParsePathPattern(pattern string) (*PathPattern, error) {
+	parts := strings.Split(strings.TrimSpace(pattern), "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("path pattern %q does not start with m", pattern)
+	}
+	p := &PathPattern{pattern: pattern}
+	for _, part := range parts[1:] {
+		spec, hardened := trimHardened(part)
+		c := pathComponent{max: HardenedKeyStart - 1, hardened: hardened}
+		if spec != "*" {
+			first, last := spec, spec
+			if i := strings.IndexByte(spec, '-'); i > 0 {
+				first, last = spec[:i], spec[i+1:]
+			}
+			min, err := strconv.ParseUint(first, 10, 31)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path pattern %q", pattern)
+			}
+			max, err := strconv.ParseUint(last, 10, 31)
+			if err != nil || max < min {
+				return nil, fmt.Errorf("invalid path pattern %q", pattern)
+			}
+			c.min, c.max = uint32(min), uint32(max)
+		}
+		p.components = append(p.components, c)
+	}
+	return p, nil
+}
+
+func (p *PathPattern) String() string {
+	return p.pattern
+}
+
+func (p *PathPattern) Match(path []uint32) bool {
+	if len(path) != len(p.components) {
+		return false
+	}
+	for i, index := range path {
+		c := p.components[i]
+		hardened := index >= HardenedKeyStart
+		if hardened != c.hardened {
+			return false
+		}
+		if hardened {
+			index -= HardenedKeyStart
+		}
+		if index < c.min || index > c.max {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CheckOK      = "ok"
+	CheckFailed  = "failed"
+	CheckSkipped = "skipped"
+)
+
+// ErrCheckSkipped is returned by a readiness check whose component is
+// optional and not configured; it is reported but does not fail /readyz.
+var ErrCheckSkipped = errors.New("not configured")
+
+type readinessCheck struct {
+	name  string
+	check func() error
+}
+
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ReadinessReport struct {
+	Status string         `json:"status"`
+	Checks []*CheckResult `json:"checks"`
+}
+
+type readiness struct {
+	mu     sync.RWMutex
+	checks []readinessCheck
+}
+
+// AddReadinessCheck registers an additional probe evaluated by /readyz.
+func (c *CallbackService) AddReadinessCheck(name string, check func() error) {
+	c.readiness.mu.Lock()
+	defer c.readiness.mu.Unlock()
+	c.readiness.checks = append(c.readiness.checks, readinessCheck{name: name, check: check})
+}
+
+func (c *CallbackService) registerDefaultChecks() {
+	c.AddReadinessCheck("signing_key", c.checkSigningKey)
+	c.AddReadinessCheck("mpc_node_public_key", c.checkMPCNodePublicKey)
+	c.AddReadinessCheck("decrypt_sig_key", c.checkDecryptSigKey)
+	c.AddReadinessCheck("policy", c.checkPolicy)
+	c.AddReadinessCheck("audit_log", c.checkAuditLog)
+	c.AddReadinessCheck("limit_state", c.checkLimitState)
+	c.AddReadinessCheck("address_book", c.checkAddressBook)
+	c.AddReadinessCheck("keygen_registry", c.checkKeygenRegistry)
+	c.AddReadinessCheck("key_registry", c.checkKeyRegistry)
+}
+
+// Ready runs every registered readiness check and reports whether all of
+// them passed.
+func (c *CallbackService) Ready() (*ReadinessReport, bool) {
+	c.readiness.mu.RLock()
+	checks := make([]readinessCheck, len(c.readiness.checks))
+	copy(checks, c.readiness.checks)
+	c.readiness.mu.RUnlock()
+
+	ready := true
+	report := &ReadinessReport{Status: CheckOK}
+	for _, rc := range checks {
+		result := &CheckResult{Name: rc.name, Status: CheckOK}
+		if err := rc.check(); errors.Is(err, ErrCheckSkipped) {
+			result.Status = CheckSkipped
+			result.Error = err.Error()
+		} else if err != nil {
+			result.Status = CheckFailed
+			result.Error = err.Error()
+			ready = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	if !ready {
+		report.Status = CheckFailed
+	}
+	return report, ready
+}
+
+func (c *CallbackService) Healthz(g *gin.Context) {
+	g.JSON(http.StatusOK, gin.H{"status": CheckOK})
+}
+
+func (c *CallbackService) Readyz(g *gin.Context) {
+	report, ready := c.Ready()
+	if !ready {
+		log.Printf("readiness check failed: %+v", report.Checks)
+		g.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	g.JSON(http.StatusOK, report)
+}
+
+var selfTestMessage = []byte("mpc-node-callback-demo self test")
+
+func (c *CallbackService) checkSigningKey() error {
+	if c.signingKey == nil {
+		return fmt.Errorf("callback server private key not loaded")
+	}
+	signature, err := c.signer.Sign(selfTestMessage)
+	if err != nil {
+		return fmt.Errorf("sign failed, %v", err)
+	}
+	verifier, err := newRequestVerifier(c.cfg.SignatureFormat, c.cfg.KeyID, c.signingKey.Public())
+	if err != nil {
+		return err
+	}
+	if apiErr := verifier.Verify(selfTestMessage, signature); apiErr != nil {
+		return fmt.Errorf("signature does not verify with the callback server public key")
+	}
+	return nil
+}
+
+func (c *CallbackService) checkMPCNodePublicKey() error {
+	switch key := c.mpcNodeKey.(type) {
+	case *ecdsa.PublicKey:
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return fmt.Errorf("mpc-node public key is not on curve %s", key.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		if len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid mpc-node ed25519 public key length %d", len(key))
+		}
+	default:
+		return fmt.Errorf("mpc-node public key not loaded")
+	}
+	return nil
+}
+
+func (c *CallbackService) checkDecryptSigKey() error {
+	if c.cfg.DecryptSigKeyPath == "" {
+		return ErrCheckSkipped
+	}
+	if c.DecryptSigKey == nil {
+		return fmt.Errorf("decrypt signature key %s not loaded", c.cfg.DecryptSigKeyPath)
+	}
+	plain := sha256.Sum256(selfTestMessage)
+	ct, err := EncryptSignature(decryptKeyPublic(c.DecryptSigKey), nil, false, plain[:])
+	if err != nil {
+		return fmt.Errorf("encrypt failed, %v", err)
+	}
+	decrypted, err := DecryptSignature(c.DecryptSigKey, hex.EncodeToString(ct))
+	if err != nil {
+		return err
+	}
+	if decrypted != hex.EncodeToString(plain[:]) {
+		return fmt.Errorf("decrypted self test message mismatch")
+	}
+	return nil
+}
+
+// checkPolicy reports whether the configured policies are the ones in use
+// and have the key registry they require.
+func (c *CallbackService) checkPolicy() error {
+	if c.cfg.PolicyPath == "" && c.cfg.ShadowPolicyPath == "" {
+		return ErrCheckSkipped
+	}
+	for _, configured := range []struct {
+		path   string
+		policy Policy
+	}{
+		{c.cfg.PolicyPath, c.policy},
+		{c.cfg.ShadowPolicyPath, c.shadow},
+	} {
+		if configured.path == "" {
+			continue
+		}
+		policy, ok := configured.policy.(*RulePolicy)
+		if !ok || policy == nil {
+			return fmt.Errorf("policy %s not loaded", configured.path)
+		}
+		if policy.RequiresKeyRegistry() && policy.keys == nil {
+			return fmt.Errorf("policy %s requires known keys but has no key registry", configured.path)
+		}
+	}
+	return nil
+}
+
+func (c *CallbackService) checkAuditLog() error {
+	if c.auditLog == nil {
+		return ErrCheckSkipped
+	}
+	return c.auditLog.Check()
+}
+
+func (c *CallbackService) checkLimitState() error {
+	if c.limitState == nil {
+		return ErrCheckSkipped
+	}
+	return c.limitState.Check()
+}
+
+func (c *CallbackService) checkAddressBook() error {
+	if c.book == nil {
+		return ErrCheckSkipped
+	}
+	return c.book.Check()
+}
+
+func (c *CallbackService) checkKeygenRegistry() error {
+	if c.keygens == nil {
+		return ErrCheckSkipped
+	}
+	return c.keygens.Check()
+}
+
+func (c *CallbackService) checkKeyRegistry() error {
+	if c.keys == nil {
+		return ErrCheckSkipped
+	}
+	return c.keys.Check()
+}
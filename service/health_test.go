@@ -0,0 +1,108 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func (s *testService) get(t *testing.T, path string) (int, *ReadinessReport) {
+	w := httptest.NewRecorder()
+	s.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	report := &ReadinessReport{}
+	if err := json.Unmarshal(w.Body.Bytes(), report); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return w.Code, report
+}
+
+func checkStatus(report *ReadinessReport, name string) string {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check.Status
+		}
+	}
+	return ""
+}
+
+func TestReadiness(t *testing.T) {
+	s := newTestService(t, &CallbackServiceConfig{})
+	if code, report := s.get(t, "/healthz"); code != http.StatusOK || report.Status != CheckOK {
+		t.Errorf("healthz: got %d %+v", code, report)
+	}
+	code, report := s.get(t, "/readyz")
+	if code != http.StatusOK || report.Status != CheckOK {
+		t.Fatalf("readyz: got %d %+v", code, report)
+	}
+	if status := checkStatus(report, "policy"); status != CheckSkipped {
+		t.Errorf("policy without policy file: %s", status)
+	}
+
+	dir := t.TempDir()
+	policyPath := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(policyPath, []byte(`{"keys":{"require_known_key":true}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bookPath := filepath.Join(dir, "address_book.json")
+	s = newTestService(t, &CallbackServiceConfig{
+		PolicyPath:      policyPath,
+		AddressBookPath: bookPath,
+		KeyRegistryPath: filepath.Join(dir, "keys.json"),
+	})
+	code, report = s.get(t, "/readyz")
+	if code != http.StatusOK {
+		t.Fatalf("readyz: got %d %+v", code, report.Checks)
+	}
+	for _, name := range []string{"signing_key", "mpc_node_public_key", "policy", "address_book", "key_registry"} {
+		if status := checkStatus(report, name); status != CheckOK {
+			t.Errorf("%s: %s", name, status)
+		}
+	}
+
+	// the loaded policy stays in use without its file
+	if err := os.Remove(policyPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, report = s.get(t, "/readyz"); checkStatus(report, "policy") != CheckOK {
+		t.Errorf("policy file removed: %+v", report.Checks)
+	}
+
+	tests := []struct {
+		name  string
+		check string
+		do    func() error
+	}{
+		{"key registry dropped", "policy", func() error { s.policy.(*RulePolicy).UseKeyRegistry(nil); return nil }},
+		{"shadow policy not loaded", "policy", func() error {
+			s.policy.(*RulePolicy).UseKeyRegistry(s.keys)
+			s.cfg.ShadowPolicyPath = policyPath
+			return nil
+		}},
+		{"address book corrupted", "address_book", func() error { return ioutil.WriteFile(bookPath, []byte("{"), 0600) }},
+	}
+	for _, tt := range tests {
+		if err := tt.do(); err != nil {
+			t.Fatal(err)
+		}
+		code, report = s.get(t, "/readyz")
+		if code != http.StatusServiceUnavailable || report.Status != CheckFailed || checkStatus(report, tt.check) != CheckFailed {
+			t.Errorf("%s: got %d %+v", tt.name, code, report.Checks)
+		}
+	}
+
+	s = newTestService(t, &CallbackServiceConfig{DecryptSigKeyPath: filepath.Join(dir, "missing.pem")})
+	if code, report = s.get(t, "/readyz"); code != http.StatusServiceUnavailable || checkStatus(report, "decrypt_sig_key") != CheckFailed {
+		t.Errorf("decrypt signature key not loaded: got %d %+v", code, report.Checks)
+	}
+
+	s = newTestService(t, &CallbackServiceConfig{})
+	s.AddReadinessCheck("custom", func() error { return errors.New("down") })
+	if code, report = s.get(t, "/readyz"); code != http.StatusServiceUnavailable || checkStatus(report, "custom") != CheckFailed {
+		t.Errorf("failing custom check: got %d %+v", code, report.Checks)
+	}
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testService is a CallbackService built from key files written in a
+// temporary directory.
+type testService struct {
+	*CallbackService
+	dir        string
+	key        *ecdsa.PrivateKey
+	mpcNodeKey *ecdsa.PrivateKey
+}
+
+func newTestService(t *testing.T, cfg *CallbackServiceConfig) *testService {
+	gin.SetMode(gin.TestMode)
+	s := &testService{dir: t.TempDir()}
+	s.key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.mpcNodeKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cfg.PrivateKeyPath = writeTestKey(t, s.dir, "callback.pem", s.key)
+	cfg.MPCNodePublicKeyPath = writeTestKey(t, s.dir, "mpc_node_public.pem", s.mpcNodeKey.Public())
+	c, err := NewCallBackService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.CallbackService = c
+	return s
+}
+
+// writeTestKey writes a private or public key PEM file.
+func writeTestKey(t *testing.T, dir, name string, key interface{}) string {
+	var data []byte
+	var err error
+	if signer, ok := key.(crypto.Signer); ok {
+		data, err = MarshalPrivateKeyPEM(signer, KeyFormatPKCS8)
+	} else {
+		data, err = MarshalPublicKeyPEM(key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err = ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/sinohope/mpc-node-callback-demo/service/ecies"
+)
+
+const (
+	JWSAlgES256  = "ES256"
+	JWSAlgES256K = "ES256K"
+	JWSAlgES384  = "ES384"
+	JWSAlgES512  = "ES512"
+	JWSAlgEdDSA  = "EdDSA"
+)
+
+var jwsEncoding = base64.RawURLEncoding
+
+type JWSHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// JWSAlgorithm returns the JOSE algorithm matching the type and curve of key.
+func JWSAlgorithm(key crypto.PublicKey) (string, error) {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		switch {
+		case ecies.IsSecp256k1(k.Curve):
+			return JWSAlgES256K, nil
+		case k.Curve == elliptic.P256():
+			return JWSAlgES256, nil
+		case k.Curve == elliptic.P384():
+			return JWSAlgES384, nil
+		case k.Curve == elliptic.P521():
+			return JWSAlgES512, nil
+		}
+		return "", fmt.Errorf("jws: unsupported elliptic curve %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return JWSAlgEdDSA, nil
+	}
+	return "", fmt.Errorf("jws: unsupported key type %T", key)
+}
+
+// SignJWS signs payload into a JWS compact serialization carrying kid in its
+// protected header. With detached set the payload part is left empty
+// (RFC 7515 appendix F) and must be supplied again to VerifyJWS.
+func SignJWS(key crypto.Signer, kid string, payload []byte, detached bool) (string, error) {
+	alg, err := JWSAlgorithm(key.Public())
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(&JWSHeader{Alg: alg, Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	encodedPayload := jwsEncoding.EncodeToString(payload)
+	signingInput := jwsEncoding.EncodeToString(header) + "." + encodedPayload
+
+	var signature []byte
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, jwsDigest(alg, []byte(signingInput)))
+		if err != nil {
+			return "", err
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(signingInput))
+	default:
+		return "", fmt.Errorf("jws: unsupported key type %T", key)
+	}
+	if detached {
+		encodedPayload = ""
+	}
+	return jwsEncoding.EncodeToString(header) + "." + encodedPayload + "." + jwsEncoding.EncodeToString(signature), nil
+}
+
+// VerifyJWS verifies a compact or detached JWS over payload. A compact JWS
+// must carry exactly payload. When kid is not empty the protected header must
+// name the same key.
+func VerifyJWS(key crypto.PublicKey, kid string, payload []byte, jws string) error {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("jws: expected 3 parts, got %d", len(parts))
+	}
+	headerBytes, err := jwsEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("jws: invalid header encoding, %v", err)
+	}
+	header := &JWSHeader{}
+	if err = json.Unmarshal(headerBytes, header); err != nil {
+		return fmt.Errorf("jws: invalid header, %v", err)
+	}
+	alg, err := JWSAlgorithm(key)
+	if err != nil {
+		return err
+	}
+	if header.Alg != alg {
+		return fmt.Errorf("jws: algorithm %q does not match key algorithm %q", header.Alg, alg)
+	}
+	if kid != "" && header.Kid != kid {
+		return fmt.Errorf("jws: unexpected key id %q", header.Kid)
+	}
+	if parts[1] != "" {
+		embedded, err := jwsEncoding.DecodeString(parts[1])
+		if err != nil {
+			return fmt.Errorf("jws: invalid payload encoding, %v", err)
+		}
+		if !bytes.Equal(embedded, payload) {
+			return fmt.Errorf("jws: payload does not match")
+		}
+	}
+	signature, err := jwsEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("jws: invalid signature encoding, %v", err)
+	}
+	signingInput := []byte(parts[0] + "." + jwsEncoding.EncodeToString(payload))
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("jws: invalid signature length %d", len(signature))
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, jwsDigest(alg, signingInput), r, s) {
+			return fmt.Errorf("jws: invalid signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, signingInput, signature) {
+			return fmt.Errorf("jws: invalid signature")
+		}
+	}
+	return nil
+}
+
+func jwsDigest(alg string, signingInput []byte) []byte {
+	switch alg {
+	case JWSAlgES384:
+		h := sha512.Sum384(signingInput)
+		return h[:]
+	case JWSAlgES512:
+		h := sha512.Sum512(signingInput)
+		return h[:]
+	default:
+		h := sha256.Sum256(signingInput)
+		return h[:]
+	}
+}
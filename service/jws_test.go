@@ -0,0 +1,118 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// RFC 8037 appendix A.4, Ed25519 signing with a JOSE library.
+func TestJWSEd25519Vector(t *testing.T) {
+	d, _ := base64.RawURLEncoding.DecodeString("nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+	key := ed25519.NewKeyFromSeed(d)
+	payload := []byte("Example of Ed25519 signing")
+	want := "eyJhbGciOiJFZERTQSJ9.RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc.hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg"
+
+	jws, err := SignJWS(key, "", payload, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jws != want {
+		t.Fatalf("have: %s\nwant: %s", jws, want)
+	}
+	if err = VerifyJWS(key.Public(), "", payload, want); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWSSignVerify(t *testing.T) {
+	keys := map[string]crypto.Signer{}
+	for alg, curve := range map[string]elliptic.Curve{
+		JWSAlgES256:  elliptic.P256(),
+		JWSAlgES384:  elliptic.P384(),
+		JWSAlgES512:  elliptic.P521(),
+		JWSAlgES256K: btcec.S256(),
+	} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[alg] = key
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys[JWSAlgEdDSA] = edKey
+
+	payload := []byte(`{"action":"APPROVE","callback_id":"1"}`)
+	for alg, key := range keys {
+		for _, detached := range []bool{false, true} {
+			jws, err := SignJWS(key, "callback-1", payload, detached)
+			if err != nil {
+				t.Fatalf("%s: %v", alg, err)
+			}
+			if parts := strings.Split(jws, "."); (parts[1] == "") != detached {
+				t.Fatalf("%s: detached %v produced %s", alg, detached, jws)
+			}
+			if err = VerifyJWS(key.Public(), "callback-1", payload, jws); err != nil {
+				t.Fatalf("%s: %v", alg, err)
+			}
+			if err = VerifyJWS(key.Public(), "", payload, jws); err != nil {
+				t.Fatalf("%s: %v", alg, err)
+			}
+			if err = VerifyJWS(key.Public(), "other", payload, jws); err == nil {
+				t.Fatalf("%s: key id mismatch should fail", alg)
+			}
+			if err = VerifyJWS(key.Public(), "", []byte(`{"action":"REJECT"}`), jws); err == nil {
+				t.Fatalf("%s: tampered payload should fail", alg)
+			}
+		}
+	}
+
+	// an ES256 token must not verify against an EdDSA key and vice versa
+	jws, _ := SignJWS(keys[JWSAlgES256], "", payload, false)
+	if err = VerifyJWS(edKey.Public(), "", payload, jws); err == nil {
+		t.Fatal("algorithm confusion should fail")
+	}
+}
+
+func TestResponseSignerFormats(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte(`{"action":"WAIT"}`)
+	for _, format := range []string{SignatureFormatHex, SignatureFormatJWS, SignatureFormatJWSDetached} {
+		signer, err := newResponseSigner(format, "kid", key)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		verifier, err := newRequestVerifier(format, "kid", key.Public())
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		signature, err := signer.Sign(payload)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if apiErr := verifier.Verify(payload, signature); apiErr != nil {
+			t.Fatalf("%s: %v", format, apiErr)
+		}
+	}
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err = newResponseSigner(SignatureFormatHex, "", edKey); err == nil {
+		t.Fatal("hex format should require an ECDSA key")
+	}
+	if _, err = newResponseSigner("pgp", "", key); err == nil {
+		t.Fatal("unknown format should be rejected")
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"crypto"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/sinohope/mpc-node-callback-demo/service/ecies"
+)
+
+// KeyShare is one Shamir share of a backed up private key PEM file, kept by
+// a custodian. The share is either in clear or ECIES encrypted to the
+// custodian's public key.
+type KeyShare struct {
+	// Fingerprint is the fingerprint of the public key of the backed up key.
+	Fingerprint string `json:"fingerprint"`
+	Threshold   int    `json:"threshold"`
+	Shares      int    `json:"shares"`
+	Index       int    `json:"index"`
+	Share       string `json:"share,omitempty"`
+	// Custodian is the fingerprint of the key EncryptedShare is encrypted to.
+	Custodian      string `json:"custodian,omitempty"`
+	EncryptedShare string `json:"encrypted_share,omitempty"`
+}
+
+// PrivateKeyPublic returns the public key of a private key PEM file, a
+// signing key or an X25519 key.
+func PrivateKeyPublic(pemData []byte) (crypto.PublicKey, error) {
+	if key, err := ParseX25519PrivateKeyPEM(pemData); err == nil {
+		return key.Public(), nil
+	}
+	key, err := ParsePrivateKeyPEM(pemData)
+	if err != nil {
+		return nil, err
+	}
+	return key.Public(), nil
+}
+
+// BackupKey splits a private key PEM file into n shares, any threshold of
+// which restore it. When custodians are given there must be n of them and
+// share i is encrypted to custodians[i].
+func BackupKey(pemData []byte, threshold, n int, custodians []crypto.PublicKey) ([]*KeyShare, error) {
+	public, err := PrivateKeyPublic(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key failed, %v", err)
+	}
+	fingerprint, err := Fingerprint(public)
+	if err != nil {
+		return nil, err
+	}
+	if len(custodians) != 0 && len(custodians) != n {
+		return nil, fmt.Errorf("%d custodian keys for %d shares", len(custodians), n)
+	}
+	parts, err := SplitSecret(pemData, threshold, n)
+	if err != nil {
+		return nil, err
+	}
+	shares := make([]*KeyShare, n)
+	for i, part := range parts {
+		share := &KeyShare{Fingerprint: fingerprint, Threshold: threshold, Shares: n, Index: int(part[0])}
+		if len(custodians) == 0 {
+			share.Share = hex.EncodeToString(part[1:])
+		} else {
+			if share.Custodian, err = Fingerprint(custodians[i]); err != nil {
+				return nil, fmt.Errorf("custodian %d: %v", i+1, err)
+			}
+			ct, err := EncryptSignature(custodians[i], ecies.ECIES_AES256GCM_HKDF_SHA256, false, part[1:])
+			if err != nil {
+				return nil, fmt.Errorf("encrypt share %d failed, %v", share.Index, err)
+			}
+			share.EncryptedShare = hex.EncodeToString(ct)
+		}
+		shares[i] = share
+	}
+	return shares, nil
+}
+
+// RestoreKey combines shares of BackupKey into the private key PEM file and
+// checks it against the recorded fingerprint. Encrypted shares are
+// decrypted with the custodian key of matching fingerprint.
+func RestoreKey(shares []*KeyShare, custodianKeys []crypto.PrivateKey) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("no shares")
+	}
+	custodians := make(map[string]crypto.PrivateKey)
+	for _, key := range custodianKeys {
+		fingerprint, err := Fingerprint(decryptKeyPublic(key))
+		if err != nil {
+			return nil, fmt.Errorf("custodian key: %v", err)
+		}
+		custodians[fingerprint] = key
+	}
+	first := shares[0]
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("%d shares given, %d of %d are required", len(shares), first.Threshold, first.Shares)
+	}
+	parts := make([][]byte, len(shares))
+	for i, share := range shares {
+		if share.Fingerprint != first.Fingerprint || share.Threshold != first.Threshold || share.Shares != first.Shares {
+			return nil, fmt.Errorf("share %d belongs to another backup", share.Index)
+		}
+		if share.Index < 1 || share.Index > share.Shares {
+			return nil, fmt.Errorf("invalid share index %d", share.Index)
+		}
+		part, err := share.decrypt(custodians)
+		if err != nil {
+			return nil, fmt.Errorf("share %d: %v", share.Index, err)
+		}
+		parts[i] = append([]byte{byte(share.Index)}, part...)
+	}
+	pemData, err := CombineShares(parts)
+	if err != nil {
+		return nil, err
+	}
+	public, err := PrivateKeyPublic(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("restored key is invalid, a share may be corrupted, %v", err)
+	}
+	if fingerprint, err := Fingerprint(public); err != nil || fingerprint != first.Fingerprint {
+		return nil, fmt.Errorf("restored key does not match fingerprint %s", first.Fingerprint)
+	}
+	return pemData, nil
+}
+
+func (s *KeyShare) decrypt(custodians map[string]crypto.PrivateKey) ([]byte, error) {
+	if s.EncryptedShare == "" {
+		part, err := hex.DecodeString(s.Share)
+		if err != nil {
+			return nil, fmt.Errorf("decode share failed, %v", err)
+		}
+		return part, nil
+	}
+	key, ok := custodians[s.Custodian]
+	if !ok {
+		return nil, fmt.Errorf("no custodian key with fingerprint %s", s.Custodian)
+	}
+	part, err := DecryptSignature(key, s.EncryptedShare)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(part)
+}
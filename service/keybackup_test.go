@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestShamir(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if gfMul(byte(a), gfInv(byte(a))) != 1 {
+			t.Fatalf("%d has no inverse", a)
+		}
+	}
+
+	secret := []byte("a private key PEM file")
+	shares, err := SplitSecret(secret, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every subset of 3 or more shares restores the secret
+	for mask := 0; mask < 1<<5; mask++ {
+		var subset [][]byte
+		for i := range shares {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, shares[i])
+			}
+		}
+		if len(subset) < 2 {
+			continue
+		}
+		got, err := CombineShares(subset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored := bytes.Equal(got, secret); restored != (len(subset) >= 3) {
+			t.Errorf("shares %05b: restored %v", mask, restored)
+		}
+	}
+
+	if _, err = CombineShares([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("duplicated shares combined")
+	}
+	if _, err = CombineShares([][]byte{shares[0], shares[1][:4]}); err == nil {
+		t.Error("shares of different lengths combined")
+	}
+	for _, tn := range [][2]int{{1, 3}, {4, 3}, {2, 256}} {
+		if _, err = SplitSecret(secret, tn[0], tn[1]); err == nil {
+			t.Errorf("split %d of %d", tn[0], tn[1])
+		}
+	}
+}
+
+func TestKeyBackup(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pemData, err := MarshalPrivateKeyPEM(key, KeyFormatSEC1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, _ := Fingerprint(key.Public())
+
+	shares, err := BackupKey(pemData, 2, 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, share := range shares {
+		if share.Fingerprint != fingerprint || share.Share == "" || share.EncryptedShare != "" {
+			t.Fatalf("unexpected share %+v", share)
+		}
+	}
+	restored, err := RestoreKey([]*KeyShare{shares[2], shares[0]}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, pemData) {
+		t.Error("restored a different key file")
+	}
+	if _, err = RestoreKey(shares[:1], nil); err == nil {
+		t.Error("restored from fewer shares than the threshold")
+	}
+	corrupted := *shares[1]
+	corrupted.Share = "00" + corrupted.Share[2:]
+	if _, err = RestoreKey([]*KeyShare{shares[0], &corrupted}, nil); err == nil {
+		t.Error("restored from a corrupted share")
+	}
+	other, _ := BackupKey(pemData, 2, 3, nil)
+	if _, err = RestoreKey([]*KeyShare{shares[0], other[1]}, nil); err == nil {
+		t.Error("restored from shares of two backups")
+	}
+
+	x25519Key, _ := ParseX25519PrivateKeyPEM([]byte(testX25519PrivatePEM))
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	custodians := []crypto.PublicKey{x25519Key.Public(), &ecdsaKey.PublicKey, x25519Key.Public()}
+	shares, err = BackupKey([]byte(testX25519PrivatePEM), 2, 3, custodians)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shares[0].Share != "" || shares[0].EncryptedShare == "" {
+		t.Fatalf("share is not encrypted %+v", shares[0])
+	}
+	restored, err = RestoreKey(shares[:2], []crypto.PrivateKey{ecdsaKey, x25519Key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(restored) != testX25519PrivatePEM {
+		t.Error("restored a different key file")
+	}
+	if _, err = RestoreKey(shares[:2], []crypto.PrivateKey{x25519Key}); err == nil || !strings.Contains(err.Error(), "no custodian key") {
+		t.Errorf("restored without the custodian key: %v", err)
+	}
+	if _, err = BackupKey(pemData, 2, 3, custodians[:2]); err == nil {
+		t.Error("backup with fewer custodians than shares")
+	}
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+const (
+	// KeygenRuleId is reported for keygen requests rejected by the
+	// KeygenPolicy.
+	KeygenRuleId = "keygen"
+	// KeygenMaxPerDayRuleId is the limit enforcing KeygenPolicy.MaxPerDay.
+	KeygenMaxPerDayRuleId = "keygen-max-per-day"
+)
+
+// KeygenThreshold is an allowed (t, n) combination.
+type KeygenThreshold struct {
+	T int `json:"t"`
+	N int `json:"n"`
+}
+
+// KeygenPolicy constrains keygen requests, which are rejected when they do
+// not comply. Every non-empty field applies.
+type KeygenPolicy struct {
+	Thresholds   []*KeygenThreshold `json:"thresholds,omitempty"`
+	Cryptography []string           `json:"cryptography,omitempty"`
+	// Parties are the registered party ids. Every party of a keygen must be
+	// registered and party_ids must list exactly n distinct parties.
+	Parties []string `json:"parties,omitempty"`
+	// MaxPerDay caps the keygens approved over a sliding 24 hours.
+	MaxPerDay int `json:"max_per_day,omitempty"`
+}
+
+// limit returns the Limit enforcing MaxPerDay, nil when there is no cap.
+func (k *KeygenPolicy) limit() *Limit {
+	if k.MaxPerDay <= 0 {
+		return nil
+	}
+	return &Limit{
+		Id:       KeygenMaxPerDayRuleId,
+		Action:   Reject,
+		Reason:   fmt.Sprintf("more than %d keygens in 24 hours", k.MaxPerDay),
+		Match:    RuleMatch{RequestTypes: []string{RequestTypeKeygen}},
+		Window:   "24h",
+		MaxCount: k.MaxPerDay,
+	}
+}
+
+// check returns why request violates the policy, empty if it does not.
+func (k *KeygenPolicy) check(request *Check) string {
+	detail := &request.RequestDetail
+	if len(k.Thresholds) > 0 {
+		allowed := false
+		for _, threshold := range k.Thresholds {
+			if threshold.T == detail.T && threshold.N == detail.N {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("threshold %d of %d is not allowed", detail.T, detail.N)
+		}
+	}
+	if !matchAny(k.Cryptography, detail.Cryptography) {
+		return fmt.Sprintf("cryptography %q is not allowed", detail.Cryptography)
+	}
+	if len(k.Parties) > 0 {
+		if len(detail.PartyIds) != detail.N {
+			return fmt.Sprintf("%d party ids for %d parties", len(detail.PartyIds), detail.N)
+		}
+		seen := make(map[string]bool)
+		for _, party := range detail.PartyIds {
+			if seen[party] {
+				return fmt.Sprintf("party %q is listed twice", party)
+			}
+			seen[party] = true
+			if !matchAny(k.Parties, party) {
+				return fmt.Sprintf("party %q is not registered", party)
+			}
+		}
+	}
+	return ""
+}
+
+// KeygenRecord is an approved keygen and, once reported, the public key it
+// produced.
+type KeygenRecord struct {
+	RequestId    string     `json:"request_id"`
+	CallbackId   string     `json:"callback_id"`
+	SinoId       string     `json:"sino_id,omitempty"`
+	T            int        `json:"t"`
+	N            int        `json:"n"`
+	Cryptography string     `json:"cryptography"`
+	PartyIds     []string   `json:"party_ids,omitempty"`
+	Approved     time.Time  `json:"approved"`
+	PublicKey    string     `json:"public_key,omitempty"`
+	ChainCode    string     `json:"chain_code,omitempty"`
+	Completed    *time.Time `json:"completed,omitempty"`
+}
+
+var (
+	ErrKeygenNotFound = errors.New("keygen not found")
+	// ErrKeygenCompleted is returned when a different public key or chain
+	// code is reported for a keygen that already has one.
+	ErrKeygenCompleted = errors.New("keygen already has a different public key or chain code")
+)
+
+type keygenRegistryState struct {
+	Keygens []*KeygenRecord `json:"keygens"`
+}
+
+// KeygenRegistry records every approved keygen, persisted in an optional
+// FileStore.
+type KeygenRegistry struct {
+	mu      sync.RWMutex
+	keygens map[string]*KeygenRecord
+	store   *FileStore
+}
+
+func NewKeygenRegistry() *KeygenRegistry {
+	return &KeygenRegistry{keygens: make(map[string]*KeygenRecord)}
+}
+
+func OpenKeygenRegistry(path string) (*KeygenRegistry, error) {
+	store, err := OpenFileStore(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &keygenRegistryState{}
+	if err = store.Load(state); err != nil {
+		return nil, err
+	}
+	r := NewKeygenRegistry()
+	for _, record := range state.Keygens {
+		r.keygens[record.RequestId] = record
+	}
+	r.store = store
+	return r, nil
+}
+
+// Record adds an approved keygen request. The request id identifies the
+// keygen, the callback id is used when it is empty; recording a request
+// again only updates its callback id.
+func (r *KeygenRegistry) Record(request *Check, approved time.Time) error {
+	id := request.ExtraInfo.RequestId
+	if id == "" {
+		id = request.CallbackId
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if record, ok := r.keygens[id]; ok {
+		record.CallbackId = request.CallbackId
+		return r.save()
+	}
+	r.keygens[id] = &KeygenRecord{
+		RequestId:    id,
+		CallbackId:   request.CallbackId,
+		SinoId:       request.ExtraInfo.SinoId,
+		T:            request.RequestDetail.T,
+		N:            request.RequestDetail.N,
+		Cryptography: request.RequestDetail.Cryptography,
+		PartyIds:     request.RequestDetail.PartyIds,
+		Approved:     approved.UTC(),
+	}
+	return r.save()
+}
+
+// Complete sets the public key produced by the keygen requestId and, for
+// secp256k1 keygens, its optional BIP-32 chain code. Both are hex encoded
+// and stored in their normalized form. A chain code may be reported for a
+// keygen completed without one.
+func (r *KeygenRegistry) Complete(requestId, publicKey, chainCode string, completed time.Time) (*KeygenRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.keygens[requestId]
+	if !ok {
+		return nil, ErrKeygenNotFound
+	}
+	normalized, err := NormalizeMPCPublicKey(record.Cryptography, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if chainCode != "" {
+		decoded, err := parseChainCode(chainCode)
+		if err != nil {
+			return nil, err
+		}
+		if !isSecp256k1Cryptography(record.Cryptography) {
+			return nil, fmt.Errorf("chain code set for a %s keygen", record.Cryptography)
+		}
+		chainCode = hex.EncodeToString(decoded)
+	}
+	if record.PublicKey != "" {
+		if record.PublicKey != normalized || (chainCode != "" && record.ChainCode != "" && record.ChainCode != chainCode) {
+			return nil, ErrKeygenCompleted
+		}
+		if chainCode == "" || record.ChainCode != "" {
+			return record, nil
+		}
+		record.ChainCode = chainCode
+		return record, r.save()
+	}
+	record.PublicKey = normalized
+	record.ChainCode = chainCode
+	completed = completed.UTC()
+	record.Completed = &completed
+	return record, r.save()
+}
+
+// Keygens returns the recorded keygens, oldest first.
+func (r *KeygenRegistry) Keygens() []*KeygenRecord {
+	r.mu.RLock()
+	records := make([]*KeygenRecord, 0, len(r.keygens))
+	for _, record := range r.keygens {
+		records = append(records, record)
+	}
+	r.mu.RUnlock()
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].Approved.Equal(records[j].Approved) {
+			return records[i].Approved.Before(records[j].Approved)
+		}
+		return records[i].RequestId < records[j].RequestId
+	})
+	return records
+}
+
+func (r *KeygenRegistry) Check() error {
+	if r.store == nil {
+		return nil
+	}
+	return r.store.Check()
+}
+
+func (r *KeygenRegistry) save() error {
+	if r.store == nil {
+		return nil
+	}
+	state := &keygenRegistryState{Keygens: make([]*KeygenRecord, 0, len(r.keygens))}
+	for _, record := range r.keygens {
+		state.Keygens = append(state.Keygens, record)
+	}
+	sort.Slice(state.Keygens, func(i, j int) bool {
+		return state.Keygens[i].RequestId < state.Keygens[j].RequestId
+	})
+	return r.store.Save(state)
+}
+
+// NormalizeMPCPublicKey validates a hex public key produced by a keygen of
+// cryptography. secp256k1 keys are returned compressed, keys of other
+// cryptography are only checked to be hex.
+func NormalizeMPCPublicKey(cryptography, publicKey string) (string, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(publicKey, "0x"))
+	if err != nil || len(key) == 0 {
+		return "", fmt.Errorf("public key is not hex")
+	}
+	switch {
+	case isSecp256k1Cryptography(cryptography):
+		pub, err := btcec.ParsePubKey(key)
+		if err != nil {
+			return "", fmt.Errorf("invalid secp256k1 public key, %v", err)
+		}
+		return hex.EncodeToString(pub.SerializeCompressed()), nil
+	case strings.EqualFold(cryptography, "ed25519"), strings.EqualFold(cryptography, "eddsa"):
+		if len(key) != ed25519.PublicKeySize {
+			return "", fmt.Errorf("invalid ed25519 public key length %d", len(key))
+		}
+	}
+	return hex.EncodeToString(key), nil
+}
+
+func isSecp256k1Cryptography(cryptography string) bool {
+	switch strings.ToLower(cryptography) {
+	case "secp256k1", "ecdsa":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func keygenRequest(requestId string, t, n int, cryptography string, parties ...string) *Check {
+	return &Check{
+		CallbackId:    "cb-" + requestId,
+		RequestType:   RequestTypeKeygen,
+		RequestDetail: RequestDetail{T: t, N: n, Cryptography: cryptography, PartyIds: parties},
+		ExtraInfo:     ExtraInfo{SinoId: "sino", RequestId: requestId},
+	}
+}
+
+func TestKeygenPolicy(t *testing.T) {
+	policy, err := NewRulePolicy(&PolicyConfig{
+		Keygen: &KeygenPolicy{
+			Thresholds:   []*KeygenThreshold{{T: 2, N: 3}},
+			Cryptography: []string{"secp256k1"},
+			Parties:      []string{"p1", "p2", "p3", "p4"},
+			MaxPerDay:    2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		request *Check
+		ruleId  string
+	}{
+		{keygenRequest("1", 2, 3, "secp256k1", "p1", "p2", "p3"), DefaultRuleId},
+		{keygenRequest("2", 3, 4, "secp256k1", "p1", "p2", "p3", "p4"), KeygenRuleId},
+		{keygenRequest("3", 2, 3, "ed25519", "p1", "p2", "p3"), KeygenRuleId},
+		{keygenRequest("4", 2, 3, "secp256k1", "p1", "p2"), KeygenRuleId},
+		{keygenRequest("5", 2, 3, "secp256k1", "p1", "p2", "p2"), KeygenRuleId},
+		{keygenRequest("6", 2, 3, "secp256k1", "p1", "p2", "p9"), KeygenRuleId},
+		{keygenRequest("7", 2, 3, "secp256k1", "p2", "p3", "p4"), DefaultRuleId},
+		{keygenRequest("8", 2, 3, "secp256k1", "p1", "p3", "p4"), KeygenMaxPerDayRuleId},
+		// sign requests are not keygens
+		{&Check{RequestType: RequestTypeSign}, DefaultRuleId},
+	}
+	for _, tt := range tests {
+		decision, err := policy.Evaluate(tt.request, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decision.RuleId != tt.ruleId {
+			t.Errorf("request %s: got rule %s (%s), want %s", tt.request.RequestId, decision.RuleId, decision.Reason, tt.ruleId)
+		}
+		if decision.RuleId != DefaultRuleId && decision.Action != Reject {
+			t.Errorf("request %s: got action %s", tt.request.RequestId, decision.Action)
+		}
+	}
+	decision, _ := policy.Evaluate(keygenRequest("9", 2, 3, "secp256k1", "p1", "p2", "p3"), now.Add(24*time.Hour))
+	if decision.Action != Approve {
+		t.Errorf("keygen cap not reset after 24 hours: %+v", decision)
+	}
+}
+
+func TestKeygenRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keygens.json")
+	registry, err := OpenKeygenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	request := keygenRequest("r1", 2, 3, "secp256k1", "p1", "p2", "p3")
+	if err = registry.Record(request, now); err != nil {
+		t.Fatal(err)
+	}
+	request.CallbackId = "retried"
+	if err = registry.Record(request, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := btcec.NewPrivateKey()
+	uncompressed := hex.EncodeToString(key.PubKey().SerializeUncompressed())
+	compressed := hex.EncodeToString(key.PubKey().SerializeCompressed())
+	if _, err = registry.Complete("missing", compressed, "", now); err != ErrKeygenNotFound {
+		t.Errorf("got %v for an unknown keygen", err)
+	}
+	if _, err = registry.Complete("r1", "zz", "", now); err == nil {
+		t.Error("invalid public key accepted")
+	}
+	record, err := registry.Complete("r1", uncompressed, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.PublicKey != compressed || record.Completed == nil {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if _, err = registry.Complete("r1", compressed, "", now); err != nil {
+		t.Errorf("reporting the same key again: %v", err)
+	}
+	chainCode := strings.Repeat("ab", 32)
+	for _, invalid := range []string{"abcd", strings.Repeat("zz", 32)} {
+		if _, err = registry.Complete("r1", compressed, invalid, now); err == nil {
+			t.Errorf("chain code %s accepted", invalid)
+		}
+	}
+	if record, err = registry.Complete("r1", compressed, chainCode, now); err != nil || record.ChainCode != chainCode {
+		t.Errorf("adding the chain code: %+v, %v", record, err)
+	}
+	if _, err = registry.Complete("r1", compressed, strings.Repeat("cd", 32), now); err != ErrKeygenCompleted {
+		t.Errorf("got %v for a different chain code", err)
+	}
+	other, _ := btcec.NewPrivateKey()
+	if _, err = registry.Complete("r1", hex.EncodeToString(other.PubKey().SerializeCompressed()), "", now); err != ErrKeygenCompleted {
+		t.Errorf("got %v for a different key", err)
+	}
+
+	registry, err = OpenKeygenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keygens := registry.Keygens()
+	if len(keygens) != 1 || keygens[0].CallbackId != "retried" || keygens[0].PublicKey != compressed || keygens[0].ChainCode != chainCode || !keygens[0].Approved.Equal(now) {
+		t.Errorf("unexpected keygens %+v", keygens)
+	}
+}
+
+type failingSigner struct{}
+
+func (failingSigner) Sign([]byte) (string, error) {
+	return "", fmt.Errorf("signer unavailable")
+}
+
+func TestRespondRecordsSentKeygens(t *testing.T) {
+	s := newTestService(t, &CallbackServiceConfig{KeygenRegistryPath: filepath.Join(t.TempDir(), "keygens.json")})
+	respond := func(requestId string) int {
+		w := httptest.NewRecorder()
+		g, _ := gin.CreateTestContext(w)
+		g.Request = httptest.NewRequest("POST", "/check", nil)
+		s.respond(g, keygenRequest(requestId, 2, 3, "secp256k1", "p1", "p2", "p3"))
+		return w.Code
+	}
+	signer := s.signer
+	s.signer = failingSigner{}
+	if code := respond("unsent"); code != http.StatusInternalServerError {
+		t.Fatalf("got %d with a failing signer", code)
+	}
+	s.signer = signer
+	if code := respond("sent"); code != http.StatusOK {
+		t.Fatalf("got %d", code)
+	}
+	keygens := s.keygens.Keygens()
+	if len(keygens) != 1 || keygens[0].RequestId != "sent" {
+		t.Errorf("unexpected keygens %+v", keygens)
+	}
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// KeyRuleId is reported for sign requests rejected by the KeyPolicy.
+const KeyRuleId = "key"
+
+// RootKey is a root public key of the mpc-node, signing requests derive
+// their keys from it along a BIP-32 path.
+type RootKey struct {
+	PublicKey string `json:"public_key"`
+	// ChainCode is the hex BIP-32 chain code of a secp256k1 key, needed to
+	// verify the keys derived from it. ExtendedKey sets both the public key
+	// and the chain code from an xpub.
+	ChainCode    string `json:"chain_code,omitempty"`
+	ExtendedKey  string `json:"xpub,omitempty"`
+	Cryptography string `json:"cryptography,omitempty"`
+	Label        string `json:"label,omitempty"`
+	SinoId       string `json:"sino_id,omitempty"`
+	// KeygenRequestId is the keygen that produced the key, if known.
+	KeygenRequestId string `json:"keygen_request_id,omitempty"`
+	// Paths are the derivation path patterns allowed for this key, the
+	// KeyPolicy paths apply when empty.
+	Paths []string  `json:"paths,omitempty"`
+	Added time.Time `json:"added"`
+
+	patterns  []*PathPattern
+	pub       *btcec.PublicKey
+	chainCode []byte
+}
+
+func (k *RootKey) normalize() error {
+	if k.ExtendedKey != "" {
+		pub, chainCode, err := ParseExtendedPublicKey(k.ExtendedKey)
+		if err != nil {
+			return err
+		}
+		publicKey := hex.EncodeToString(pub.SerializeCompressed())
+		if k.PublicKey == "" {
+			k.PublicKey = publicKey
+		}
+		if k.ChainCode == "" {
+			k.ChainCode = hex.EncodeToString(chainCode)
+		}
+		if normalized, _ := normalizePublicKeyHex(k.PublicKey); normalized != publicKey || k.ChainCode != hex.EncodeToString(chainCode) {
+			return fmt.Errorf("public key or chain code does not match the xpub")
+		}
+	}
+	publicKey, err := normalizePublicKeyHex(k.PublicKey)
+	if err != nil {
+		return err
+	}
+	k.PublicKey = publicKey
+	k.pub, k.chainCode = nil, nil
+	if key, err := hex.DecodeString(publicKey); err == nil {
+		k.pub, _ = btcec.ParsePubKey(key)
+	}
+	if k.ChainCode != "" {
+		chainCode, err := parseChainCode(k.ChainCode)
+		if err != nil {
+			return err
+		}
+		if k.pub == nil {
+			return fmt.Errorf("chain code set for a key that is not secp256k1")
+		}
+		k.ChainCode = hex.EncodeToString(chainCode)
+		k.chainCode = chainCode
+	}
+	patterns, err := parsePathPatterns(k.Paths)
+	if err != nil {
+		return err
+	}
+	k.patterns = patterns
+	return nil
+}
+
+// derive returns the key derived along path, which needs a chain code
+// unless path is empty.
+func (k *RootKey) derive(path []uint32) (*btcec.PublicKey, error) {
+	if k.pub == nil {
+		return nil, fmt.Errorf("key %s is not secp256k1", k.PublicKey)
+	}
+	if len(path) == 0 {
+		return k.pub, nil
+	}
+	if k.chainCode == nil {
+		return nil, fmt.Errorf("key %s has no chain code", k.PublicKey)
+	}
+	return DerivePublicKey(k.pub, k.chainCode, path)
+}
+
+// parseChainCode decodes a hex BIP-32 chain code.
+func parseChainCode(chainCode string) ([]byte, error) {
+	decoded, err := hex.DecodeString(strings.TrimPrefix(chainCode, "0x"))
+	if err != nil || len(decoded) != 32 {
+		return nil, fmt.Errorf("chain code %q is not 32 hex bytes", chainCode)
+	}
+	return decoded, nil
+}
+
+// normalizePublicKeyHex returns secp256k1 keys in compressed form and any
+// other key as lower case hex.
+func normalizePublicKeyHex(publicKey string) (string, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(publicKey), "0x"))
+	if err != nil || len(key) == 0 {
+		return "", fmt.Errorf("public key %q is not hex", publicKey)
+	}
+	if pub, err := btcec.ParsePubKey(key); err == nil {
+		return hex.EncodeToString(pub.SerializeCompressed()), nil
+	}
+	return hex.EncodeToString(key), nil
+}
+
+func parsePathPatterns(paths []string) ([]*PathPattern, error) {
+	patterns := make([]*PathPattern, 0, len(paths))
+	for _, path := range paths {
+		pattern, err := ParsePathPattern(path)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+type keyRegistryState struct {
+	Keys []*RootKey `json:"keys"`
+}
+
+// KeyRegistry holds the known root keys, persisted in an optional
+// FileStore.
+type KeyRegistry struct {
+	mu    sync.RWMutex
+	keys  map[string]*RootKey
+	store *FileStore
+	// derived caches by path the keys derived from the root keys with a
+	// chain code, it is dropped whenever the keys change.
+	derived map[string]map[string]*derivedKey
+}
+
+type derivedKey struct {
+	root *RootKey
+	pub  *btcec.PublicKey
+}
+
+// maxDerivedPaths bounds the paths cached by KeyRegistry.Derived.
+const maxDerivedPaths = 1024
+
+func NewKeyRegistry() *KeyRegistry {
+	return &KeyRegistry{keys: make(map[string]*RootKey)}
+}
+
+func OpenKeyRegistry(path string) (*KeyRegistry, error) {
+	store, err := OpenFileStore(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &keyRegistryState{}
+	if err = store.Load(state); err != nil {
+		return nil, err
+	}
+	r := NewKeyRegistry()
+	for _, key := range state.Keys {
+		if err = key.normalize(); err != nil {
+			return nil, fmt.Errorf("load key registry failed, %v", err)
+		}
+		r.keys[key.PublicKey] = key
+	}
+	r.store = store
+	return r, nil
+}
+
+// Register adds or replaces a root key.
+func (r *KeyRegistry) Register(key *RootKey) error {
+	if err := key.normalize(); err != nil {
+		return err
+	}
+	if key.Added.IsZero() {
+		key.Added = time.Now().UTC()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[key.PublicKey] = key
+	r.derived = nil
+	return r.save()
+}
+
+// Remove removes a root key and reports whether it was registered.
+func (r *KeyRegistry) Remove(publicKey string) (bool, error) {
+	publicKey, err := normalizePublicKeyHex(publicKey)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[publicKey]; !ok {
+		return false, nil
+	}
+	delete(r.keys, publicKey)
+	r.derived = nil
+	return true, r.save()
+}
+
+// Lookup returns the registered root key publicKey, nil if unknown.
+func (r *KeyRegistry) Lookup(publicKey string) *RootKey {
+	publicKey, err := normalizePublicKeyHex(publicKey)
+	if err != nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[publicKey]
+}
+
+// Derived returns the root key publicKey derives from along path and the
+// derived key, nil if no registered key with a chain code derives it.
+func (r *KeyRegistry) Derived(publicKey string, path []uint32) (*RootKey, *btcec.PublicKey) {
+	publicKey, err := normalizePublicKeyHex(publicKey)
+	if err != nil {
+		return nil, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pathKey := fmt.Sprint(path)
+	keys, ok := r.derived[pathKey]
+	if !ok {
+		if r.derived == nil || len(r.derived) >= maxDerivedPaths {
+			r.derived = make(map[string]map[string]*derivedKey)
+		}
+		keys = make(map[string]*derivedKey)
+		for _, root := range r.keys {
+			if root.chainCode == nil {
+				continue
+			}
+			if child, err := root.derive(path); err == nil {
+				keys[hex.EncodeToString(child.SerializeCompressed())] = &derivedKey{root: root, pub: child}
+			}
+		}
+		r.derived[pathKey] = keys
+	}
+	if derived := keys[publicKey]; derived != nil {
+		return derived.root, derived.pub
+	}
+	return nil, nil
+}
+
+// Keys returns the registered root keys sorted by public key.
+func (r *KeyRegistry) Keys() []*RootKey {
+	r.mu.RLock()
+	keys := make([]*RootKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	r.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].PublicKey < keys[j].PublicKey
+	})
+	return keys
+}
+
+func (r *KeyRegistry) Check() error {
+	if r.store == nil {
+		return nil
+	}
+	return r.store.Check()
+}
+
+func (r *KeyRegistry) save() error {
+	if r.store == nil {
+		return nil
+	}
+	state := &keyRegistryState{Keys: make([]*RootKey, 0, len(r.keys))}
+	for _, key := range r.keys {
+		state.Keys = append(state.Keys, key)
+	}
+	sort.Slice(state.Keys, func(i, j int) bool {
+		return state.Keys[i].PublicKey < state.Keys[j].PublicKey
+	})
+	return r.store.Save(state)
+}
+
+// KeyPolicy constrains the key and derivation path of sign and rawdata
+// requests, requests that do not comply are rejected.
+type KeyPolicy struct {
+	// RequireKnownKey rejects requests whose public key is neither a
+	// registered root key nor derived from one along the request path.
+	// Without it this only applies to requests whose path parses, when a
+	// key registry is configured.
+	RequireKnownKey bool `json:"require_known_key,omitempty"`
+	// VerifySender rejects EVM requests whose tx_info sender is not the
+	// address of the key derived along the request path.
+	VerifySender bool `json:"verify_sender,omitempty"`
+	// Paths are the allowed derivation path patterns, such as
+	// "m/44'/60'/0'/0/*". Registered keys may override them.
+	Paths []string `json:"paths,omitempty"`
+
+	patterns []*PathPattern
+}
+
+func (k *KeyPolicy) compile() error {
+	patterns, err := parsePathPatterns(k.Paths)
+	if err != nil {
+		return err
+	}
+	k.patterns = patterns
+	return nil
+}
+
+// appliesTo reports whether request signs with a key.
+func (k *KeyPolicy) appliesTo(request *Check) bool {
+	return request.RequestType == RequestTypeSign || request.RequestType == RequestTypeRawData
+}
+
+// check returns the reason code and why the request violates the policy,
+// empty if it does not.
+// The request public key is either a registered root key, which the
+// mpc-node derives along the path, or a key derived from one along the
+// path.
+func (k *KeyPolicy) check(e *evaluation, registry *KeyRegistry) (string, string, error) {
+	detail := &e.request.RequestDetail
+	path, pathErr := ParsePath(detail.Path)
+	var root *RootKey
+	// signer is the key the request signs with, nil when it is unknown
+	var signer *btcec.PublicKey
+	if registry != nil {
+		if root = registry.Lookup(detail.PublicKey); root != nil {
+			if pathErr == nil {
+				signer, _ = root.derive(path)
+			}
+		} else if pathErr == nil {
+			root, signer = registry.Derived(detail.PublicKey, path)
+		}
+	}
+	if root == nil && (k.RequireKnownKey || (registry != nil && pathErr == nil)) {
+		return ReasonKeyPolicy, fmt.Sprintf("public key %q is not registered nor derived from a registered key along %q", detail.PublicKey, detail.Path), nil
+	}
+	patterns := k.patterns
+	if root != nil && len(root.patterns) > 0 {
+		patterns = root.patterns
+	}
+	if len(patterns) > 0 {
+		if pathErr != nil {
+			return ReasonParseFailure, pathErr.Error(), nil
+		}
+		allowed := false
+		for _, pattern := range patterns {
+			if pattern.Match(path) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return ReasonKeyPolicy, fmt.Sprintf("derivation path %q is not allowed", detail.Path), nil
+		}
+	}
+	if !k.VerifySender {
+		return "", "", nil
+	}
+	tx, err := e.txInfo()
+	if err != nil {
+		return "", "", err
+	}
+	if !evmChains[tx.Chain] || tx.From == "" {
+		return "", "", nil
+	}
+	if signer == nil {
+		return ReasonKeyPolicy, fmt.Sprintf("sender %s cannot be verified, the signing key is unknown", tx.From), nil
+	}
+	if address := EVMAddress(signer); !strings.EqualFold(address, tx.From) {
+		return ReasonKeyPolicy, fmt.Sprintf("sender %s is not the signing key address %s", tx.From, address), nil
+	}
+	return "", "", nil
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+func TestPathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"m/44'/60'/0'/0/*", "m/44'/60'/0'/0/7", true},
+		{"m/44'/60'/0'/0/*", "m/44h/60h/0h/0/7", true},
+		{"m/44'/60'/0'/0/*", "m/44'/60'/0'/0/7'", false},
+		{"m/44'/60'/0'/0/*", "m/44'/60'/0'/1/7", false},
+		{"m/44'/60'/0'/0/*", "m/44'/60'/0'/0", false},
+		{"m/44/60/0/0/0-9", "m/44/60/0/0/9", true},
+		{"m/44/60/0/0/0-9", "m/44/60/0/0/10", false},
+		{"m", "m", true},
+	}
+	for _, tt := range tests {
+		pattern, err := ParsePathPattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, err := ParsePath(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pattern.Match(path); got != tt.want {
+			t.Errorf("%s matches %s: got %v", tt.pattern, tt.path, got)
+		}
+	}
+	for _, path := range []string{"", "44/60", "m/x", "m/2147483648", "m//0"} {
+		if _, err := ParsePath(path); err == nil {
+			t.Errorf("invalid path %q accepted", path)
+		}
+	}
+	for _, pattern := range []string{"n/*", "m/9-1", "m/1-x"} {
+		if _, err := ParsePathPattern(pattern); err == nil {
+			t.Errorf("invalid pattern %q accepted", pattern)
+		}
+	}
+}
+
+func TestKeyRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	registry, err := OpenKeyRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := btcec.NewPrivateKey()
+	compressed := hex.EncodeToString(key.PubKey().SerializeCompressed())
+	uncompressed := hex.EncodeToString(key.PubKey().SerializeUncompressed())
+	if err = registry.Register(&RootKey{PublicKey: uncompressed, Paths: []string{"m/0/*"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = registry.Register(&RootKey{PublicKey: "zz"}); err == nil {
+		t.Error("invalid public key registered")
+	}
+	if err = registry.Register(&RootKey{PublicKey: compressed, Paths: []string{"x"}}); err == nil {
+		t.Error("invalid path pattern registered")
+	}
+
+	registry, err = OpenKeyRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := registry.Lookup("0x" + uncompressed)
+	if root == nil || root.PublicKey != compressed || len(root.patterns) != 1 {
+		t.Fatalf("unexpected root key %+v", root)
+	}
+	if removed, err := registry.Remove(compressed); err != nil || !removed {
+		t.Errorf("remove: %v %v", removed, err)
+	}
+	if removed, _ := registry.Remove(compressed); removed {
+		t.Error("removed twice")
+	}
+	if len(registry.Keys()) != 0 {
+		t.Errorf("unexpected keys %+v", registry.Keys())
+	}
+}
+
+func TestKeyPolicy(t *testing.T) {
+	policy, err := NewRulePolicy(&PolicyConfig{
+		DefaultAction: Approve,
+		Keys: &KeyPolicy{
+			RequireKnownKey: true,
+			Paths:           []string{"m/44/60/0/0/*"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	known, _ := btcec.NewPrivateKey()
+	restricted, _ := btcec.NewPrivateKey()
+	unknown, _ := btcec.NewPrivateKey()
+	registry := NewKeyRegistry()
+	registry.Register(&RootKey{PublicKey: hex.EncodeToString(known.PubKey().SerializeCompressed())})
+	registry.Register(&RootKey{PublicKey: hex.EncodeToString(restricted.PubKey().SerializeCompressed()), Paths: []string{"m/1"}})
+	policy.UseKeyRegistry(registry)
+
+	request := func(requestType string, key *btcec.PrivateKey, path string) *Check {
+		return &Check{RequestType: requestType, RequestDetail: RequestDetail{
+			PublicKey: hex.EncodeToString(key.PubKey().SerializeCompressed()),
+			Path:      path,
+		}}
+	}
+	tests := []struct {
+		request *Check
+		ruleId  string
+	}{
+		{request(RequestTypeSign, known, "m/44/60/0/0/3"), DefaultRuleId},
+		{request(RequestTypeRawData, known, "m/44/60/0/0/3"), DefaultRuleId},
+		{request(RequestTypeSign, known, "m/44/60/0/1/3"), KeyRuleId},
+		{request(RequestTypeSign, known, "bogus"), KeyRuleId},
+		{request(RequestTypeSign, unknown, "m/44/60/0/0/3"), KeyRuleId},
+		{request(RequestTypeSign, restricted, "m/1"), DefaultRuleId},
+		{request(RequestTypeSign, restricted, "m/44/60/0/0/3"), KeyRuleId},
+		// keygens have no key yet
+		{&Check{RequestType: RequestTypeKeygen}, DefaultRuleId},
+	}
+	for i, tt := range tests {
+		decision, err := policy.Evaluate(tt.request, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decision.RuleId != tt.ruleId {
+			t.Errorf("#%d: got rule %s (%s), want %s", i, decision.RuleId, decision.Reason, tt.ruleId)
+		}
+	}
+
+	// with a registry, keys are checked whenever the path parses
+	lenient, err := NewRulePolicy(&PolicyConfig{DefaultAction: Approve, Keys: &KeyPolicy{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lenient.UseKeyRegistry(registry)
+	for i, tt := range []struct {
+		request *Check
+		ruleId  string
+	}{
+		{request(RequestTypeSign, known, "m/44/60/0/1/3"), DefaultRuleId},
+		{request(RequestTypeSign, unknown, "m/44/60/0/0/3"), KeyRuleId},
+		{request(RequestTypeSign, unknown, "bogus"), DefaultRuleId},
+	} {
+		if decision, err := lenient.Evaluate(tt.request, time.Now()); err != nil || decision.RuleId != tt.ruleId {
+			t.Errorf("lenient #%d: got %+v, %v, want %s", i, decision, err, tt.ruleId)
+		}
+	}
+	if _, err = NewRulePolicy(&PolicyConfig{Rules: []*Rule{{Id: KeyRuleId, Action: Approve}}}); err == nil {
+		t.Error("reserved rule id accepted")
+	}
+}
+
+func TestKeyPolicyDerivation(t *testing.T) {
+	policy, err := NewRulePolicy(&PolicyConfig{
+		DefaultAction: Approve,
+		Keys:          &KeyPolicy{RequireKnownKey: true, VerifySender: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewKeyRegistry()
+	if err = registry.Register(&RootKey{ExtendedKey: testXpub0H}); err != nil {
+		t.Fatal(err)
+	}
+	policy.UseKeyRegistry(registry)
+	root := registry.Keys()[0].PublicKey
+	childKey, _, _ := ParseExtendedPublicKey(testXpub0H1)
+	child := hex.EncodeToString(childKey.SerializeCompressed())
+	sender := EVMAddress(childKey)
+
+	request := func(publicKey, path, txInfo string) *Check {
+		return &Check{RequestType: RequestTypeSign, RequestDetail: RequestDetail{
+			PublicKey: publicKey,
+			Path:      path,
+			TxInfo:    json.RawMessage(txInfo),
+		}}
+	}
+	tests := []struct {
+		request *Check
+		ruleId  string
+	}{
+		{request(child, "m/1", ""), DefaultRuleId},
+		{request(child, "m/2", ""), KeyRuleId},
+		{request(child, "m/1'", ""), KeyRuleId},
+		{request(root, "m/1", `{"chain":"eth","from":"`+EIP55Checksum(sender)+`"}`), DefaultRuleId},
+		{request(child, "m/1", `{"chain":"eth","from":"`+sender+`"}`), DefaultRuleId},
+		{request(child, "m/1", `{"chain":"eth","from":"0x7e5f4552091a69125d5dfcb7b8c2659029395bdf"}`), KeyRuleId},
+		{request(root, "m/0", `{"chain":"eth","from":"`+sender+`"}`), KeyRuleId},
+		// the sender of other chains is not checked
+		{request(child, "m/1", `{"chain":"btc","from":"1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH"}`), DefaultRuleId},
+	}
+	for i, tt := range tests {
+		decision, err := policy.Evaluate(tt.request, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decision.RuleId != tt.ruleId {
+			t.Errorf("#%d: got rule %s (%s), want %s", i, decision.RuleId, decision.Reason, tt.ruleId)
+		}
+	}
+	if err = registry.Register(&RootKey{ExtendedKey: testXpub0H, PublicKey: child}); err == nil {
+		t.Error("public key not matching the xpub accepted")
+	}
+	// the cached derived keys are dropped with their root key
+	if removed, err := registry.Remove(root); !removed || err != nil {
+		t.Fatal(removed, err)
+	}
+	if derivedRoot, _ := registry.Derived(child, []uint32{1}); derivedRoot != nil {
+		t.Error("derived from a removed key")
+	}
+}
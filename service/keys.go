@@ -0,0 +1,345 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+
+	"github.com/sinohope/mpc-node-callback-demo/service/ecies"
+)
+
+// crypto/x509 only knows the NIST curves, secp256k1 and X25519 keys are
+// handled here.
+var (
+	oidPublicKeyECDSA  = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidNamedCurveS256  = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+	oidPublicKeyX25519 = asn1.ObjectIdentifier{1, 3, 101, 110}
+)
+
+const (
+	ecPrivKeyVersion   = 1
+	secp256k1KeyLength = 32
+)
+
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+type pkixPublicKey struct {
+	Algo      pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// ParsePrivateKeyPEM parses the first private key block of pemData. Both
+// SEC1 and PKCS#8 encodings are accepted regardless of the block label, and
+// the key may be an ECDSA (NIST or secp256k1) or an Ed25519 key.
+func ParsePrivateKeyPEM(pemData []byte) (crypto.Signer, error) {
+	var block *pem.Block
+	for {
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			return nil, fmt.Errorf("failed to find PEM block containing the private key")
+		}
+		if block.Type == "EC PRIVATE KEY" || block.Type == "PRIVATE KEY" {
+			break
+		}
+	}
+	return ParsePrivateKeyDER(block.Bytes)
+}
+
+// ParsePrivateKeyDER parses a SEC1 or PKCS#8 encoded private key.
+func ParsePrivateKeyDER(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		switch k := key.(type) {
+		case *ecdsa.PrivateKey:
+			return k, nil
+		case ed25519.PrivateKey:
+			return k, nil
+		default:
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+	}
+	if key, err := parseSecp256k1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("failed to parse private key")
+}
+
+func parseSecp256k1PrivateKey(der []byte) (*ecdsa.PrivateKey, error) {
+	var p8 pkcs8
+	if _, err := asn1.Unmarshal(der, &p8); err == nil && p8.Algo.Algorithm.Equal(oidPublicKeyECDSA) {
+		var curve asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(p8.Algo.Parameters.FullBytes, &curve); err != nil || !curve.Equal(oidNamedCurveS256) {
+			return nil, fmt.Errorf("not a secp256k1 key")
+		}
+		der = p8.PrivateKey
+	}
+	var sec1 ecPrivateKey
+	if _, err := asn1.Unmarshal(der, &sec1); err != nil {
+		return nil, err
+	}
+	if sec1.Version != ecPrivKeyVersion {
+		return nil, fmt.Errorf("unknown EC private key version %d", sec1.Version)
+	}
+	if len(sec1.NamedCurveOID) > 0 && !sec1.NamedCurveOID.Equal(oidNamedCurveS256) {
+		return nil, fmt.Errorf("not a secp256k1 key")
+	}
+	if len(sec1.PrivateKey) > secp256k1KeyLength {
+		return nil, fmt.Errorf("invalid secp256k1 private key length")
+	}
+	return secp256k1PrivateKey(sec1.PrivateKey)
+}
+
+func secp256k1PrivateKey(d []byte) (*ecdsa.PrivateKey, error) {
+	curve := btcec.S256()
+	k := new(big.Int).SetBytes(d)
+	if k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+		return nil, fmt.Errorf("invalid secp256k1 private key")
+	}
+	key := &ecdsa.PrivateKey{D: k}
+	key.Curve = curve
+	key.X, key.Y = curve.ScalarBaseMult(k.Bytes())
+	return key, nil
+}
+
+// ParsePublicKeyPEM parses a PKIX "PUBLIC KEY" block holding an ECDSA (NIST
+// or secp256k1) or Ed25519 public key.
+func ParsePublicKeyPEM(pemData []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("failed to decode PEM block containing the public key")
+	}
+	return ParsePublicKeyDER(block.Bytes)
+}
+
+// ParsePublicKeyDER parses a PKIX encoded public key.
+func ParsePublicKeyDER(der []byte) (crypto.PublicKey, error) {
+	if key, err := parseX25519PublicKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		switch k := key.(type) {
+		case *ecdsa.PublicKey:
+			return k, nil
+		case ed25519.PublicKey:
+			return k, nil
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+	}
+	var pki pkixPublicKey
+	if _, err := asn1.Unmarshal(der, &pki); err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	var curve asn1.ObjectIdentifier
+	if !pki.Algo.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, fmt.Errorf("unsupported public key algorithm %v", pki.Algo.Algorithm)
+	}
+	if _, err := asn1.Unmarshal(pki.Algo.Parameters.FullBytes, &curve); err != nil || !curve.Equal(oidNamedCurveS256) {
+		return nil, fmt.Errorf("unsupported elliptic curve")
+	}
+	pub, err := btcec.ParsePubKey(pki.PublicKey.RightAlign())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse secp256k1 public key: %v", err)
+	}
+	return pub.ToECDSA(), nil
+}
+
+func parseX25519PublicKey(der []byte) (ecies.X25519PublicKey, error) {
+	var pki pkixPublicKey
+	if _, err := asn1.Unmarshal(der, &pki); err != nil {
+		return nil, err
+	}
+	if !pki.Algo.Algorithm.Equal(oidPublicKeyX25519) {
+		return nil, fmt.Errorf("not an X25519 key")
+	}
+	key := pki.PublicKey.RightAlign()
+	if len(key) != ecies.X25519KeySize {
+		return nil, fmt.Errorf("invalid X25519 public key length %d", len(key))
+	}
+	return ecies.X25519PublicKey(key), nil
+}
+
+// ParseX25519PrivateKeyPEM parses the first "PRIVATE KEY" block of pemData
+// as a PKCS#8 X25519 key.
+func ParseX25519PrivateKeyPEM(pemData []byte) (ecies.X25519PrivateKey, error) {
+	var block *pem.Block
+	for {
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			return nil, fmt.Errorf("failed to find PEM block containing the private key")
+		}
+		if block.Type == "PRIVATE KEY" {
+			break
+		}
+	}
+	return ParseX25519PrivateKeyDER(block.Bytes)
+}
+
+// ParseX25519PrivateKeyDER parses a PKCS#8 encoded X25519 private key.
+func ParseX25519PrivateKeyDER(der []byte) (ecies.X25519PrivateKey, error) {
+	var p8 pkcs8
+	if _, err := asn1.Unmarshal(der, &p8); err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	if !p8.Algo.Algorithm.Equal(oidPublicKeyX25519) {
+		return nil, fmt.Errorf("not an X25519 key")
+	}
+	var key []byte
+	if _, err := asn1.Unmarshal(p8.PrivateKey, &key); err != nil || len(key) != ecies.X25519KeySize {
+		return nil, fmt.Errorf("invalid X25519 private key")
+	}
+	return ecies.X25519PrivateKey(key), nil
+}
+
+// MarshalX25519PrivateKeyPEM encodes key as a PKCS#8 "PRIVATE KEY" block.
+func MarshalX25519PrivateKeyPEM(key ecies.X25519PrivateKey) ([]byte, error) {
+	inner, err := asn1.Marshal([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	der, err := asn1.Marshal(pkcs8{
+		Algo:       pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyX25519},
+		PrivateKey: inner,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// Private key encodings accepted by MarshalPrivateKeyPEM.
+const (
+	KeyFormatSEC1  = "sec1"
+	KeyFormatPKCS8 = "pkcs8"
+)
+
+// MarshalPrivateKeyPEM encodes key as an "EC PRIVATE KEY" (SEC1) or
+// "PRIVATE KEY" (PKCS#8) PEM block. Ed25519 keys only exist as PKCS#8.
+func MarshalPrivateKeyPEM(key crypto.Signer, format string) ([]byte, error) {
+	der, err := MarshalPrivateKeyDER(key, format)
+	if err != nil {
+		return nil, err
+	}
+	blockType := "PRIVATE KEY"
+	if format == KeyFormatSEC1 {
+		blockType = "EC PRIVATE KEY"
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), nil
+}
+
+// MarshalPrivateKeyDER encodes key in SEC1 or PKCS#8 DER.
+func MarshalPrivateKeyDER(key crypto.Signer, format string) ([]byte, error) {
+	ecKey, isEC := key.(*ecdsa.PrivateKey)
+	switch format {
+	case KeyFormatSEC1:
+		if !isEC {
+			return nil, fmt.Errorf("%T can not be encoded as SEC1", key)
+		}
+		if ecies.IsSecp256k1(ecKey.Curve) {
+			return marshalSecp256k1PrivateKey(ecKey, oidNamedCurveS256)
+		}
+		return x509.MarshalECPrivateKey(ecKey)
+	case KeyFormatPKCS8:
+		if isEC && ecies.IsSecp256k1(ecKey.Curve) {
+			sec1, err := marshalSecp256k1PrivateKey(ecKey, nil)
+			if err != nil {
+				return nil, err
+			}
+			params, err := asn1.Marshal(oidNamedCurveS256)
+			if err != nil {
+				return nil, err
+			}
+			return asn1.Marshal(pkcs8{
+				Algo:       pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: params}},
+				PrivateKey: sec1,
+			})
+		}
+		return x509.MarshalPKCS8PrivateKey(key)
+	}
+	return nil, fmt.Errorf("unknown private key format %q", format)
+}
+
+func marshalSecp256k1PrivateKey(key *ecdsa.PrivateKey, oid asn1.ObjectIdentifier) ([]byte, error) {
+	d := make([]byte, secp256k1KeyLength)
+	key.D.FillBytes(d)
+	return asn1.Marshal(ecPrivateKey{
+		Version:       ecPrivKeyVersion,
+		PrivateKey:    d,
+		NamedCurveOID: oid,
+		PublicKey:     pointBitString(&key.PublicKey),
+	})
+}
+
+// MarshalPublicKeyPEM encodes key as a PKIX "PUBLIC KEY" PEM block, the
+// format the mpc-node and the callback server exchange public keys in.
+func MarshalPublicKeyPEM(key crypto.PublicKey) ([]byte, error) {
+	der, err := MarshalPublicKeyDER(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// MarshalPublicKeyDER encodes key in PKIX DER.
+func MarshalPublicKeyDER(key crypto.PublicKey) ([]byte, error) {
+	if x25519Key, ok := key.(ecies.X25519PublicKey); ok {
+		return asn1.Marshal(pkixPublicKey{
+			Algo:      pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyX25519},
+			PublicKey: asn1.BitString{Bytes: x25519Key, BitLength: 8 * len(x25519Key)},
+		})
+	}
+	if ecKey, ok := key.(*ecdsa.PublicKey); ok && ecies.IsSecp256k1(ecKey.Curve) {
+		params, err := asn1.Marshal(oidNamedCurveS256)
+		if err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(pkixPublicKey{
+			Algo:      pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: params}},
+			PublicKey: pointBitString(ecKey),
+		})
+	}
+	return x509.MarshalPKIXPublicKey(key)
+}
+
+// pointBitString returns the uncompressed SEC1 encoding of key.
+func pointBitString(key *ecdsa.PublicKey) asn1.BitString {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	point := make([]byte, 1+2*size)
+	point[0] = 4
+	key.X.FillBytes(point[1 : 1+size])
+	key.Y.FillBytes(point[1+size:])
+	return asn1.BitString{Bytes: point, BitLength: 8 * len(point)}
+}
+
+// Fingerprint returns the hex encoded sha256 of the PKIX DER encoding of key.
+func Fingerprint(key crypto.PublicKey) (string, error) {
+	der, err := MarshalPublicKeyDER(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	LimitPerSinoId      = "sino_id"
+	LimitPerDestination = "destination"
+	LimitPerToken       = "token"
+)
+
+// Limit caps the requests approved by the policy rules. A Limit with a
+// Window counts the matching requests and sums their tx_info amount over a
+// sliding window, separately for every value of Per (or globally when Per
+// is empty). Requests without a value for Per share one window. A Limit
+// without a Window caps the amount of a single request. Amounts of
+// different tokens are not comparable, so MaxAmount needs Per token or a
+// Match on tokens. When a limit would be exceeded the request gets Action,
+// REJECT or WAIT.
+type Limit struct {
+	Id        string    `json:"id"`
+	Action    string    `json:"action"`
+	WaitTime  string    `json:"wait_time,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Match     RuleMatch `json:"match"`
+	Per       string    `json:"per,omitempty"`
+	Window    string    `json:"window,omitempty"`
+	MaxCount  int       `json:"max_count,omitempty"`
+	MaxAmount string    `json:"max_amount,omitempty"`
+
+	window    time.Duration
+	maxAmount *big.Rat
+}
+
+func (l *Limit) validate() error {
+	if l.Id == "" {
+		return fmt.Errorf("limit has no id")
+	}
+	if l.Action != Reject && l.Action != Wait {
+		return fmt.Errorf("limit %s: action must be %s or %s, got %q", l.Id, Reject, Wait, l.Action)
+	}
+	switch l.Per {
+	case "", LimitPerSinoId, LimitPerDestination, LimitPerToken:
+	default:
+		return fmt.Errorf("limit %s: invalid per %q", l.Id, l.Per)
+	}
+	if l.MaxAmount != "" {
+		amount, ok := new(big.Rat).SetString(l.MaxAmount)
+		if !ok || amount.Sign() < 0 {
+			return fmt.Errorf("limit %s: invalid max_amount %q", l.Id, l.MaxAmount)
+		}
+		l.maxAmount = amount
+	}
+	if l.MaxCount < 0 {
+		return fmt.Errorf("limit %s: invalid max_count %d", l.Id, l.MaxCount)
+	}
+	if l.maxAmount != nil && l.Per != LimitPerToken && len(l.Match.Tokens) == 0 {
+		return fmt.Errorf("limit %s: max_amount requires per %s or match tokens", l.Id, LimitPerToken)
+	}
+	if l.Window == "" {
+		if l.maxAmount == nil || l.MaxCount != 0 || (l.Per != "" && l.Per != LimitPerToken) {
+			return fmt.Errorf("limit %s: a limit without window only takes max_amount", l.Id)
+		}
+		return nil
+	}
+	window, err := time.ParseDuration(l.Window)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("limit %s: invalid window %q", l.Id, l.Window)
+	}
+	l.window = window
+	if l.maxAmount == nil && l.MaxCount == 0 {
+		return fmt.Errorf("limit %s: max_count or max_amount is required", l.Id)
+	}
+	return nil
+}
+
+// key returns the window of request, the empty key is the window of the
+// requests without a value for Per.
+func (l *Limit) key(request *Check, tx *TxInfo) string {
+	switch l.Per {
+	case LimitPerSinoId:
+		return request.SinoId
+	case LimitPerDestination:
+		return tx.To
+	case LimitPerToken:
+		return tx.Token
+	}
+	return ""
+}
+
+// limitEvent is a counted request. A request sent again with the same
+// RequestId replaces its event instead of being counted twice.
+type limitEvent struct {
+	Time      time.Time `json:"time"`
+	RequestId string    `json:"request_id,omitempty"`
+	Amount    string    `json:"amount,omitempty"`
+}
+
+// limitWindows are the events of every window of a limit, by window key.
+type limitWindows map[string][]*limitEvent
+
+type limitState struct {
+	Limits map[string]limitWindows `json:"limits"`
+}
+
+// limiter keeps the sliding windows of a set of limits, persisted in an
+// optional FileStore.
+type limiter struct {
+	mu     sync.Mutex
+	limits []*Limit
+	state  *limitState
+	store  *FileStore
+	// last is the time of the last counted request, windows are kept in
+	// time order.
+	last time.Time
+}
+
+func newLimiter(limits []*Limit) *limiter {
+	l := &limiter{limits: limits, state: &limitState{Limits: make(map[string]limitWindows)}}
+	for _, limit := range limits {
+		if limit.window > 0 {
+			l.state.Limits[limit.Id] = make(limitWindows)
+		}
+	}
+	return l
+}
+
+// persist loads the windows saved in store and saves every later change
+// to it. Windows of limits that are no longer configured are dropped.
+func (l *limiter) persist(store *FileStore) error {
+	saved := &limitState{}
+	if err := store.Load(saved); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, windows := range saved.Limits {
+		if _, ok := l.state.Limits[id]; ok && windows != nil {
+			l.state.Limits[id] = windows
+		}
+	}
+	l.store = store
+	return nil
+}
+
+// check returns the first limit request would exceed at now. When none is
+// exceeded the request is counted in every matching window. now is taken
+// under the lock and never before the last counted request, so concurrent
+// requests keep the windows in time order. A tx_info that cannot be parsed
+// is an error, the limits can not be enforced without it.
+func (l *limiter) check(e *evaluation, now time.Time) (*Limit, error) {
+	tx, err := e.txInfo()
+	if err != nil {
+		return nil, err
+	}
+	amount := tx.Amount
+	if amount == nil {
+		amount = new(big.Rat)
+	}
+	requestId := e.request.ExtraInfo.RequestId
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Before(l.last) {
+		now = l.last
+	}
+	type window struct {
+		limit  string
+		key    string
+		events []*limitEvent
+	}
+	var counted []window
+	for _, limit := range l.limits {
+		ok, err := limit.Match.matches(e)
+		if err != nil {
+			return nil, fmt.Errorf("limit %s: %v", limit.Id, err)
+		}
+		if !ok {
+			continue
+		}
+		if limit.window == 0 {
+			if amount.Cmp(limit.maxAmount) > 0 {
+				return limit, nil
+			}
+			continue
+		}
+		key := limit.key(e.request, tx)
+		windows := l.state.Limits[limit.Id]
+		events := withoutRequest(prune(windows, key, now.Add(-limit.window)), requestId)
+		if limit.MaxCount > 0 && len(events)+1 > limit.MaxCount {
+			return limit, nil
+		}
+		if limit.maxAmount != nil {
+			total := new(big.Rat).Set(amount)
+			for _, event := range events {
+				if a, ok := new(big.Rat).SetString(event.Amount); ok {
+					total.Add(total, a)
+				}
+			}
+			if total.Cmp(limit.maxAmount) > 0 {
+				return limit, nil
+			}
+		}
+		counted = append(counted, window{limit.Id, key, events})
+	}
+	if len(counted) == 0 {
+		return nil, nil
+	}
+	event := &limitEvent{Time: now.UTC(), RequestId: requestId}
+	if tx.Amount != nil {
+		event.Amount = tx.Amount.RatString()
+	}
+	// the request is only counted in memory once it is saved
+	state := &limitState{Limits: make(map[string]limitWindows, len(l.state.Limits))}
+	for id, windows := range l.state.Limits {
+		state.Limits[id] = make(limitWindows, len(windows))
+		for key, events := range windows {
+			state.Limits[id][key] = events
+		}
+	}
+	for _, w := range counted {
+		state.Limits[w.limit][w.key] = append(w.events[:len(w.events):len(w.events)], event)
+	}
+	if l.store != nil {
+		for _, limit := range l.limits {
+			if limit.window > 0 {
+				for key := range state.Limits[limit.Id] {
+					prune(state.Limits[limit.Id], key, now.Add(-limit.window))
+				}
+			}
+		}
+		if err = l.store.Save(state); err != nil {
+			return nil, err
+		}
+	}
+	l.state = state
+	l.last = now
+	return nil, nil
+}
+
+// withoutRequest returns events without the event of requestId, if any.
+func withoutRequest(events []*limitEvent, requestId string) []*limitEvent {
+	if requestId == "" {
+		return events
+	}
+	for i, event := range events {
+		if event.RequestId == requestId {
+			return append(events[:i:i], events[i+1:]...)
+		}
+	}
+	return events
+}
+
+// prune drops the events of the window key older than since and returns
+// the rest.
+func prune(windows limitWindows, key string, since time.Time) []*limitEvent {
+	events := windows[key]
+	i := 0
+	for i < len(events) && !events[i].Time.After(since) {
+		i++
+	}
+	events = events[i:]
+	if len(events) == 0 {
+		delete(windows, key)
+	} else {
+		windows[key] = events
+	}
+	return events
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func signRequest(sinoId, txInfo string) *Check {
+	return &Check{
+		RequestType:   "sign",
+		RequestDetail: RequestDetail{TxInfo: json.RawMessage(txInfo)},
+		ExtraInfo:     ExtraInfo{SinoId: sinoId},
+	}
+}
+
+func testLimits(t *testing.T) []*Limit {
+	limits := []*Limit{
+		{Id: "per-request", Action: Reject, Per: LimitPerToken, MaxAmount: "100"},
+		{Id: "hourly", Action: Wait, Per: LimitPerSinoId, Window: "1h", MaxCount: 2,
+			Match: RuleMatch{RequestTypes: []string{"sign"}}},
+		{Id: "daily-destination", Action: Reject, Per: LimitPerDestination, Window: "24h", MaxAmount: "150",
+			Match: RuleMatch{Tokens: []string{"USDT"}}},
+	}
+	for _, limit := range limits {
+		if err := limit.validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return limits
+}
+
+func checkLimit(t *testing.T, l *limiter, request *Check, now time.Time, want string) {
+	t.Helper()
+	limit, err := l.check(&evaluation{request: request}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ""
+	if limit != nil {
+		got = limit.Id
+	}
+	if got != want {
+		t.Errorf("got limit %q, want %q", got, want)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(testLimits(t))
+	now := time.Unix(1700000000, 0)
+
+	checkLimit(t, l, signRequest("a", `{"token":"USDT","to":"0xAB","amount":"101"}`), now, "per-request")
+	checkLimit(t, l, signRequest("a", `{"token":"USDT","to":"0xAB","amount":"100"}`), now, "")
+	checkLimit(t, l, signRequest("a", `{"token":"USDT","to":"0xab","amount":"50.5"}`), now, "daily-destination")
+	checkLimit(t, l, signRequest("a", `{"token":"USDT","to":"0xcd","amount":50}`), now.Add(time.Minute), "")
+	// two sign requests of sino a in the last hour
+	checkLimit(t, l, signRequest("a", `{"token":"USDT","to":"0xef"}`), now.Add(2*time.Minute), "hourly")
+	checkLimit(t, l, signRequest("b", `{"token":"USDT","to":"0xef"}`), now.Add(2*time.Minute), "")
+	checkLimit(t, l, signRequest("a", `{"token":"USDT","to":"0xef"}`), now.Add(time.Hour+time.Second), "")
+	// the first 100 to 0xab leaves the daily window
+	checkLimit(t, l, signRequest("c", `{"token":"USDT","to":"0xab","amount":"100"}`), now.Add(24*time.Hour-time.Second), "daily-destination")
+	checkLimit(t, l, signRequest("c", `{"token":"USDT","to":"0xab","amount":"100"}`), now.Add(24*time.Hour), "")
+
+	if _, err := l.check(&evaluation{request: signRequest("a", `{"amount":"x"}`)}, now); err == nil {
+		t.Error("invalid tx_info accepted")
+	}
+}
+
+func TestLimiterPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	now := time.Unix(1700000000, 0)
+	for i := 0; i < 2; i++ {
+		store, err := OpenFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := newLimiter(testLimits(t))
+		if err = l.persist(store); err != nil {
+			t.Fatal(err)
+		}
+		checkLimit(t, l, signRequest("a", `{"token":"USDT","to":"0xab","amount":"60"}`), now, "")
+	}
+	l := newLimiter(testLimits(t))
+	store, _ := OpenFileStore(path)
+	if err := l.persist(store); err != nil {
+		t.Fatal(err)
+	}
+	checkLimit(t, l, signRequest("b", `{"token":"USDT","to":"0xab","amount":"40"}`), now, "daily-destination")
+	checkLimit(t, l, signRequest("a", `{"token":"USDT","to":"0xcd"}`), now, "hourly")
+}
+
+func TestRulePolicyLimits(t *testing.T) {
+	policy, err := NewRulePolicy(&PolicyConfig{
+		Rules:  []*Rule{{Id: "reject-b", Action: Reject, Match: RuleMatch{SinoIds: []string{"b"}}}},
+		Limits: []*Limit{{Id: "cap", Action: Wait, WaitTime: "30", Per: LimitPerToken, MaxAmount: "10"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decision, err := policy.Evaluate(signRequest("a", `{"amount":"11"}`), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Action != Wait || decision.WaitTime != "30" || decision.RuleId != "cap" || decision.Reason == "" {
+		t.Errorf("unexpected decision %+v", decision)
+	}
+	// limits only apply to approved requests
+	if decision, _ = policy.Evaluate(signRequest("b", `{"amount":"11"}`), time.Now()); decision.RuleId != "reject-b" {
+		t.Errorf("unexpected decision %+v", decision)
+	}
+}
+
+func TestLimitInvalid(t *testing.T) {
+	limits := []*Limit{
+		{Id: "a", Action: Approve, Per: LimitPerToken, MaxAmount: "1"},
+		{Id: "a", Action: Reject},
+		{Id: "a", Action: Reject, MaxCount: 1},
+		{Id: "a", Action: Reject, Window: "1h"},
+		{Id: "a", Action: Reject, Window: "1d", MaxCount: 1},
+		{Id: "a", Action: Reject, Window: "1h", Per: LimitPerToken, MaxAmount: "-1"},
+		{Id: "a", Action: Reject, MaxAmount: "1"},
+		{Id: "a", Action: Reject, Window: "1h", Per: LimitPerDestination, MaxAmount: "1"},
+		{Id: "a", Action: Reject, Window: "1h", MaxCount: 1, Per: "wallet"},
+	}
+	for i, limit := range limits {
+		if err := limit.validate(); err == nil {
+			t.Errorf("#%d: invalid limit accepted", i)
+		}
+	}
+}
+
+func TestParseTxInfo(t *testing.T) {
+	tx, err := ParseTxInfo(json.RawMessage(`"{\"to\":\"0xAbC\",\"token\":\"USDT\",\"amount\":\"1.25\",\"extra\":1}"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.To != "0xabc" || tx.Token != "USDT" || tx.Amount.FloatString(2) != "1.25" {
+		t.Errorf("unexpected tx_info %+v", tx)
+	}
+	for to, want := range map[string]string{
+		"0XAbC": "0xabc",
+		"TB1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KXPJZSX": "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx",
+		"TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t":         "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t",
+	} {
+		if tx, err = ParseTxInfo(json.RawMessage(`{"to":"` + to + `"}`)); err != nil || tx.To != want {
+			t.Errorf("%s: got %+v, %v", to, tx, err)
+		}
+	}
+	if tx, err = ParseTxInfo(nil); err != nil || tx.Amount != nil {
+		t.Errorf("empty tx_info: %+v, %v", tx, err)
+	}
+	for _, raw := range []string{`{"amount":"-1"}`, `{"amount":"1e"}`, `[]`} {
+		if _, err = ParseTxInfo(json.RawMessage(raw)); err == nil {
+			t.Errorf("%s accepted", raw)
+		}
+	}
+}
+
+func TestLimiterRequestId(t *testing.T) {
+	limit := &Limit{Id: "hourly", Action: Reject, Per: LimitPerSinoId, Window: "1h", MaxCount: 2}
+	if err := limit.validate(); err != nil {
+		t.Fatal(err)
+	}
+	l := newLimiter([]*Limit{limit})
+	now := time.Unix(1700000000, 0)
+	request := signRequest("a", `{}`)
+	request.ExtraInfo.RequestId = "r1"
+	// the mpc-node retries r1, it is only counted once
+	checkLimit(t, l, request, now, "")
+	checkLimit(t, l, request, now.Add(time.Minute), "")
+	checkLimit(t, l, request, now.Add(2*time.Minute), "")
+	if events := l.state.Limits["hourly"]["a"]; len(events) != 1 || !events[0].Time.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("got events %+v", events)
+	}
+	checkLimit(t, l, signRequest("a", `{}`), now.Add(3*time.Minute), "")
+	checkLimit(t, l, signRequest("a", `{}`), now.Add(3*time.Minute), "hourly")
+
+	// requests without sino id share a window
+	checkLimit(t, l, signRequest("", `{}`), now, "")
+	checkLimit(t, l, signRequest("", `{}`), now, "")
+	checkLimit(t, l, signRequest("", `{}`), now, "hourly")
+}
+
+func TestLimiterOrder(t *testing.T) {
+	limit := &Limit{Id: "hourly", Action: Reject, Window: "1h", MaxCount: 10}
+	if err := limit.validate(); err != nil {
+		t.Fatal(err)
+	}
+	l := newLimiter([]*Limit{limit})
+	now := time.Unix(1700000000, 0)
+	checkLimit(t, l, signRequest("a", `{}`), now.Add(time.Minute), "")
+	// a request evaluated earlier that got the lock later
+	checkLimit(t, l, signRequest("a", `{}`), now, "")
+	events := l.state.Limits["hourly"][""]
+	if len(events) != 2 || events[1].Time.Before(events[0].Time) {
+		t.Errorf("events out of order %+v", events)
+	}
+}
+
+func TestLimiterSaveFailed(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenFileStore(filepath.Join(dir, "limits.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := &Limit{Id: "hourly", Action: Reject, Window: "1h", MaxCount: 1}
+	if err = limit.validate(); err != nil {
+		t.Fatal(err)
+	}
+	l := newLimiter([]*Limit{limit})
+	if err = l.persist(store); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	if _, err = l.check(&evaluation{request: signRequest("a", `{}`)}, now); err == nil {
+		t.Fatal("counted a request that was not saved")
+	}
+	if len(l.state.Limits["hourly"]) != 0 {
+		t.Errorf("unsaved request counted in memory %+v", l.state.Limits["hourly"])
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// counterVec is a Prometheus style counter partitioned by label values.
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]uint64)}
+}
+
+// Inc increments the counter of the given label values, which must be in
+// the order of the labels the counter was created with.
+func (v *counterVec) Inc(values ...string) {
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	v.values[key]++
+	v.mu.Unlock()
+}
+
+// Get returns the counter of the given label values.
+func (v *counterVec) Get(values ...string) uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.values[strings.Join(values, "\xff")]
+}
+
+func (v *counterVec) writeTo(w io.Writer) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 && len(v.labels) == 0 {
+		keys = append(keys, "")
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", v.name, v.help, v.name)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %d\n", v.name, v.labelString(key), v.values[key])
+	}
+	v.mu.Unlock()
+}
+
+func (v *counterVec) labelString(key string) string {
+	if len(v.labels) == 0 {
+		return ""
+	}
+	values := strings.Split(key, "\xff")
+	pairs := make([]string, len(v.labels))
+	for i, label := range v.labels {
+		pairs[i] = fmt.Sprintf("%s=%q", label, values[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Metrics are the counters exported on /metrics.
+type Metrics struct {
+	Requests            *counterVec
+	Errors              *counterVec
+	ShadowEvaluations   *counterVec
+	ShadowDisagreements *counterVec
+	ShadowErrors        *counterVec
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Requests: newCounterVec("callback_requests_total",
+			"Callback requests answered, by path, action and rule.", "path", "action", "rule_id"),
+		Errors: newCounterVec("callback_errors_total",
+			"Callback requests answered with an error, by path and error code.", "path", "code"),
+		ShadowEvaluations: newCounterVec("callback_shadow_evaluations_total",
+			"Requests evaluated by the shadow policy, by shadow action.", "action", "rule_id"),
+		ShadowDisagreements: newCounterVec("callback_shadow_disagreements_total",
+			"Requests the shadow policy decided differently from the active policy.", "active_action", "shadow_action", "shadow_rule_id"),
+		ShadowErrors: newCounterVec("callback_shadow_errors_total",
+			"Requests the shadow policy failed to evaluate."),
+	}
+}
+
+func (m *Metrics) counters() []*counterVec {
+	return []*counterVec{m.Requests, m.Errors, m.ShadowEvaluations, m.ShadowDisagreements, m.ShadowErrors}
+}
+
+// Write writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) Write(w io.Writer) {
+	for _, counter := range m.counters() {
+		counter.writeTo(w)
+	}
+}
+
+func (c *CallbackService) Metrics(g *gin.Context) {
+	g.Header("Content-Type", "text/plain; version=0.0.4")
+	g.Status(http.StatusOK)
+	c.metrics.Write(g.Writer)
+}
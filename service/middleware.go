@@ -0,0 +1,79 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/gin-gonic/gin"
+)
+
+const verifiedBodyKey = "callback/verified-body"
+
+// VerifiedBody is a gin middleware that verifies the Signature header against
+// the exact raw request body, or its RFC 8785 canonical form when
+// CanonicalJSON is configured, with the mpc-node public key in the
+// configured SignatureFormat before any parsing happens. Handlers behind it
+// read the body with VerifiedBodyBytes or BindVerified, never from
+// g.Request.Body.
+func (c *CallbackService) VerifiedBody() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		body, err := io.ReadAll(g.Request.Body)
+		if err != nil {
+			c.fail(g, ErrMalformedBody, err)
+			return
+		}
+		signature, ok := g.Request.Header["Signature"]
+		if !ok || len(signature) == 0 || signature[0] == "" {
+			c.fail(g, ErrSignatureMissing, nil)
+			return
+		}
+		signed := body
+		if c.cfg.CanonicalJSON {
+			if signed, err = CanonicalJSON(body); err != nil {
+				c.fail(g, ErrMalformedBody, err)
+				return
+			}
+		}
+		if apiErr := c.verifier.Verify(signed, signature[0]); apiErr != nil {
+			c.fail(g, apiErr, fmt.Errorf("signature: %s", signature[0]))
+			return
+		}
+		g.Set(verifiedBodyKey, body)
+		g.Next()
+	}
+}
+
+// VerifyBody checks a hex encoded ASN.1 signature over sha256(body).
+func VerifyBody(public *ecdsa.PublicKey, body []byte, signature string) *APIError {
+	signatureBytes, err := hex.DecodeString(signature)
+	if err != nil {
+		return ErrSignatureBadHex
+	}
+	hash := sha256.Sum256(body)
+	if !ecdsa.VerifyASN1(public, hash[:], signatureBytes) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// VerifiedBodyBytes returns the body verified by VerifiedBody, or nil when the
+// middleware did not run for this request.
+func VerifiedBodyBytes(g *gin.Context) []byte {
+	if body, ok := g.Get(verifiedBodyKey); ok {
+		return body.([]byte)
+	}
+	return nil
+}
+
+// BindVerified unmarshals the verified body into v.
+func BindVerified(g *gin.Context, v interface{}) error {
+	body := VerifiedBodyBytes(g)
+	if body == nil {
+		return fmt.Errorf("request body was not verified")
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveVerified sends body with signature to a route behind VerifiedBody
+// whose handler binds the verified body, it returns the response and what
+// the handler saw.
+func serveVerified(t *testing.T, s *testService, body []byte, signature string) (*httptest.ResponseRecorder, map[string]interface{}, []byte) {
+	var bound map[string]interface{}
+	var unread []byte
+	r := gin.New()
+	r.POST("/check", s.VerifiedBody(), func(g *gin.Context) {
+		unread, _ = io.ReadAll(g.Request.Body)
+		if err := BindVerified(g, &bound); err != nil {
+			t.Error(err)
+		}
+		g.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/check", bytes.NewReader(body))
+	if signature != "" {
+		req.Header.Set("Signature", signature)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w, bound, unread
+}
+
+func TestVerifiedBody(t *testing.T) {
+	s := newTestService(t, &CallbackServiceConfig{})
+	// keys out of order and extra whitespace, as the mpc-node may send them
+	body := []byte("{\n  \"request_type\": \"keygen\",  \"callback_id\" : \"c1\"\n}")
+	mpcNode := &hexSigner{key: s.mpcNodeKey}
+	signature, err := mpcNode.Sign(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, bound, unread := serveVerified(t, s, body, signature)
+	if w.Code != http.StatusOK {
+		t.Fatalf("raw body signature: got %d %s", w.Code, w.Body)
+	}
+	if bound["callback_id"] != "c1" || bound["request_type"] != "keygen" {
+		t.Errorf("bound %v", bound)
+	}
+	if len(unread) != 0 {
+		t.Errorf("handler read the request body %q", unread)
+	}
+
+	// the same document re-marshalled is not what was signed
+	remarshalled, _ := json.Marshal(bound)
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		code      string
+	}{
+		{"missing signature", body, "", ErrSignatureMissing.Code},
+		{"signature not hex", body, "zz" + signature, ErrSignatureBadHex.Code},
+		{"signature of another body", remarshalled, signature, ErrBadSignature.Code},
+	}
+	for _, tt := range tests {
+		w, bound, _ := serveVerified(t, s, tt.body, tt.signature)
+		if bound != nil {
+			t.Errorf("%s: handler ran", tt.name)
+		}
+		if code := s.errorCode(t, w); code != tt.code {
+			t.Errorf("%s: got error %s, want %s", tt.name, code, tt.code)
+		}
+	}
+
+	// with canonical JSON the signature covers the canonical form instead
+	s = newTestService(t, &CallbackServiceConfig{CanonicalJSON: true})
+	canonical, err := CanonicalJSON(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, _ = (&hexSigner{key: s.mpcNodeKey}).Sign(canonical)
+	if w, bound, _ = serveVerified(t, s, body, signature); w.Code != http.StatusOK || bound["callback_id"] != "c1" {
+		t.Errorf("canonical signature: got %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,394 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultRuleId is reported when no rule of a RulePolicy matched.
+	DefaultRuleId = "default"
+	// RandomRuleId is reported by the policy used when no policy file is
+	// configured.
+	RandomRuleId = "random"
+	// TxInfoRuleId is reported when the tx_info of a request cannot be
+	// parsed or its destination cannot be looked up.
+	TxInfoRuleId = "tx_info"
+
+	defaultWaitTime = "60"
+)
+
+// Reason codes of a Decision, they tell what kind of check decided.
+const (
+	ReasonRule          = "rule"
+	ReasonDefault       = "default_action"
+	ReasonRandom        = "random"
+	ReasonLimitExceeded = "limit_exceeded"
+	ReasonDenylisted    = "denylisted_address"
+	ReasonParseFailure  = "parse_failure"
+	ReasonLookupFailure = "lookup_failure"
+	ReasonKeygenPolicy  = "keygen_policy"
+	ReasonKeyPolicy     = "key_policy"
+)
+
+// Decision is the outcome of evaluating a callback request.
+type Decision struct {
+	Action   string `json:"action"`
+	WaitTime string `json:"wait_time,omitempty"`
+	RuleId   string `json:"rule_id"`
+	Code     string `json:"code,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Policy decides the action returned for a callback request received at
+// now.
+type Policy interface {
+	Evaluate(request *Check, now time.Time) (*Decision, error)
+}
+
+// randomPolicy approves everything unless reject is set, in which case
+// non-keygen requests are randomly rejected or put on hold.
+type randomPolicy struct {
+	reject bool
+}
+
+func (p *randomPolicy) Evaluate(request *Check, now time.Time) (*Decision, error) {
+	decision := &Decision{Action: Approve, RuleId: RandomRuleId, Code: ReasonRandom}
+	if !p.reject || request.RequestType == RequestTypeKeygen {
+		return decision, nil
+	}
+	r := rand.Float32()
+	if r < 0.80 {
+		decision.Action = Approve
+	} else if r < 0.90 {
+		decision.Action = Reject
+	} else {
+		decision.Action = Wait
+		decision.WaitTime = defaultWaitTime
+	}
+	return decision, nil
+}
+
+// PolicyConfig is the JSON policy file. Rules are evaluated in order and the
+// first matching rule decides, DefaultAction applies when none matches.
+// Requests approved that way are then checked against the Limits.
+type PolicyConfig struct {
+	DefaultAction   string   `json:"default_action"`
+	DefaultWaitTime string   `json:"default_wait_time,omitempty"`
+	Rules           []*Rule  `json:"rules"`
+	Limits          []*Limit `json:"limits,omitempty"`
+	// Calendars are named date lists, such as holidays, for the calendars
+	// of TimeMatch.
+	Calendars map[string][]string `json:"calendars,omitempty"`
+	// Keygen is checked before the rules, keygen requests that do not
+	// comply are rejected.
+	Keygen *KeygenPolicy `json:"keygen,omitempty"`
+	// Keys is checked before the rules, sign and rawdata requests that do
+	// not comply are rejected.
+	Keys *KeyPolicy `json:"keys,omitempty"`
+}
+
+type Rule struct {
+	Id       string    `json:"id"`
+	Action   string    `json:"action"`
+	WaitTime string    `json:"wait_time,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Match    RuleMatch `json:"match"`
+}
+
+// RuleMatch selects the requests a Rule applies to. Every non-empty field
+// must match, an empty RuleMatch matches every request.
+type RuleMatch struct {
+	RequestTypes []string `json:"request_types,omitempty"`
+	SignTypes    []string `json:"sign_types,omitempty"`
+	Cryptography []string `json:"cryptography,omitempty"`
+	SinoIds      []string `json:"sino_ids,omitempty"`
+	// Tokens matches the tx_info token.
+	Tokens []string `json:"tokens,omitempty"`
+	// DestinationLists matches the address book list (allow, deny or none)
+	// of the tx_info destination. Sign requests without destination are
+	// on the deny list, other requests without destination never match.
+	DestinationLists []string `json:"destination_lists,omitempty"`
+	// Time matches the time the request is evaluated at.
+	Time *TimeMatch `json:"time,omitempty"`
+}
+
+type RulePolicy struct {
+	cfg     *PolicyConfig
+	limiter *limiter
+	book    *AddressBook
+	keys    *KeyRegistry
+}
+
+// evaluation is a request being evaluated along with what the policy
+// derives from it on demand.
+type evaluation struct {
+	request *Check
+	now     time.Time
+	book    *AddressBook
+	tx      *TxInfo
+	txErr   error
+	parsed  bool
+	// invalid is why the tx_info cannot be evaluated, the request is
+	// rejected with invalidCode when it fails the policy.
+	invalid     error
+	invalidCode string
+}
+
+func (e *evaluation) txInfo() (*TxInfo, error) {
+	if !e.parsed {
+		e.tx, e.txErr = ParseTxInfo(e.request.TxInfo)
+		e.invalid, e.invalidCode = e.txErr, ReasonParseFailure
+		e.parsed = true
+	}
+	return e.tx, e.txErr
+}
+
+// destinationList returns the address book list of the destination. Sign
+// requests without destination are denylisted, other requests have none.
+func (e *evaluation) destinationList() (string, error) {
+	tx, err := e.txInfo()
+	if err != nil {
+		return "", err
+	}
+	if tx.To == "" {
+		if e.request.RequestType == RequestTypeSign {
+			return AddressListDeny, nil
+		}
+		return "", nil
+	}
+	if e.book == nil {
+		return AddressListNone, nil
+	}
+	list, err := e.book.Lookup(tx.Chain, tx.To)
+	if err != nil {
+		e.invalid = fmt.Errorf("look up destination failed, %v", err)
+		e.invalidCode = ReasonLookupFailure
+		return "", e.invalid
+	}
+	return list, nil
+}
+
+// LoadPolicy reads and validates a JSON policy file.
+func LoadPolicy(path string) (*RulePolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy file failed, %v", err)
+	}
+	cfg := &PolicyConfig{}
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse policy file %s failed, %v", path, err)
+	}
+	return NewRulePolicy(cfg)
+}
+
+func NewRulePolicy(cfg *PolicyConfig) (*RulePolicy, error) {
+	if cfg.DefaultAction == "" {
+		cfg.DefaultAction = Approve
+	}
+	if !validAction(cfg.DefaultAction) {
+		return nil, fmt.Errorf("invalid default action %q", cfg.DefaultAction)
+	}
+	if cfg.DefaultWaitTime == "" {
+		cfg.DefaultWaitTime = defaultWaitTime
+	}
+	ids := make(map[string]bool)
+	for i, rule := range cfg.Rules {
+		if rule.Id == "" {
+			return nil, fmt.Errorf("rule #%d has no id", i)
+		}
+		if rule.Id == DefaultRuleId || rule.Id == KeygenRuleId || rule.Id == KeyRuleId || rule.Id == TxInfoRuleId || ids[rule.Id] {
+			return nil, fmt.Errorf("duplicate rule id %q", rule.Id)
+		}
+		ids[rule.Id] = true
+		if !validAction(rule.Action) {
+			return nil, fmt.Errorf("rule %s: invalid action %q", rule.Id, rule.Action)
+		}
+		if err := rule.Match.compile(cfg.Calendars); err != nil {
+			return nil, fmt.Errorf("rule %s: %v", rule.Id, err)
+		}
+	}
+	if cfg.Keys != nil {
+		if err := cfg.Keys.compile(); err != nil {
+			return nil, fmt.Errorf("keys: %v", err)
+		}
+	}
+	policy := &RulePolicy{cfg: cfg}
+	limits := cfg.Limits
+	if cfg.Keygen != nil {
+		if limit := cfg.Keygen.limit(); limit != nil {
+			limits = append(append([]*Limit(nil), limits...), limit)
+		}
+	}
+	if len(limits) == 0 {
+		return policy, nil
+	}
+	for _, limit := range limits {
+		if err := limit.validate(); err != nil {
+			return nil, err
+		}
+		if err := limit.Match.compile(cfg.Calendars); err != nil {
+			return nil, fmt.Errorf("limit %s: %v", limit.Id, err)
+		}
+		if limit.Id == DefaultRuleId || ids[limit.Id] {
+			return nil, fmt.Errorf("duplicate rule id %q", limit.Id)
+		}
+		ids[limit.Id] = true
+	}
+	policy.limiter = newLimiter(limits)
+	return policy, nil
+}
+
+// UseAddressBook makes the destination_lists of rules and limits look up
+// destinations in book.
+func (p *RulePolicy) UseAddressBook(book *AddressBook) {
+	p.book = book
+}
+
+// UseKeyRegistry makes the keys policy look up root keys in registry.
+func (p *RulePolicy) UseKeyRegistry(registry *KeyRegistry) {
+	p.keys = registry
+}
+
+// RequiresKeyRegistry reports whether the policy rejects every sign
+// request without a key registry.
+func (p *RulePolicy) RequiresKeyRegistry() bool {
+	return p.cfg.Keys != nil && p.cfg.Keys.RequireKnownKey
+}
+
+// PersistLimits keeps the limit windows in store so they survive restarts.
+func (p *RulePolicy) PersistLimits(store *FileStore) error {
+	if p.limiter == nil {
+		return nil
+	}
+	return p.limiter.persist(store)
+}
+
+func (p *RulePolicy) Evaluate(request *Check, now time.Time) (*Decision, error) {
+	e := &evaluation{request: request, now: now, book: p.book}
+	decision, err := p.evaluate(e)
+	if err != nil && e.invalid != nil {
+		return p.decision(TxInfoRuleId, e.invalidCode, Reject, "", e.invalid.Error()), nil
+	}
+	return decision, err
+}
+
+func (p *RulePolicy) evaluate(e *evaluation) (*Decision, error) {
+	request := e.request
+	if request.RequestType == RequestTypeKeygen && p.cfg.Keygen != nil {
+		if reason := p.cfg.Keygen.check(request); reason != "" {
+			return p.decision(KeygenRuleId, ReasonKeygenPolicy, Reject, "", reason), nil
+		}
+	}
+	if p.cfg.Keys != nil && p.cfg.Keys.appliesTo(request) {
+		code, reason, err := p.cfg.Keys.check(e, p.keys)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			return p.decision(KeyRuleId, code, Reject, "", reason), nil
+		}
+	}
+	decision, err := p.evaluateRules(e)
+	if err != nil || decision.Action != Approve || p.limiter == nil {
+		return decision, err
+	}
+	limit, err := p.limiter.check(e, e.now)
+	if err != nil {
+		return nil, err
+	}
+	if limit != nil {
+		reason := limit.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("limit %s exceeded", limit.Id)
+		}
+		return p.decision(limit.Id, ReasonLimitExceeded, limit.Action, limit.WaitTime, reason), nil
+	}
+	return decision, nil
+}
+
+func (p *RulePolicy) evaluateRules(e *evaluation) (*Decision, error) {
+	for _, rule := range p.cfg.Rules {
+		ok, err := rule.Match.matches(e)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", rule.Id, err)
+		}
+		if !ok {
+			continue
+		}
+		code := ReasonRule
+		if len(rule.Match.DestinationLists) > 0 {
+			if list, _ := e.destinationList(); list == AddressListDeny {
+				code = ReasonDenylisted
+			}
+		}
+		return p.decision(rule.Id, code, rule.Action, rule.WaitTime, rule.Reason), nil
+	}
+	return p.decision(DefaultRuleId, ReasonDefault, p.cfg.DefaultAction, "", ""), nil
+}
+
+func (p *RulePolicy) decision(ruleId, code, action, waitTime, reason string) *Decision {
+	decision := &Decision{Action: action, RuleId: ruleId, Code: code, Reason: reason}
+	if action == Wait {
+		decision.WaitTime = waitTime
+		if decision.WaitTime == "" {
+			decision.WaitTime = p.cfg.DefaultWaitTime
+		}
+	}
+	return decision
+}
+
+func (m *RuleMatch) matches(e *evaluation) (bool, error) {
+	request := e.request
+	if !matchAny(m.RequestTypes, request.RequestType) ||
+		!matchAny(m.SignTypes, request.SignType) ||
+		!matchAny(m.Cryptography, request.Cryptography) ||
+		!matchAny(m.SinoIds, request.SinoId) {
+		return false, nil
+	}
+	if m.Time != nil && !m.Time.matches(e.now) {
+		return false, nil
+	}
+	if len(m.Tokens) > 0 {
+		tx, err := e.txInfo()
+		if err != nil || !matchAny(m.Tokens, tx.Token) {
+			return false, err
+		}
+	}
+	if len(m.DestinationLists) > 0 {
+		list, err := e.destinationList()
+		if err != nil || list == "" {
+			return false, err
+		}
+		return matchAny(m.DestinationLists, list), nil
+	}
+	return true, nil
+}
+
+func (m *RuleMatch) compile(calendars map[string][]string) error {
+	if m.Time == nil {
+		return nil
+	}
+	return m.Time.compile(calendars)
+}
+
+// matchAny reports whether value is one of values, an empty list matches
+// everything.
+func matchAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func validAction(action string) bool {
+	return action == Approve || action == Reject || action == Wait
+}
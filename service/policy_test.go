@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testPolicy(t *testing.T) *RulePolicy {
+	policy, err := NewRulePolicy(&PolicyConfig{
+		DefaultAction: Approve,
+		Rules: []*Rule{
+			{Id: "hold-ed25519", Action: Wait, Match: RuleMatch{
+				RequestTypes: []string{"sign"},
+				Cryptography: []string{"ed25519"},
+			}},
+			{Id: "block-sino", Action: Reject, Reason: "blocked", Match: RuleMatch{
+				SinoIds: []string{"bad"},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestRulePolicyEvaluate(t *testing.T) {
+	policy := testPolicy(t)
+	tests := []struct {
+		request *Check
+		action  string
+		ruleId  string
+	}{
+		{&Check{RequestType: "keygen"}, Approve, DefaultRuleId},
+		{&Check{RequestType: "sign", RequestDetail: RequestDetail{Cryptography: "ed25519"}}, Wait, "hold-ed25519"},
+		{&Check{RequestType: "sign", RequestDetail: RequestDetail{Cryptography: "ecdsa"}}, Approve, DefaultRuleId},
+		{&Check{RequestType: "sign", ExtraInfo: ExtraInfo{SinoId: "bad"}}, Reject, "block-sino"},
+		// the first matching rule wins
+		{&Check{RequestType: "sign", RequestDetail: RequestDetail{Cryptography: "ed25519"}, ExtraInfo: ExtraInfo{SinoId: "bad"}}, Wait, "hold-ed25519"},
+	}
+	for i, tt := range tests {
+		decision, err := policy.Evaluate(tt.request, time.Now())
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if decision.Action != tt.action || decision.RuleId != tt.ruleId {
+			t.Errorf("#%d: got %s (%s), want %s (%s)", i, decision.Action, decision.RuleId, tt.action, tt.ruleId)
+		}
+		if decision.Action == Wait && decision.WaitTime != defaultWaitTime {
+			t.Errorf("#%d: wait time %q, want %q", i, decision.WaitTime, defaultWaitTime)
+		}
+	}
+}
+
+func TestNewRulePolicyInvalid(t *testing.T) {
+	configs := []*PolicyConfig{
+		{DefaultAction: "MAYBE"},
+		{Rules: []*Rule{{Action: Approve}}},
+		{Rules: []*Rule{{Id: "a", Action: "MAYBE"}}},
+		{Rules: []*Rule{{Id: "a", Action: Approve}, {Id: "a", Action: Reject}}},
+		{Rules: []*Rule{{Id: DefaultRuleId, Action: Approve}}},
+	}
+	for i, cfg := range configs {
+		if _, err := NewRulePolicy(cfg); err == nil {
+			t.Errorf("#%d: invalid policy accepted", i)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	entry := func(request *Check, action string) *AuditEntry {
+		body, _ := json.Marshal(request)
+		e := &AuditEntry{Time: time.Unix(1700000000, 0).UTC(), Path: "/check", Request: body, RuleId: RandomRuleId}
+		if action != "" {
+			e.Response = &ResponseData{CallbackId: request.CallbackId, Action: action}
+		} else {
+			e.Error = ErrDecryptFailed.Code
+		}
+		return e
+	}
+	var log bytes.Buffer
+	for _, e := range []*AuditEntry{
+		entry(&Check{CallbackId: "1", RequestType: "keygen"}, Approve),
+		entry(&Check{CallbackId: "2", RequestType: "sign", RequestDetail: RequestDetail{Cryptography: "ed25519"}}, Approve),
+		entry(&Check{CallbackId: "3", RequestType: "sign", ExtraInfo: ExtraInfo{SinoId: "bad", RequestId: "r3"}}, Approve),
+		entry(&Check{CallbackId: "4", RequestType: "sign", ExtraInfo: ExtraInfo{SinoId: "bad"}}, Reject),
+		entry(&Check{CallbackId: "5", RequestType: "rawdata_signature"}, ""),
+	} {
+		line, _ := json.Marshal(e)
+		log.Write(append(line, '\n'))
+	}
+
+	report, err := Replay(&log, testPolicy(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Replayed != 4 || report.Skipped != 1 || report.Changed != 2 {
+		t.Fatalf("replayed %d, skipped %d, changed %d", report.Replayed, report.Skipped, report.Changed)
+	}
+	if report.Transitions[Approve+"->"+Wait] != 1 || report.Transitions[Approve+"->"+Reject] != 1 {
+		t.Errorf("unexpected transitions %v", report.Transitions)
+	}
+	if len(report.Rules) != 3 || report.Rules[0].RuleId != "block-sino" || report.Rules[0].Matched != 2 || report.Rules[0].Changed != 1 {
+		t.Errorf("unexpected rule stats %+v", report.Rules[0])
+	}
+	change := report.Changes[1]
+	if change.CallbackId != "3" || change.RequestId != "r3" || change.OldRuleId != RandomRuleId || change.NewRuleId != "block-sino" {
+		t.Errorf("unexpected change %+v", change)
+	}
+}
+
+func TestEvaluateShadow(t *testing.T) {
+	c := &CallbackService{shadow: testPolicy(t), metrics: NewMetrics()}
+	active := &Decision{Action: Approve, RuleId: RandomRuleId}
+
+	if shadow := c.evaluateShadow(&Check{RequestType: "keygen"}, time.Now(), active); shadow.Action != Approve {
+		t.Errorf("got shadow action %s", shadow.Action)
+	}
+	if shadow := c.evaluateShadow(&Check{RequestType: "sign", ExtraInfo: ExtraInfo{SinoId: "bad"}}, time.Now(), active); shadow.RuleId != "block-sino" {
+		t.Errorf("got shadow rule %s", shadow.RuleId)
+	}
+	if n := c.metrics.ShadowDisagreements.Get(Approve, Reject, "block-sino"); n != 1 {
+		t.Errorf("got %d disagreements", n)
+	}
+	if n := c.metrics.ShadowEvaluations.Get(Approve, DefaultRuleId); n != 1 {
+		t.Errorf("got %d default evaluations", n)
+	}
+
+	var out bytes.Buffer
+	c.metrics.Write(&out)
+	want := `callback_shadow_disagreements_total{active_action="APPROVE",shadow_action="REJECT",shadow_rule_id="block-sino"} 1`
+	if !bytes.Contains(out.Bytes(), []byte(want)) {
+		t.Errorf("metrics output is missing %s:\n%s", want, out.String())
+	}
+}
+
+func TestShadowPolicyRequiresKeyRegistry(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	shadowPath := filepath.Join(dir, "shadow.json")
+	if err := ioutil.WriteFile(shadowPath, []byte(`{"keys":{"require_known_key":true}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &CallbackServiceConfig{
+		PrivateKeyPath:       writeTestKey(t, dir, "callback.pem", key),
+		MPCNodePublicKeyPath: writeTestKey(t, dir, "mpc_node_public.pem", key.Public()),
+		ShadowPolicyPath:     shadowPath,
+	}
+	if _, err := NewCallBackService(cfg); err == nil {
+		t.Error("shadow policy requiring known keys loaded without a key registry")
+	}
+	cfg.KeyRegistryPath = filepath.Join(dir, "keys.json")
+	if _, err := NewCallBackService(cfg); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"time"
+)
+
+// ReplayChange is a recorded request whose action differs under the
+// candidate policy.
+type ReplayChange struct {
+	Time        time.Time `json:"time"`
+	CallbackId  string    `json:"callback_id"`
+	RequestType string    `json:"request_type"`
+	SinoId      string    `json:"sino_id"`
+	RequestId   string    `json:"request_id"`
+	OldAction   string    `json:"old_action"`
+	OldRuleId   string    `json:"old_rule_id,omitempty"`
+	NewAction   string    `json:"new_action"`
+	NewRuleId   string    `json:"new_rule_id"`
+}
+
+// RuleStats counts how a candidate rule decided the replayed requests.
+type RuleStats struct {
+	RuleId  string         `json:"rule_id"`
+	Matched int            `json:"matched"`
+	Changed int            `json:"changed"`
+	Actions map[string]int `json:"actions"`
+}
+
+type ReplayReport struct {
+	Replayed    int             `json:"replayed"`
+	Skipped     int             `json:"skipped"`
+	Changed     int             `json:"changed"`
+	Transitions map[string]int  `json:"transitions"`
+	Rules       []*RuleStats    `json:"rules"`
+	Changes     []*ReplayChange `json:"changes"`
+	// TruncatedStreams counts the streams of an encrypted audit log that
+	// were not closed, their tail may be missing.
+	TruncatedStreams int `json:"truncated_streams,omitempty"`
+}
+
+// Replay evaluates every request recorded in an audit log with policy, at
+// the time it was recorded, and reports the requests whose action would
+// change. Entries without a recorded response (rejected before a decision
+// was made) are skipped. Destinations are looked up in the current address
+// book of policy, not the one in use when the request was recorded. When r
+// reports a *TruncatedStreamsError the report is still returned, along with
+// the error.
+func Replay(r io.Reader, policy Policy) (*ReplayReport, error) {
+	report := &ReplayReport{Transitions: make(map[string]int)}
+	rules := make(map[string]*RuleStats)
+	err := ReadAuditLog(r, func(entry *AuditEntry) error {
+		if entry.Response == nil || entry.Response.Action == "" {
+			report.Skipped++
+			return nil
+		}
+		request := &Check{}
+		if err := json.Unmarshal(entry.Request, request); err != nil {
+			report.Skipped++
+			return nil
+		}
+		decision, err := policy.Evaluate(request, entry.Time)
+		if err != nil {
+			return err
+		}
+		report.Replayed++
+
+		stats, ok := rules[decision.RuleId]
+		if !ok {
+			stats = &RuleStats{RuleId: decision.RuleId, Actions: make(map[string]int)}
+			rules[decision.RuleId] = stats
+		}
+		stats.Matched++
+		stats.Actions[decision.Action]++
+
+		if decision.Action == entry.Response.Action {
+			return nil
+		}
+		stats.Changed++
+		report.Changed++
+		report.Transitions[entry.Response.Action+"->"+decision.Action]++
+		report.Changes = append(report.Changes, &ReplayChange{
+			Time:        entry.Time,
+			CallbackId:  request.CallbackId,
+			RequestType: request.RequestType,
+			SinoId:      request.SinoId,
+			RequestId:   request.ExtraInfo.RequestId,
+			OldAction:   entry.Response.Action,
+			OldRuleId:   entry.RuleId,
+			NewAction:   decision.Action,
+			NewRuleId:   decision.RuleId,
+		})
+		return nil
+	})
+	var truncated *TruncatedStreamsError
+	if errors.As(err, &truncated) {
+		report.TruncatedStreams = truncated.Truncated
+	} else if err != nil {
+		return nil, err
+	}
+	for _, stats := range rules {
+		report.Rules = append(report.Rules, stats)
+	}
+	sort.Slice(report.Rules, func(i, j int) bool {
+		return report.Rules[i].RuleId < report.Rules[j].RuleId
+	})
+	return report, err
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sinohope/mpc-node-callback-demo/service/ecies"
+)
+
+// ResponseEncryptionData encrypts the whole ResponseData into
+// Response.EncryptedData, other ResponseEncryption values list the
+// ResponseData fields encrypted into ResponseData.EncryptedFields.
+const ResponseEncryptionData = "data"
+
+// EncryptedData is the signed payload of a Response whose data is
+// encrypted.
+type EncryptedData struct {
+	EncryptedData string `json:"encrypted_data"`
+}
+
+// responseEncryption ECIES encrypts responses to the mpc-node public key.
+type responseEncryption struct {
+	key    *ecdsa.PublicKey
+	params *ecies.ECIESParams
+	// fields are the encrypted ResponseData fields, nil for the whole data
+	fields []string
+}
+
+// newResponseEncryption parses a ResponseEncryption setting, it returns nil
+// when encryption is disabled.
+func newResponseEncryption(mode, scheme string, mpcNodeKey crypto.PublicKey) (*responseEncryption, error) {
+	if mode == "" {
+		return nil, nil
+	}
+	key, ok := mpcNodeKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("response encryption requires an ECDSA mpc-node public key, got %T", mpcNodeKey)
+	}
+	params, err := ecies.ParamsFromName(scheme)
+	if err != nil {
+		return nil, err
+	}
+	e := &responseEncryption{key: key, params: params}
+	if mode == ResponseEncryptionData {
+		return e, nil
+	}
+	names := responseDataFields()
+	for _, field := range strings.Split(mode, ",") {
+		if !names[field] {
+			return nil, fmt.Errorf("unknown response data field %q", field)
+		}
+		e.fields = append(e.fields, field)
+	}
+	return e, nil
+}
+
+// responseDataFields returns the JSON names of the ResponseData fields that
+// can be encrypted.
+func responseDataFields() map[string]bool {
+	names := make(map[string]bool)
+	t := reflect.TypeOf(ResponseData{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" && name != "encrypted_fields" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+func (e *responseEncryption) encrypt(plain []byte) (string, error) {
+	ct, err := EncryptSignature(e.key, e.params, false, plain)
+	if err != nil {
+		return "", fmt.Errorf("encrypt response failed, %v", err)
+	}
+	return hex.EncodeToString(ct), nil
+}
+
+// Encrypt replaces the data of response with its encryption.
+func (e *responseEncryption) Encrypt(response *Response) error {
+	if response.Data == nil {
+		return nil
+	}
+	plain, err := json.Marshal(response.Data)
+	if err != nil {
+		return err
+	}
+	if e.fields == nil {
+		if response.EncryptedData, err = e.encrypt(plain); err != nil {
+			return err
+		}
+		response.Data = nil
+		return nil
+	}
+	data := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(plain, &data); err != nil {
+		return err
+	}
+	selected := make(map[string]json.RawMessage)
+	for _, field := range e.fields {
+		if value, ok := data[field]; ok {
+			selected[field] = value
+			delete(data, field)
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+	if plain, err = json.Marshal(selected); err != nil {
+		return err
+	}
+	visible := &ResponseData{}
+	remaining, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(remaining, visible); err != nil {
+		return err
+	}
+	if visible.EncryptedFields, err = e.encrypt(plain); err != nil {
+		return err
+	}
+	response.Data = visible
+	return nil
+}
+
+// DecryptResponse decrypts the data or the data fields of a response
+// encrypted to the mpc-node key. Verify Response.Signature first, it covers
+// the encrypted form.
+func DecryptResponse(response *Response, key crypto.PrivateKey) error {
+	decrypt := func(cipherText string) ([]byte, error) {
+		plain, err := DecryptSignature(key, cipherText)
+		if err != nil {
+			return nil, err
+		}
+		return hex.DecodeString(plain)
+	}
+	if response.EncryptedData != "" {
+		plain, err := decrypt(response.EncryptedData)
+		if err != nil {
+			return fmt.Errorf("decrypt response data failed, %v", err)
+		}
+		data := &ResponseData{}
+		if err = json.Unmarshal(plain, data); err != nil {
+			return fmt.Errorf("parse response data failed, %v", err)
+		}
+		response.Data = data
+		response.EncryptedData = ""
+	}
+	if response.Data != nil && response.Data.EncryptedFields != "" {
+		plain, err := decrypt(response.Data.EncryptedFields)
+		if err != nil {
+			return fmt.Errorf("decrypt response fields failed, %v", err)
+		}
+		data := *response.Data
+		data.EncryptedFields = ""
+		if err = json.Unmarshal(plain, &data); err != nil {
+			return fmt.Errorf("parse response fields failed, %v", err)
+		}
+		response.Data = &data
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package service
+
+// Shamir secret sharing over GF(2^8) with the AES polynomial, one
+// polynomial per secret byte. A share is its x coordinate followed by the
+// y coordinate of every byte. Field operations are constant time.
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+const maxShares = 255
+
+// gfMul multiplies in GF(2^8).
+func gfMul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		a = a<<1 ^ (-(a >> 7) & 0x1b)
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv returns the multiplicative inverse of a, a^254, and 0 for 0.
+func gfInv(a byte) byte {
+	r := a
+	for i := 0; i < 6; i++ {
+		r = gfMul(gfMul(r, r), a)
+	}
+	return gfMul(r, r)
+}
+
+// SplitSecret splits secret into n shares, any threshold of which recover
+// it with CombineShares.
+func SplitSecret(secret []byte, threshold, n int) ([][]byte, error) {
+	if threshold < 2 || threshold > n || n > maxShares {
+		return nil, fmt.Errorf("invalid %d of %d shares, need 2 <= threshold <= shares <= %d", threshold, n, maxShares)
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("empty secret")
+	}
+	// coefficients[i] are the coefficients of degree 1 and up of byte i
+	coefficients := make([]byte, len(secret)*(threshold-1))
+	if _, err := rand.Read(coefficients); err != nil {
+		return nil, err
+	}
+	shares := make([][]byte, n)
+	for s := range shares {
+		x := byte(s + 1)
+		share := make([]byte, 1+len(secret))
+		share[0] = x
+		for i, b := range secret {
+			// Horner's rule from the highest degree coefficient
+			c := coefficients[i*(threshold-1) : (i+1)*(threshold-1)]
+			var y byte
+			for d := len(c) - 1; d >= 0; d-- {
+				y = gfMul(y, x) ^ c[d]
+			}
+			share[1+i] = gfMul(y, x) ^ b
+		}
+		shares[s] = share
+	}
+	return shares, nil
+}
+
+// CombineShares interpolates the secret of shares. Shares of different
+// polynomials, or fewer than the threshold, give a wrong secret rather than
+// an error.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("at least 2 shares are required")
+	}
+	size := len(shares[0])
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if len(share) != size || size < 2 {
+			return nil, fmt.Errorf("shares have different lengths")
+		}
+		if share[0] == 0 || seen[share[0]] {
+			return nil, fmt.Errorf("invalid or duplicated share index %d", share[0])
+		}
+		seen[share[0]] = true
+	}
+	secret := make([]byte, size-1)
+	for i, share := range shares {
+		// Lagrange basis polynomial of share i at 0
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = gfMul(basis, gfMul(other[0], gfInv(other[0]^share[0])))
+			}
+		}
+		for k, y := range share[1:] {
+			secret[k] ^= gfMul(y, basis)
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+)
+
+// Signature formats, selected with CallbackServiceConfig.SignatureFormat.
+const (
+	// SignatureFormatHex is the hex encoded ASN.1 ECDSA signature over
+	// sha256 of the payload, as produced by Sign.
+	SignatureFormatHex = "hex"
+	// SignatureFormatJWS is a JWS compact serialization embedding the payload.
+	SignatureFormatJWS = "jws"
+	// SignatureFormatJWSDetached is a JWS compact serialization with the
+	// payload part left empty.
+	SignatureFormatJWSDetached = "jws-detached"
+)
+
+// SignPayload signs payload with key in the given signature format.
+func SignPayload(format, kid string, key crypto.Signer, payload []byte) (string, error) {
+	signer, err := newResponseSigner(format, kid, key)
+	if err != nil {
+		return "", err
+	}
+	return signer.Sign(payload)
+}
+
+// VerifyPayload verifies a signature over payload in the given signature
+// format. kid is only checked for JWS and only when not empty.
+func VerifyPayload(format, kid string, key crypto.PublicKey, payload []byte, signature string) error {
+	verifier, err := newRequestVerifier(format, kid, key)
+	if err != nil {
+		return err
+	}
+	if apiErr := verifier.Verify(payload, signature); apiErr != nil {
+		return apiErr
+	}
+	return nil
+}
+
+// responseSigner produces Response.Signature over the signed payload.
+type responseSigner interface {
+	Sign(payload []byte) (string, error)
+}
+
+// requestVerifier checks the Signature header of a request against its
+// signed payload.
+type requestVerifier interface {
+	Verify(payload []byte, signature string) *APIError
+}
+
+func newResponseSigner(format, kid string, key crypto.Signer) (responseSigner, error) {
+	switch format {
+	case "", SignatureFormatHex:
+		private, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("signature format %s requires an ECDSA key, got %T", SignatureFormatHex, key)
+		}
+		return &hexSigner{key: private}, nil
+	case SignatureFormatJWS, SignatureFormatJWSDetached:
+		if _, err := JWSAlgorithm(key.Public()); err != nil {
+			return nil, err
+		}
+		return &jwsSigner{key: key, kid: kid, detached: format == SignatureFormatJWSDetached}, nil
+	}
+	return nil, fmt.Errorf("unknown signature format %q", format)
+}
+
+func newRequestVerifier(format, kid string, key crypto.PublicKey) (requestVerifier, error) {
+	switch format {
+	case "", SignatureFormatHex:
+		public, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("signature format %s requires an ECDSA key, got %T", SignatureFormatHex, key)
+		}
+		return &hexVerifier{key: public}, nil
+	case SignatureFormatJWS, SignatureFormatJWSDetached:
+		if _, err := JWSAlgorithm(key); err != nil {
+			return nil, err
+		}
+		return &jwsVerifier{key: key, kid: kid}, nil
+	}
+	return nil, fmt.Errorf("unknown signature format %q", format)
+}
+
+type hexSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *hexSigner) Sign(payload []byte) (string, error) {
+	return Sign(s.key, hex.EncodeToString(payload))
+}
+
+type hexVerifier struct {
+	key *ecdsa.PublicKey
+}
+
+func (v *hexVerifier) Verify(payload []byte, signature string) *APIError {
+	return VerifyBody(v.key, payload, signature)
+}
+
+type jwsSigner struct {
+	key      crypto.Signer
+	kid      string
+	detached bool
+}
+
+func (s *jwsSigner) Sign(payload []byte) (string, error) {
+	return SignJWS(s.key, s.kid, payload, s.detached)
+}
+
+// jwsVerifier accepts both compact and detached JWS.
+type jwsVerifier struct {
+	key crypto.PublicKey
+	kid string
+}
+
+func (v *jwsVerifier) Verify(payload []byte, signature string) *APIError {
+	if err := VerifyJWS(v.key, v.kid, payload, signature); err != nil {
+		return ErrBadSignature
+	}
+	return nil
+}
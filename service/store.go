@@ -0,0 +1,106 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore persists a JSON document in a single file. Save replaces the
+// file atomically so a crash never leaves a partially written state.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Path() string {
+	return s.path
+}
+
+// Load decodes the stored document into v, v is left untouched when
+// nothing was saved yet.
+func (s *FileStore) Load(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read store %s failed, %v", s.path, err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse store %s failed, %v", s.path, err)
+	}
+	return nil
+}
+
+func (s *FileStore) Save(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("save store %s failed, %v", s.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("save store %s failed, %v", s.path, err)
+	}
+	return nil
+}
+
+// Check reports whether the directory of the store is writable and the
+// stored document, if any, is readable JSON.
+func (s *FileStore) Check() error {
+	dir := filepath.Dir(s.path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("store directory %s: %v", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("store directory %s is not a directory", dir)
+	}
+	probe, err := ioutil.TempFile(dir, filepath.Base(s.path)+".probe*")
+	if err != nil {
+		return fmt.Errorf("store directory %s is not writable, %v", dir, err)
+	}
+	probe.Close()
+	if err = os.Remove(probe.Name()); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read store %s failed, %v", s.path, err)
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("store %s is not valid JSON", s.path)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	// time zones must resolve on hosts without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// Clock tells the time requests are evaluated at.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
+
+// ClockFunc adapts a function to a Clock.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+const dateLayout = "2006-01-02"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// TimeMatch matches the evaluation time, taken in Timezone (UTC when
+// empty). Weekdays are "mon" to "sun". From and To are "15:04" times of
+// day, To is exclusive and a window with To before From spans midnight.
+// Dates are "2006-01-02" days or "2006-01-02..2006-01-05" inclusive ranges,
+// Calendars name date lists of the PolicyConfig. Every non-empty field
+// must match.
+type TimeMatch struct {
+	Timezone  string   `json:"timezone,omitempty"`
+	Weekdays  []string `json:"weekdays,omitempty"`
+	From      string   `json:"from,omitempty"`
+	To        string   `json:"to,omitempty"`
+	Dates     []string `json:"dates,omitempty"`
+	Calendars []string `json:"calendars,omitempty"`
+
+	location *time.Location
+	weekdays map[time.Weekday]bool
+	from, to int
+	dates    []dateRange
+}
+
+type dateRange struct {
+	first, last string
+}
+
+func (t *TimeMatch) compile(calendars map[string][]string) error {
+	location, err := time.LoadLocation(t.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q", t.Timezone)
+	}
+	t.location = location
+
+	if len(t.Weekdays) > 0 {
+		t.weekdays = make(map[time.Weekday]bool)
+		for _, day := range t.Weekdays {
+			key := strings.ToLower(day)
+			if len(key) > 3 {
+				key = key[:3]
+			}
+			weekday, ok := weekdays[key]
+			if !ok {
+				return fmt.Errorf("invalid weekday %q", day)
+			}
+			t.weekdays[weekday] = true
+		}
+	}
+
+	if (t.From == "") != (t.To == "") {
+		return fmt.Errorf("from and to must be set together")
+	}
+	if t.From != "" {
+		if t.from, err = parseTimeOfDay(t.From); err != nil {
+			return err
+		}
+		if t.to, err = parseTimeOfDay(t.To); err != nil {
+			return err
+		}
+		if t.from == t.to {
+			return fmt.Errorf("empty time window %s-%s", t.From, t.To)
+		}
+	}
+
+	dates := append([]string(nil), t.Dates...)
+	for _, name := range t.Calendars {
+		calendar, ok := calendars[name]
+		if !ok {
+			return fmt.Errorf("unknown calendar %q", name)
+		}
+		dates = append(dates, calendar...)
+	}
+	t.dates = nil
+	for _, date := range dates {
+		r, err := parseDateRange(date)
+		if err != nil {
+			return err
+		}
+		t.dates = append(t.dates, r)
+	}
+	return nil
+}
+
+// parseTimeOfDay parses "15:04" (or "24:00") into minutes since midnight.
+func parseTimeOfDay(s string) (int, error) {
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parseDateRange(s string) (dateRange, error) {
+	first, last := s, s
+	if i := strings.Index(s, ".."); i >= 0 {
+		first, last = s[:i], s[i+2:]
+	}
+	for _, date := range []string{first, last} {
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return dateRange{}, fmt.Errorf("invalid date %q", s)
+		}
+	}
+	if first > last {
+		return dateRange{}, fmt.Errorf("invalid date range %q", s)
+	}
+	return dateRange{first, last}, nil
+}
+
+func (t *TimeMatch) matches(now time.Time) bool {
+	local := now.In(t.location)
+	if t.weekdays != nil && !t.weekdays[local.Weekday()] {
+		return false
+	}
+	if t.From != "" {
+		minute := local.Hour()*60 + local.Minute()
+		if t.from < t.to {
+			if minute < t.from || minute >= t.to {
+				return false
+			}
+		} else if minute < t.from && minute >= t.to {
+			return false
+		}
+	}
+	if len(t.dates) > 0 {
+		date := local.Format(dateLayout)
+		for _, r := range t.dates {
+			if date >= r.first && date <= r.last {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimeMatch(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, shanghai)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		match TimeMatch
+		now   time.Time
+		want  bool
+	}{
+		// 2024-01-05 is a friday
+		{TimeMatch{Timezone: "Asia/Shanghai", Weekdays: []string{"mon", "Tuesday", "wed", "thu", "fri"}, From: "09:00", To: "18:00"}, at("2024-01-05 09:00"), true},
+		{TimeMatch{Timezone: "Asia/Shanghai", Weekdays: []string{"mon", "Tuesday", "wed", "thu", "fri"}, From: "09:00", To: "18:00"}, at("2024-01-05 18:00"), false},
+		{TimeMatch{Timezone: "Asia/Shanghai", Weekdays: []string{"mon", "Tuesday", "wed", "thu", "fri"}, From: "09:00", To: "18:00"}, at("2024-01-06 10:00"), false},
+		// 01:30 UTC is 09:30 in Shanghai
+		{TimeMatch{Timezone: "Asia/Shanghai", From: "09:00", To: "18:00"}, time.Date(2024, 1, 5, 1, 30, 0, 0, time.UTC), true},
+		{TimeMatch{From: "09:00", To: "18:00"}, time.Date(2024, 1, 5, 1, 30, 0, 0, time.UTC), false},
+		// windows spanning midnight
+		{TimeMatch{From: "22:00", To: "06:00"}, time.Date(2024, 1, 5, 23, 0, 0, 0, time.UTC), true},
+		{TimeMatch{From: "22:00", To: "06:00"}, time.Date(2024, 1, 5, 5, 59, 0, 0, time.UTC), true},
+		{TimeMatch{From: "22:00", To: "06:00"}, time.Date(2024, 1, 5, 6, 0, 0, 0, time.UTC), false},
+		{TimeMatch{From: "18:00", To: "24:00"}, time.Date(2024, 1, 5, 23, 59, 0, 0, time.UTC), true},
+		{TimeMatch{Timezone: "Asia/Shanghai", Dates: []string{"2024-12-31..2025-01-01"}}, at("2025-01-01 23:59"), true},
+		{TimeMatch{Timezone: "Asia/Shanghai", Dates: []string{"2024-12-31..2025-01-01"}}, at("2025-01-02 00:00"), false},
+		{TimeMatch{Timezone: "Asia/Shanghai", Calendars: []string{"holidays"}}, at("2024-10-01 12:00"), true},
+	}
+	calendars := map[string][]string{"holidays": {"2024-10-01..2024-10-07"}}
+	for i, tt := range tests {
+		if err := tt.match.compile(calendars); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got := tt.match.matches(tt.now); got != tt.want {
+			t.Errorf("#%d: got %v at %s", i, got, tt.now)
+		}
+	}
+
+	invalid := []TimeMatch{
+		{Timezone: "Mars/Olympus"},
+		{Weekdays: []string{"someday"}},
+		{From: "09:00"},
+		{From: "9am", To: "18:00"},
+		{From: "09:00", To: "09:00"},
+		{Dates: []string{"2024-02-30"}},
+		{Dates: []string{"2024-02-03..2024-02-01"}},
+		{Calendars: []string{"missing"}},
+	}
+	for i, match := range invalid {
+		if err := match.compile(calendars); err == nil {
+			t.Errorf("#%d: invalid time match accepted", i)
+		}
+	}
+}
+
+func businessHoursPolicy(t *testing.T) *RulePolicy {
+	policy, err := NewRulePolicy(&PolicyConfig{
+		DefaultAction: Approve,
+		Calendars:     map[string][]string{"holidays": {"2024-12-25"}},
+		Rules: []*Rule{
+			{Id: "holiday-freeze", Action: Reject, Match: RuleMatch{
+				RequestTypes: []string{"sign"},
+				Time:         &TimeMatch{Timezone: "America/New_York", Calendars: []string{"holidays"}},
+			}},
+			{Id: "business-hours", Action: Approve, Match: RuleMatch{
+				RequestTypes: []string{"sign"},
+				Time:         &TimeMatch{Timezone: "America/New_York", Weekdays: []string{"mon", "tue", "wed", "thu", "fri"}, From: "09:00", To: "17:00"},
+			}},
+			{Id: "after-hours", Action: Wait, Match: RuleMatch{RequestTypes: []string{"sign"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestRulePolicyTime(t *testing.T) {
+	policy := businessHoursPolicy(t)
+	tests := []struct {
+		now    time.Time
+		ruleId string
+	}{
+		// 15:00 UTC is 10:00 in New York in winter
+		{time.Date(2024, 12, 24, 15, 0, 0, 0, time.UTC), "business-hours"},
+		{time.Date(2024, 12, 24, 23, 0, 0, 0, time.UTC), "after-hours"},
+		{time.Date(2024, 12, 25, 15, 0, 0, 0, time.UTC), "holiday-freeze"},
+		// still the 24th in New York
+		{time.Date(2024, 12, 25, 4, 0, 0, 0, time.UTC), "after-hours"},
+		{time.Date(2024, 12, 28, 15, 0, 0, 0, time.UTC), "after-hours"},
+	}
+	for _, tt := range tests {
+		decision, err := policy.Evaluate(&Check{RequestType: "sign"}, tt.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decision.RuleId != tt.ruleId {
+			t.Errorf("%s: got rule %s, want %s", tt.now, decision.RuleId, tt.ruleId)
+		}
+	}
+}
+
+func TestReplayUsesEntryTime(t *testing.T) {
+	var log bytes.Buffer
+	for _, tm := range []time.Time{
+		time.Date(2024, 12, 24, 15, 0, 0, 0, time.UTC),
+		time.Date(2024, 12, 25, 15, 0, 0, 0, time.UTC),
+	} {
+		body, _ := json.Marshal(&Check{RequestType: "sign"})
+		line, _ := json.Marshal(&AuditEntry{Time: tm, Request: body, Response: &ResponseData{Action: Approve}})
+		log.Write(append(line, '\n'))
+	}
+	report, err := Replay(&log, businessHoursPolicy(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Changed != 1 || report.Changes[0].NewRuleId != "holiday-freeze" {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// TxInfo is the part of RequestDetail.TxInfo the policy understands. The
+// mpc-node forwards tx_info as it got it, unknown fields are ignored.
+type TxInfo struct {
+	Chain  string
+	From   string
+	To     string
+	Token  string
+	Amount *big.Rat
+}
+
+type txInfoJSON struct {
+	Chain  string      `json:"chain"`
+	From   string      `json:"from"`
+	To     string      `json:"to"`
+	Token  string      `json:"token"`
+	Amount json.Number `json:"amount"`
+}
+
+// ParseTxInfo parses the tx_info of a sign request. Amount is a decimal
+// string or number and is nil when absent. An empty tx_info yields an
+// empty TxInfo.
+func ParseTxInfo(raw json.RawMessage) (*TxInfo, error) {
+	tx := &TxInfo{}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return tx, nil
+	}
+	// tx_info is sometimes sent as a JSON encoded string
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("parse tx_info failed, %v", err)
+		}
+		raw = []byte(s)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var v txInfoJSON
+	if err := decoder.Decode(&v); err != nil {
+		return nil, fmt.Errorf("parse tx_info failed, %v", err)
+	}
+	tx.Chain = NormalizeChain(v.Chain)
+	tx.From = v.From
+	tx.To = normalizeDestination(v.To)
+	tx.Token = v.Token
+	if v.Amount != "" {
+		amount, ok := new(big.Rat).SetString(v.Amount.String())
+		if !ok || amount.Sign() < 0 {
+			return nil, fmt.Errorf("parse tx_info failed, invalid amount %q", v.Amount)
+		}
+		tx.Amount = amount
+	}
+	return tx, nil
+}
+
+// normalizeDestination lower cases the case insensitive destinations: hex
+// addresses, whose EIP-55 checksums only change case, and bitcoin segwit
+// addresses. Base58 addresses are case sensitive and kept as they are.
+func normalizeDestination(to string) string {
+	lower := strings.ToLower(to)
+	for _, prefix := range []string{"0x", "bc1", "tb1", "bcrt1"} {
+		if strings.HasPrefix(lower, prefix) {
+			return lower
+		}
+	}
+	return to
+}
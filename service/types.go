@@ -2,6 +2,13 @@ package service
 
 import "encoding/json"
 
+// Check.RequestType values sent by the mpc-node.
+const (
+	RequestTypeKeygen  = "keygen"
+	RequestTypeSign    = "sign"
+	RequestTypeRawData = "rawdata"
+)
+
 type Check struct {
 	CallbackId    string `json:"callback_id,omitempty"` // 由mpc-node生成，每次请求callback server时生成一个新的
 	RequestType   string `json:"request_type,omitempty"`
@@ -29,10 +36,13 @@ type ExtraInfo struct {
 }
 
 type Response struct {
-	Status    string        `json:"status,omitempty"`
-	Error     string        `json:"error,omitempty"`
-	Data      *ResponseData `json:"data,omitempty"`
-	Signature string        `json:"signature,omitempty"`
+	Status string        `json:"status,omitempty"`
+	Error  string        `json:"error,omitempty"`
+	Data   *ResponseData `json:"data,omitempty"`
+	// EncryptedData replaces Data when responses are encrypted, see
+	// CallbackServiceConfig.ResponseEncryption.
+	EncryptedData string `json:"encrypted_data,omitempty"`
+	Signature     string `json:"signature,omitempty"`
 }
 
 type ResponseData struct {
@@ -41,4 +51,18 @@ type ResponseData struct {
 	RequestId  string `json:"request_id,omitempty"`
 	Action     string `json:"action,omitempty"`
 	WaitTime   string `json:"wait_time,omitempty"`
+	// RuleId, ReasonCode and Reason explain a REJECT or WAIT, they are set
+	// according to CallbackServiceConfig.ResponseReasons.
+	RuleId     string `json:"rule_id,omitempty"`
+	ReasonCode string `json:"reason_code,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	// EncryptedFields holds the encrypted fields when only some are
+	// encrypted.
+	EncryptedFields string `json:"encrypted_fields,omitempty"`
+}
+
+// ErrorData is the signed payload of an error Response, which has no Data.
+type ErrorData struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
 }
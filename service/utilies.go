@@ -1,75 +1,49 @@
 package service
 
 import (
+	"crypto"
 	"crypto/ecdsa"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 )
 
-func loadTSSNodePublicKey(path string) (*ecdsa.PublicKey, error) {
+func loadPublicKey(path string) (crypto.PublicKey, error) {
 	pemData, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read the PEM file: %v", err)
 	}
-	block, _ := pem.Decode(pemData)
-	if block == nil || block.Type != "PUBLIC KEY" {
-		return nil, fmt.Errorf("failed to decode PEM block containing the public key")
-	}
-	pubInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
+	return ParsePublicKeyPEM(pemData)
+}
 
+// loadDecryptKey loads the decrypt signature private key, an ECDSA or an
+// X25519 key.
+func loadDecryptKey(path string) (crypto.PrivateKey, error) {
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: failed to read the PEM file: %v", err)
+	}
+	if key, err := ParseX25519PrivateKeyPEM(pemData); err == nil {
+		return key, nil
+	}
+	key, err := ParsePrivateKeyPEM(pemData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %v", err)
+		return nil, fmt.Errorf("failed to load private key: %v", err)
 	}
-	pubKey, ok := pubInterface.(*ecdsa.PublicKey)
+	privateKey, ok := key.(*ecdsa.PrivateKey)
 	if !ok {
-		return nil, fmt.Errorf("not an ECDSA public key")
+		return nil, fmt.Errorf("private key is neither an ECDSA nor an X25519 private key")
 	}
-	return pubKey, nil
+	return privateKey, nil
 }
 
-func loadKeypair(path string) (*ecdsa.PrivateKey, *ecdsa.PublicKey, error) {
-	load := func(path string) (interface{}, error) {
-		pemData, err := ioutil.ReadFile(path)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read the PEM file: %v", err)
-		}
-		var block *pem.Block
-		for {
-			block, pemData = pem.Decode(pemData)
-			if block == nil {
-				return nil, fmt.Errorf("failed to find PEM block containing the EC private key")
-			}
-			if block.Type == "EC PRIVATE KEY" {
-				break
-			}
-		}
-
-		priKey, err := x509.ParseECPrivateKey(block.Bytes)
-		if err != nil {
-			keyInterface, err := x509.ParsePKCS8PrivateKey(block.Bytes)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse private key: %v", err)
-			}
-			priKey, ok := keyInterface.(*ecdsa.PrivateKey)
-			if !ok {
-				return nil, fmt.Errorf("not an ECDSA public key")
-			}
-			return priKey, nil
-		}
-		return priKey, nil
-	}
-
-	var err error
-	var ok bool
-	var privateKey *ecdsa.PrivateKey
-	var result interface{}
-	if result, err = load(path); err != nil {
-		return nil, nil, fmt.Errorf("failed to load private key: %v", err)
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: failed to read the PEM file: %v", err)
 	}
-	if privateKey, ok = result.(*ecdsa.PrivateKey); !ok {
-		return nil, nil, fmt.Errorf("private key is not an ECDSA private key")
+	key, err := ParsePrivateKeyPEM(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: %v", err)
 	}
-	return privateKey, &privateKey.PublicKey, nil
+	return key, nil
 }